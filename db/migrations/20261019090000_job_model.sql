@@ -0,0 +1,90 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Archive jobs now track their own state explicitly instead of relying on a
+-- single "processed" flag, and who asked for the archive is recorded
+CREATE TABLE archive_jobs_new (
+  id integer not null primary key,
+  created_at datetime not null,
+  next_attempt_at datetime not null,
+  completed_at datetime,
+  requested_by text not null default '',
+  notification_emails text not null,
+
+  -- One of "pending", "complete", or "failed"
+  status text not null,
+  attempts integer not null default 0,
+  last_error text not null default ''
+);
+
+INSERT INTO archive_jobs_new (id, created_at, next_attempt_at, notification_emails, status)
+  SELECT id, created_at, next_attempt_at, notification_emails,
+    CASE WHEN processed THEN 'complete' ELSE 'pending' END
+  FROM archive_jobs;
+
+-- Job files tie a job to the catalog's files rather than storing raw paths
+CREATE TABLE job_files (
+  id integer not null primary key,
+  job_id integer not null,
+  file_id integer not null
+);
+
+CREATE INDEX job_files_job_id ON job_files (job_id);
+CREATE INDEX job_files_file_id ON job_files (file_id);
+
+-- Old jobs stored RS-separated full paths; we split those apart and find the
+-- files they referred to.  The full-path index is only needed for this.
+CREATE INDEX files_full_path_tmp ON files (full_path);
+
+WITH RECURSIVE split(job_id, path, rest) AS (
+  SELECT id, '', files || char(30) FROM archive_jobs
+  UNION ALL
+  SELECT job_id, substr(rest, 1, instr(rest, char(30)) - 1), substr(rest, instr(rest, char(30)) + 1)
+  FROM split WHERE rest <> ''
+)
+INSERT INTO job_files (job_id, file_id)
+  SELECT split.job_id, files.id FROM split JOIN files ON files.full_path = split.path;
+
+DROP INDEX files_full_path_tmp;
+
+-- Each time the archiver tries to build a job, we record when and how it went
+CREATE TABLE job_attempts (
+  id integer not null primary key,
+  job_id integer not null,
+  started_at datetime not null,
+  finished_at datetime not null,
+  error text not null
+);
+
+CREATE INDEX job_attempts_job_id ON job_attempts (job_id);
+
+DROP TABLE archive_jobs;
+ALTER TABLE archive_jobs_new RENAME TO archive_jobs;
+CREATE INDEX archive_jobs_created_at ON archive_jobs (created_at);
+CREATE INDEX archive_jobs_next_attempt_at ON archive_jobs (next_attempt_at);
+CREATE INDEX archive_jobs_status ON archive_jobs (status);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+CREATE TABLE archive_jobs_old (
+  id integer not null primary key,
+  created_at datetime not null,
+  next_attempt_at datetime not null,
+  files text not null,
+  notification_emails text not null,
+  processed boolean
+);
+
+INSERT INTO archive_jobs_old (id, created_at, next_attempt_at, files, notification_emails, processed)
+  SELECT archive_jobs.id, created_at, next_attempt_at,
+    COALESCE((SELECT group_concat(files.full_path, char(30)) FROM job_files
+      JOIN files ON files.id = job_files.file_id WHERE job_files.job_id = archive_jobs.id), ''),
+    notification_emails, status = 'complete'
+  FROM archive_jobs;
+
+DROP TABLE job_attempts;
+DROP TABLE job_files;
+DROP TABLE archive_jobs;
+ALTER TABLE archive_jobs_old RENAME TO archive_jobs;
+CREATE INDEX archive_jobs_created_at ON archive_jobs (created_at);
+CREATE INDEX archive_jobs_next_attempt_at ON archive_jobs (next_attempt_at);
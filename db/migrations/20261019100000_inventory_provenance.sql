@@ -0,0 +1,27 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Inventories record when they were indexed, how many records they had (and
+-- how many of those couldn't be indexed), how many bytes their files add up
+-- to, and the SHA256 of the inventory file itself
+ALTER TABLE inventories ADD COLUMN indexed_at datetime;
+ALTER TABLE inventories ADD COLUMN record_count integer not null default 0;
+ALTER TABLE inventories ADD COLUMN failed_count integer not null default 0;
+ALTER TABLE inventories ADD COLUMN total_bytes integer not null default 0;
+ALTER TABLE inventories ADD COLUMN checksum text not null default '';
+
+-- Existing inventories' counts can be derived from what was indexed; failures
+-- weren't tracked, so those are unknown
+UPDATE inventories SET
+  record_count = (SELECT COUNT(*) FROM files WHERE files.inventory_id = inventories.id),
+  total_bytes = COALESCE((SELECT SUM(filesize) FROM files WHERE files.inventory_id = inventories.id), 0);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+CREATE TABLE inventories_old (
+  id integer not null primary key,
+  path text not null
+);
+INSERT INTO inventories_old (id, path) SELECT id, path FROM inventories;
+DROP TABLE inventories;
+ALTER TABLE inventories_old RENAME TO inventories;
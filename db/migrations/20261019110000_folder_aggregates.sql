@@ -0,0 +1,68 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Folders and categories keep recursive totals of the files beneath them so
+-- we can show how big something is without counting it on every page load
+ALTER TABLE folders ADD COLUMN file_count integer not null default 0;
+ALTER TABLE folders ADD COLUMN total_bytes integer not null default 0;
+ALTER TABLE folders ADD COLUMN min_archive_date text not null default '';
+ALTER TABLE folders ADD COLUMN max_archive_date text not null default '';
+ALTER TABLE categories ADD COLUMN file_count integer not null default 0;
+ALTER TABLE categories ADD COLUMN total_bytes integer not null default 0;
+ALTER TABLE categories ADD COLUMN min_archive_date text not null default '';
+ALTER TABLE categories ADD COLUMN max_archive_date text not null default '';
+
+-- Pair every file with its folder and all of that folder's ancestors, then
+-- total it all up per folder
+CREATE TEMPORARY TABLE folder_aggregates AS
+  WITH RECURSIVE ancestors(folder_id, file_id) AS (
+    SELECT folder_id, id FROM files WHERE folder_id > 0
+    UNION ALL
+    SELECT d.folder_id, a.file_id FROM ancestors a JOIN folders d ON d.id = a.folder_id WHERE d.folder_id > 0
+  )
+  SELECT a.folder_id AS folder_id, COUNT(*) AS file_count, SUM(f.filesize) AS total_bytes,
+    MIN(f.archive_date) AS min_archive_date, MAX(f.archive_date) AS max_archive_date
+  FROM ancestors a JOIN files f ON f.id = a.file_id
+  GROUP BY a.folder_id;
+CREATE INDEX folder_aggregates_folder_id ON folder_aggregates (folder_id);
+
+UPDATE folders SET
+  file_count = COALESCE((SELECT file_count FROM folder_aggregates a WHERE a.folder_id = folders.id), 0),
+  total_bytes = COALESCE((SELECT total_bytes FROM folder_aggregates a WHERE a.folder_id = folders.id), 0),
+  min_archive_date = COALESCE((SELECT min_archive_date FROM folder_aggregates a WHERE a.folder_id = folders.id), ''),
+  max_archive_date = COALESCE((SELECT max_archive_date FROM folder_aggregates a WHERE a.folder_id = folders.id), '');
+DROP TABLE folder_aggregates;
+
+UPDATE categories SET
+  file_count = (SELECT COUNT(*) FROM files WHERE files.category_id = categories.id),
+  total_bytes = COALESCE((SELECT SUM(filesize) FROM files WHERE files.category_id = categories.id), 0),
+  min_archive_date = COALESCE((SELECT MIN(archive_date) FROM files WHERE files.category_id = categories.id), ''),
+  max_archive_date = COALESCE((SELECT MAX(archive_date) FROM files WHERE files.category_id = categories.id), '');
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+CREATE TABLE folders_old (
+  id integer not null primary key,
+  category_id integer not null,
+  folder_id integer not null,
+  depth integer not null,
+  name text not null,
+  public_path text not null
+);
+INSERT INTO folders_old (id, category_id, folder_id, depth, name, public_path)
+  SELECT id, category_id, folder_id, depth, name, public_path FROM folders;
+DROP TABLE folders;
+ALTER TABLE folders_old RENAME TO folders;
+CREATE INDEX folders_public_path ON folders (public_path);
+CREATE INDEX folders_folder_id ON folders (folder_id);
+CREATE INDEX folders_depth ON folders (depth);
+CREATE UNIQUE INDEX folders_unique ON folders (category_id, public_path);
+
+CREATE TABLE categories_old (
+  id integer not null primary key,
+  name text not null
+);
+INSERT INTO categories_old (id, name) SELECT id, name FROM categories;
+DROP TABLE categories;
+ALTER TABLE categories_old RENAME TO categories;
+CREATE INDEX categories_name ON categories (name);
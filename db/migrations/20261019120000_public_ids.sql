@@ -0,0 +1,58 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Public ids are what we put in URLs instead of database ids, which don't
+-- survive a catalog rebuild.  They're derived from a SHA256 which SQLite
+-- can't compute, so existing rows are given their ids by the next command to
+-- open the catalog for writing (see db.New).
+ALTER TABLE files ADD COLUMN public_id text not null default '';
+ALTER TABLE folders ADD COLUMN public_id text not null default '';
+CREATE INDEX files_public_id ON files (public_id);
+CREATE INDEX folders_public_id ON folders (public_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+CREATE TABLE files_old (
+  id integer not null primary key,
+  category_id integer not null,
+  inventory_id integer not null,
+  folder_id integer not null,
+  depth integer not null,
+  archive_date text not null,
+  checksum text not null,
+  filesize integer not null,
+  name text not null,
+  full_path text not null,
+  public_path text not null
+);
+INSERT INTO files_old (id, category_id, inventory_id, folder_id, depth, archive_date, checksum, filesize, name, full_path, public_path)
+  SELECT id, category_id, inventory_id, folder_id, depth, archive_date, checksum, filesize, name, full_path, public_path FROM files;
+DROP TABLE files;
+ALTER TABLE files_old RENAME TO files;
+CREATE INDEX files_public_path ON files (public_path);
+CREATE INDEX files_category_id ON files (category_id);
+CREATE INDEX files_folder_id ON files (folder_id);
+CREATE INDEX files_inventory_id ON files (inventory_id);
+CREATE INDEX files_depth ON files (depth);
+CREATE UNIQUE INDEX files_unique ON files (category_id, archive_date, public_path);
+
+CREATE TABLE folders_old (
+  id integer not null primary key,
+  category_id integer not null,
+  folder_id integer not null,
+  depth integer not null,
+  name text not null,
+  public_path text not null,
+  file_count integer not null default 0,
+  total_bytes integer not null default 0,
+  min_archive_date text not null default '',
+  max_archive_date text not null default ''
+);
+INSERT INTO folders_old (id, category_id, folder_id, depth, name, public_path, file_count, total_bytes, min_archive_date, max_archive_date)
+  SELECT id, category_id, folder_id, depth, name, public_path, file_count, total_bytes, min_archive_date, max_archive_date FROM folders;
+DROP TABLE folders;
+ALTER TABLE folders_old RENAME TO folders;
+CREATE INDEX folders_public_path ON folders (public_path);
+CREATE INDEX folders_folder_id ON folders (folder_id);
+CREATE INDEX folders_depth ON folders (depth);
+CREATE UNIQUE INDEX folders_unique ON folders (category_id, public_path);
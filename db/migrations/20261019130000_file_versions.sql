@@ -0,0 +1,10 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- The same public path archived on different dates makes up a file's version
+-- history, which we need to be able to pull up quickly
+CREATE INDEX files_versions ON files (category_id, public_path, archive_date);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX files_versions;
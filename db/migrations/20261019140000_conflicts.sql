@@ -0,0 +1,35 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Conflicts record an inventory describing a file which a different inventory
+-- already described.  Inventories are stored by path since a rejected
+-- inventory never gets a row of its own.
+CREATE TABLE conflicts (
+  id integer not null primary key,
+  created_at datetime not null,
+  category_id integer not null,
+  archive_date text not null,
+  public_path text not null,
+  existing_inventory text not null,
+  existing_checksum text not null,
+  existing_filesize integer not null,
+  new_inventory text not null,
+  new_checksum text not null,
+  new_filesize integer not null,
+
+  -- What the indexer did: "identical", "kept existing", "replaced", or
+  -- "rejected inventory"
+  outcome text not null,
+
+  -- Conflicts are resolved once staff have reviewed them; identical files
+  -- aren't really conflicts, so they're resolved automatically
+  resolved_at datetime,
+  resolved_by text not null default ''
+);
+
+CREATE INDEX conflicts_resolved_by ON conflicts (resolved_by);
+CREATE INDEX conflicts_new_inventory ON conflicts (new_inventory);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE conflicts;
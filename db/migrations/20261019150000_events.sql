@@ -0,0 +1,30 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Events are a PREMIS-style log of what happened to files and inventories.
+-- Objects are identified by public id (files) or path (inventories) rather
+-- than database id so the log survives retractions and catalog rebuilds.
+-- Events about a whole inventory, such as ingestion, have no file id.
+CREATE TABLE events (
+  id integer not null primary key,
+  event_type text not null,
+  occurred_at datetime not null,
+  file_public_id text not null default '',
+  inventory_path text not null default '',
+
+  -- The agent is a person's login or a piece of software; agent_type is
+  -- "person" or "software"
+  agent text not null,
+  agent_type text not null,
+
+  -- Outcome is "success" or "failure"; detail is free text
+  outcome text not null,
+  detail text not null default ''
+);
+
+CREATE INDEX events_file_public_id ON events (file_public_id);
+CREATE INDEX events_inventory_path ON events (inventory_path);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE events;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Restrictions hide a category, folder, or inventory (and everything in it)
+-- from everybody but a list of people, optionally until an embargo ends.
+-- Exactly one of category_id, folder_id, and inventory_id is set.
+CREATE TABLE restrictions (
+  id integer not null primary key,
+  created_at datetime not null,
+  created_by text not null,
+  category_id integer not null default 0,
+  folder_id integer not null default 0,
+  inventory_id integer not null default 0,
+
+  -- The date (YYYY-MM-DD) the restriction lifts; blank means never
+  embargo_until text not null default '',
+
+  -- Space-separated logins of people who may see restricted material
+  audience text not null default '',
+  note text not null default ''
+);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE restrictions;
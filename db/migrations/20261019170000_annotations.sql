@@ -0,0 +1,34 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Notes and tags are staff annotations on files and folders.  Like events,
+-- they refer to their file or folder by public id so they survive catalog
+-- rebuilds.
+CREATE TABLE notes (
+  id integer not null primary key,
+  public_id text not null,
+  created_at datetime not null,
+  author text not null,
+  updated_at datetime not null,
+  updated_by text not null,
+  body text not null
+);
+
+CREATE INDEX notes_public_id ON notes (public_id);
+
+-- Tags must be one of the values in the TAGS setting
+CREATE TABLE tags (
+  id integer not null primary key,
+  public_id text not null,
+  tag text not null,
+  created_at datetime not null,
+  author text not null
+);
+
+CREATE UNIQUE INDEX tags_public_id_tag ON tags (public_id, tag);
+CREATE INDEX tags_tag ON tags (tag);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE notes;
+DROP TABLE tags;
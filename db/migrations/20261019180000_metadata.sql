@@ -0,0 +1,21 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Metadata holds descriptive fields (title, creator, etc.) read from sidecar
+-- files found alongside inventories.  Each row is one value of one field for
+-- a file or folder, identified by public id.  The inventory path records
+-- which inventory's sidecar the value came from.
+CREATE TABLE metadata (
+  id integer not null primary key,
+  public_id text not null,
+  inventory_path text not null,
+  field text not null,
+  value text not null
+);
+
+CREATE INDEX metadata_public_id ON metadata (public_id);
+CREATE INDEX metadata_inventory_path ON metadata (inventory_path);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE metadata;
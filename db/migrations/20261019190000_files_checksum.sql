@@ -0,0 +1,9 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Checksum lookups ("do we already have this?") search files by content
+CREATE INDEX files_checksum ON files (checksum);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX files_checksum;
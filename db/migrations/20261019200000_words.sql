@@ -0,0 +1,27 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Words are the distinct lowercased words in files' public paths, split on
+-- anything which isn't a letter or digit, for fuzzy searching.  Each word's
+-- trigrams find words spelled similarly.  The indexer adds words as files are
+-- indexed, and fills these tables in the first time it runs after this
+-- migration.  Words are never removed, so a retracted file's words may stay
+-- until the catalog is rebuilt.
+CREATE TABLE words (
+  id integer not null primary key,
+  word text not null
+);
+
+CREATE UNIQUE INDEX words_word ON words (word);
+
+CREATE TABLE word_trigrams (
+  trigram text not null,
+  word_id integer not null
+);
+
+CREATE INDEX word_trigrams_trigram ON word_trigrams (trigram);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE words;
+DROP TABLE word_trigrams;
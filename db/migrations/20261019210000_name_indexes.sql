@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Autocompletion looks up names and folder paths by prefix, ignoring case.
+-- SQLite's LIKE ignores case, so it can only use an index to find a prefix if
+-- the index ignores case as well.
+CREATE INDEX files_name_nocase ON files (name COLLATE NOCASE);
+CREATE INDEX folders_name_nocase ON folders (name COLLATE NOCASE);
+CREATE INDEX folders_public_path_nocase ON folders (public_path COLLATE NOCASE);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP INDEX files_name_nocase;
+DROP INDEX folders_name_nocase;
+DROP INDEX folders_public_path_nocase;
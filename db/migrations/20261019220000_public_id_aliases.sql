@@ -0,0 +1,15 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- When recomputing paths gives a file or folder a new public id, its old id
+-- is kept here so links and scripts using it still find it
+CREATE TABLE public_id_aliases (
+  old_public_id text not null primary key,
+  public_id text not null
+);
+
+CREATE INDEX public_id_aliases_public_id ON public_id_aliases (public_id);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+DROP TABLE public_id_aliases;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- SQL in section 'Up' is executed when this migration is applied
+
+-- Checksums are looked up lowercased, so they have to be stored that way.
+-- Inventories written by other tools may have used uppercase hex.
+UPDATE files SET checksum = LOWER(checksum) WHERE checksum <> LOWER(checksum);
+UPDATE conflicts SET existing_checksum = LOWER(existing_checksum) WHERE existing_checksum <> LOWER(existing_checksum);
+UPDATE conflicts SET new_checksum = LOWER(new_checksum) WHERE new_checksum <> LOWER(new_checksum);
+
+-- +goose Down
+-- SQL section 'Down' is executed when this migration is rolled back
+
+-- The original case isn't kept, and lowercased checksums are still valid, so
+-- there's nothing to undo
@@ -0,0 +1,177 @@
+package catalog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// exporter holds the lookups needed to turn database ids into natural keys
+// while streaming records out
+type exporter struct {
+	op          *db.Operation
+	enc         *json.Encoder
+	categories  map[int]string
+	inventories map[int]string
+	folders     map[int]*db.Folder
+	err         error
+
+	// When filters are set, only matching files are exported, and pids holds
+	// their public ids so only their notes and tags go with them
+	filters db.Filters
+	pids    map[string]bool
+}
+
+// Export writes the entire catalog to w as JSON Lines.  Parents are always
+// written before children, so an export can be imported in a single pass.
+//
+// If any filters are set, only the files which pass them are written, along
+// with their notes and tags.  Categories, inventories, and folders are left
+// out, since importing the files creates whichever ones they need.
+func Export(dbh *db.Database, w io.Writer, filters db.Filters) error {
+	return dbh.InTransaction(func(op *db.Operation) error {
+		var e = &exporter{
+			op:          op,
+			enc:         json.NewEncoder(w),
+			categories:  make(map[int]string),
+			inventories: make(map[int]string),
+			folders:     make(map[int]*db.Folder),
+			filters:     filters,
+			pids:        make(map[string]bool),
+		}
+		e.exportCategories()
+		e.exportInventories()
+		if filters.Empty() {
+			e.exportFolders()
+			e.exportRealFolders()
+		}
+		e.exportFiles()
+		e.exportNotes()
+		e.exportTags()
+
+		if e.err != nil {
+			return e.err
+		}
+		return op.Operation.Err()
+	})
+}
+
+// write encodes a single record unless a previous write has failed
+func (e *exporter) write(rec interface{}) {
+	if e.err != nil {
+		return
+	}
+	var err = e.enc.Encode(rec)
+	if err != nil {
+		e.err = fmt.Errorf("unable to write record: %s", err)
+	}
+}
+
+func (e *exporter) exportCategories() {
+	var c = &db.Category{}
+	e.op.Categories.Select().Order("name").EachObject(c, func() {
+		e.categories[c.ID] = c.Name
+		if e.filters.Empty() {
+			e.write(&Category{Kind: KindCategory, Name: c.Name})
+		}
+	})
+}
+
+func (e *exporter) exportInventories() {
+	var i = &db.Inventory{}
+	e.op.Inventories.Select().Order("path").EachObject(i, func() {
+		e.inventories[i.ID] = i.Path
+		if e.filters.Empty() {
+			e.write(&Inventory{Kind: KindInventory, Path: i.Path})
+		}
+	})
+}
+
+func (e *exporter) exportFolders() {
+	var f = &db.Folder{}
+	e.op.Folders.Select().Order("category_id, depth, public_path").EachObject(f, func() {
+		e.folders[f.ID] = &db.Folder{ID: f.ID, CategoryID: f.CategoryID, PublicPath: f.PublicPath}
+		e.write(&Folder{Kind: KindFolder, Category: e.categories[f.CategoryID], PublicPath: f.PublicPath, PublicID: f.PublicID})
+	})
+}
+
+func (e *exporter) exportRealFolders() {
+	var rf = &db.RealFolder{}
+	e.op.RealFolders.Select().Order("folder_id, full_path").EachObject(rf, func() {
+		var f = e.folders[rf.FolderID]
+		if f == nil {
+			e.err = fmt.Errorf("real folder %q refers to nonexistent folder %d", rf.FullPath, rf.FolderID)
+			return
+		}
+		e.write(&RealFolder{
+			Kind:       KindRealFolder,
+			Category:   e.categories[f.CategoryID],
+			PublicPath: f.PublicPath,
+			FullPath:   rf.FullPath,
+		})
+	})
+}
+
+func (e *exporter) exportFiles() {
+	if !e.filters.Empty() {
+		var err = e.op.FileSelect(nil, nil).TreeMode(true).Filters(e.filters).EachFile(e.exportFile)
+		if err != nil && e.err == nil {
+			e.err = err
+		}
+		return
+	}
+
+	var f = &db.File{}
+	e.op.Files.Select().Order("id").EachObject(f, func() { e.exportFile(f) })
+}
+
+func (e *exporter) exportFile(f *db.File) {
+	e.pids[f.PublicID] = true
+	e.write(&File{
+		Kind:        KindFile,
+		Category:    e.categories[f.CategoryID],
+		Inventory:   e.inventories[f.InventoryID],
+		ArchiveDate: f.ArchiveDate,
+		Checksum:    f.Checksum,
+		Filesize:    f.Filesize,
+		FullPath:    f.FullPath,
+		PublicPath:  f.PublicPath,
+		PublicID:    f.PublicID,
+	})
+}
+
+// wanted returns true if notes and tags on the given public id belong in the
+// export
+func (e *exporter) wanted(pid string) bool {
+	return e.filters.Empty() || e.pids[pid]
+}
+
+func (e *exporter) exportNotes() {
+	var n = &db.Note{}
+	e.op.Notes.Select().Order("id").EachObject(n, func() {
+		if !e.wanted(n.PublicID) {
+			return
+		}
+		e.write(&Note{
+			Kind:      KindNote,
+			PublicID:  n.PublicID,
+			CreatedAt: n.CreatedAt,
+			Author:    n.Author,
+			UpdatedAt: n.UpdatedAt,
+			UpdatedBy: n.UpdatedBy,
+			Body:      n.Body,
+		})
+	})
+}
+
+func (e *exporter) exportTags() {
+	var t = &db.Tag{}
+	e.op.Tags.Select().Order("id").EachObject(t, func() {
+		if !e.wanted(t.PublicID) {
+			return
+		}
+		e.write(&Tag{Kind: KindTag, PublicID: t.PublicID, Tag: t.Tag, CreatedAt: t.CreatedAt, Author: t.Author})
+	})
+}
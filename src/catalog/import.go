@@ -0,0 +1,384 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// maxLineLength is the longest single record we'll read from an import
+const maxLineLength = 1024 * 1024
+
+// ImportStats reports what an import did
+type ImportStats struct {
+	Records int
+	Created int
+}
+
+// importer caches the records we've found or created so a large import
+// doesn't have to look up the same categories and folders over and over
+type importer struct {
+	op          *db.Operation
+	stats       *ImportStats
+	categories  map[string]*db.Category
+	inventories map[string]*db.Inventory
+	folders     map[string]*db.Folder
+}
+
+// Import reads JSON Lines as written by Export and adds anything missing to
+// the catalog.  Records which already exist are skipped, so importing the
+// same data twice is harmless.  Folders are built the same way the indexer
+// builds them, creating any missing ancestors along the way.  The import runs
+// in a single transaction: if any record fails, nothing is stored.
+func Import(dbh *db.Database, r io.Reader) (*ImportStats, error) {
+	var stats = &ImportStats{}
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		var i = &importer{
+			op:          op,
+			stats:       stats,
+			categories:  make(map[string]*db.Category),
+			inventories: make(map[string]*db.Inventory),
+			folders:     make(map[string]*db.Folder),
+		}
+
+		var scanner = bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+		var lineNum int
+		for scanner.Scan() {
+			lineNum++
+			var line = scanner.Bytes()
+			if len(line) == 0 {
+				continue
+			}
+			var err = i.importLine(line)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", lineNum, err)
+			}
+		}
+		if scanner.Err() != nil {
+			return scanner.Err()
+		}
+
+		// Imported files have to be counted in their folders' and categories'
+		// totals, and it's far simpler to recompute everything than to track
+		// which totals changed
+		if stats.Created > 0 {
+			return op.RecomputeAggregates()
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+func (i *importer) importLine(line []byte) error {
+	var k kindOnly
+	var err = json.Unmarshal(line, &k)
+	if err != nil {
+		return fmt.Errorf("invalid JSON: %s", err)
+	}
+
+	i.stats.Records++
+	switch k.Kind {
+	case KindCategory:
+		var rec Category
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			_, err = i.category(rec.Name)
+		}
+	case KindInventory:
+		var rec Inventory
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			_, err = i.inventory(rec.Path)
+		}
+	case KindFolder:
+		var rec Folder
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			err = i.importFolder(&rec)
+		}
+	case KindRealFolder:
+		var rec RealFolder
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			err = i.importRealFolder(&rec)
+		}
+	case KindFile:
+		var rec File
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			err = i.importFile(&rec)
+		}
+	case KindNote:
+		var rec Note
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			err = i.importNote(&rec)
+		}
+	case KindTag:
+		var rec Tag
+		err = json.Unmarshal(line, &rec)
+		if err == nil {
+			err = i.importTag(&rec)
+		}
+	default:
+		err = fmt.Errorf("unknown record kind %q", k.Kind)
+	}
+
+	return err
+}
+
+// created counts a new database row
+func (i *importer) created() {
+	i.stats.Created++
+}
+
+func (i *importer) category(name string) (*db.Category, error) {
+	if name == "" {
+		return nil, fmt.Errorf("category name must not be empty")
+	}
+	if i.categories[name] != nil {
+		return i.categories[name], nil
+	}
+
+	var c, err = i.op.FindCategoryByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		c = &db.Category{Name: name}
+		i.op.Categories.Save(c)
+		if i.op.Operation.Err() != nil {
+			return nil, fmt.Errorf("couldn't create category %q: %s", name, i.op.Operation.Err())
+		}
+		i.created()
+	}
+	i.categories[name] = c
+	return c, nil
+}
+
+func (i *importer) inventory(path string) (*db.Inventory, error) {
+	if path == "" {
+		return nil, fmt.Errorf("inventory path must not be empty")
+	}
+	if i.inventories[path] != nil {
+		return i.inventories[path], nil
+	}
+
+	var inv, err = i.op.FindInventoryByPath(path)
+	if err != nil {
+		return nil, err
+	}
+	if inv == nil {
+		inv = &db.Inventory{Path: path}
+		err = i.op.WriteInventory(inv)
+		if err != nil {
+			return nil, err
+		}
+		i.created()
+	}
+	i.inventories[path] = inv
+	return inv, nil
+}
+
+// folder returns the folder at the given public path, creating it and any of
+// its ancestors which don't yet exist
+func (i *importer) folder(c *db.Category, publicPath string) (*db.Folder, error) {
+	var parts = strings.Split(publicPath, string(os.PathSeparator))
+	var parent *db.Folder
+	var curPath string
+	for _, part := range parts {
+		curPath = filepath.Join(curPath, part)
+		var key = c.Name + "\x00" + curPath
+		var f = i.folders[key]
+		if f == nil {
+			var existing, err = i.op.FindFolderByPath(c, curPath)
+			if err != nil {
+				return nil, err
+			}
+			f, err = i.op.FindOrCreateFolder(c, parent, curPath)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't build folder %q: %s", curPath, err)
+			}
+			if existing == nil {
+				i.created()
+			}
+			i.folders[key] = f
+		}
+		parent = f
+	}
+
+	return parent, nil
+}
+
+func (i *importer) importFolder(rec *Folder) error {
+	var c, err = i.category(rec.Category)
+	if err != nil {
+		return err
+	}
+	if rec.PublicPath == "" {
+		return fmt.Errorf("folder public path must not be empty")
+	}
+
+	// A folder with a public id from the export has to keep it, but we never
+	// replace the id of a folder that was already in the catalog
+	var before = i.stats.Created
+	var f *db.Folder
+	f, err = i.folder(c, rec.PublicPath)
+	if err != nil || rec.PublicID == "" || i.stats.Created == before || f.PublicID == rec.PublicID {
+		return err
+	}
+	f.PublicID = rec.PublicID
+	i.op.Folders.Save(f)
+	return i.op.Operation.Err()
+}
+
+func (i *importer) importRealFolder(rec *RealFolder) error {
+	var c, err = i.category(rec.Category)
+	if err != nil {
+		return err
+	}
+	var f *db.Folder
+	f, err = i.folder(c, rec.PublicPath)
+	if err != nil {
+		return err
+	}
+
+	var rf *db.RealFolder
+	rf, err = i.op.FindRealFolderByPath(f, rec.FullPath)
+	if err != nil {
+		return err
+	}
+	if rf != nil {
+		return nil
+	}
+
+	_, err = i.op.FindOrCreateRealFolder(f, rec.FullPath)
+	if err == nil {
+		i.created()
+	}
+	return err
+}
+
+func (i *importer) importFile(rec *File) error {
+	var c, err = i.category(rec.Category)
+	if err != nil {
+		return err
+	}
+
+	var existing *db.File
+	existing, err = i.op.FindFile(c, rec.ArchiveDate, rec.PublicPath)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+
+	var inv *db.Inventory
+	inv, err = i.inventory(rec.Inventory)
+	if err != nil {
+		return err
+	}
+
+	var folder *db.Folder
+	var fid int
+	var dir = filepath.Dir(rec.PublicPath)
+	if dir != "." {
+		folder, err = i.folder(c, dir)
+		if err != nil {
+			return err
+		}
+		fid = folder.ID
+	}
+
+	var pid = rec.PublicID
+	if pid == "" {
+		pid = db.FilePublicID(c.Name, rec.ArchiveDate, rec.PublicPath)
+	}
+
+	var _, fname = filepath.Split(rec.FullPath)
+	i.op.Files.Save(&db.File{
+		CategoryID:  c.ID,
+		InventoryID: inv.ID,
+		FolderID:    fid,
+		Depth:       strings.Count(rec.PublicPath, string(os.PathSeparator)),
+		ArchiveDate: rec.ArchiveDate,
+		Checksum:    strings.ToLower(rec.Checksum),
+		Filesize:    rec.Filesize,
+		Name:        fname,
+		FullPath:    rec.FullPath,
+		PublicPath:  rec.PublicPath,
+		PublicID:    pid,
+	})
+	if i.op.Operation.Err() != nil {
+		return fmt.Errorf("couldn't store file %q: %s", rec.PublicPath, i.op.Operation.Err())
+	}
+	i.created()
+	return nil
+}
+
+// importNote stores a note unless the catalog already has one for the same
+// file or folder with the same author, creation time, and text.  Notes are
+// kept even if their file or folder isn't in the catalog, since public ids
+// never change and the file or folder may be indexed later.
+func (i *importer) importNote(rec *Note) error {
+	if rec.PublicID == "" {
+		return fmt.Errorf("note public id must not be empty")
+	}
+	var notes, err = i.op.GetNotes(rec.PublicID)
+	if err != nil {
+		return err
+	}
+	for _, n := range notes {
+		if n.Author == rec.Author && n.CreatedAt.Equal(rec.CreatedAt) && n.Body == rec.Body {
+			return nil
+		}
+	}
+
+	i.op.Notes.Save(&db.Note{
+		PublicID:  rec.PublicID,
+		CreatedAt: rec.CreatedAt,
+		Author:    rec.Author,
+		UpdatedAt: rec.UpdatedAt,
+		UpdatedBy: rec.UpdatedBy,
+		Body:      rec.Body,
+	})
+	if i.op.Operation.Err() != nil {
+		return fmt.Errorf("couldn't store note for %q: %s", rec.PublicID, i.op.Operation.Err())
+	}
+	i.created()
+	return nil
+}
+
+// importTag stores a tag unless the file or folder already has it.  Tags
+// aren't checked against the TAGS setting, since the catalog they came from
+// may have been configured differently.
+func (i *importer) importTag(rec *Tag) error {
+	if rec.PublicID == "" || rec.Tag == "" {
+		return fmt.Errorf("tag public id and name must not be empty")
+	}
+	var tags, err = i.op.GetTags(rec.PublicID)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		if t.Tag == rec.Tag {
+			return nil
+		}
+	}
+
+	i.op.Tags.Save(&db.Tag{PublicID: rec.PublicID, Tag: rec.Tag, CreatedAt: rec.CreatedAt, Author: rec.Author})
+	if i.op.Operation.Err() != nil {
+		return fmt.Errorf("couldn't store tag for %q: %s", rec.PublicID, i.op.Operation.Err())
+	}
+	i.created()
+	return nil
+}
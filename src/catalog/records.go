@@ -0,0 +1,92 @@
+// Package catalog streams the catalog's contents to and from JSON Lines so a
+// catalog can be moved between machines, diffed, or handed to other tools
+// without touching the database directly
+package catalog
+
+import "time"
+
+// Record kinds, in the order an export writes them.  Every line of an export
+// is a single JSON object with a "kind" field telling readers which of the
+// record types below the line holds.
+const (
+	KindCategory   = "category"
+	KindInventory  = "inventory"
+	KindFolder     = "folder"
+	KindRealFolder = "real_folder"
+	KindFile       = "file"
+	KindNote       = "note"
+	KindTag        = "tag"
+)
+
+// Records refer to one another by their natural keys (category name, public
+// path, etc.) rather than database ids, since ids differ from one catalog to
+// the next.  Derived data, such as a folder's name and depth, isn't exported.
+// Public ids are exported since they must never change once assigned, and
+// notes and tags refer to their file or folder by public id.
+
+// kindOnly lets us peek at a line's kind before decoding the whole record
+type kindOnly struct {
+	Kind string `json:"kind"`
+}
+
+// Category is the exported form of a db.Category
+type Category struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// Inventory is the exported form of a db.Inventory
+type Inventory struct {
+	Kind string `json:"kind"`
+	Path string `json:"path"`
+}
+
+// Folder is the exported form of a db.Folder.  Its parent is implied by the
+// public path.
+type Folder struct {
+	Kind       string `json:"kind"`
+	Category   string `json:"category"`
+	PublicPath string `json:"public_path"`
+	PublicID   string `json:"public_id,omitempty"`
+}
+
+// RealFolder is the exported form of a db.RealFolder
+type RealFolder struct {
+	Kind       string `json:"kind"`
+	Category   string `json:"category"`
+	PublicPath string `json:"public_path"`
+	FullPath   string `json:"full_path"`
+}
+
+// File is the exported form of a db.File
+type File struct {
+	Kind        string `json:"kind"`
+	Category    string `json:"category"`
+	Inventory   string `json:"inventory"`
+	ArchiveDate string `json:"archive_date"`
+	Checksum    string `json:"checksum"`
+	Filesize    int64  `json:"filesize"`
+	FullPath    string `json:"full_path"`
+	PublicPath  string `json:"public_path"`
+	PublicID    string `json:"public_id,omitempty"`
+}
+
+// Note is the exported form of a db.Note
+type Note struct {
+	Kind      string    `json:"kind"`
+	PublicID  string    `json:"public_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UpdatedBy string    `json:"updated_by"`
+	Body      string    `json:"body"`
+}
+
+// Tag is the exported form of a db.Tag
+type Tag struct {
+	Kind      string    `json:"kind"`
+	PublicID  string    `json:"public_id"`
+	Tag       string    `json:"tag"`
+	CreatedAt time.Time `json:"created_at"`
+	Author    string    `json:"author"`
+}
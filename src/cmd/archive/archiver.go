@@ -24,21 +24,46 @@ type Archiver struct {
 	dbh  *db.Database
 }
 
+// refresh switches to a rebuilt catalog if one has been swapped in
+func (a *Archiver) refresh() {
+	var swapped, err = a.dbh.Refresh()
+	if err != nil {
+		logger.Errorf("Unable to check for a swapped database: %s", err)
+	}
+	if swapped {
+		logger.Infof("Database was swapped; now using %q", a.dbh.File())
+	}
+}
+
 // RunPendingArchiveJobs grabs the longest-waiting job and processes it
 func (a *Archiver) RunPendingArchiveJobs() {
 	logger.Debugf("Scanning for pending archive jobs")
-	var pending = true
-	for pending {
-		pending = false
-		var err = a.dbh.Operation().ProcessArchiveJob(func(j *db.ArchiveJob) bool {
-			pending = true
-			return a.processArchiveJob(j)
-		})
-
+	for {
+		var j, err = a.dbh.Operation().NextArchiveJob()
 		if err != nil {
 			logger.Errorf("Unable to get next job: %s", err)
 			return
 		}
+		if j == nil {
+			return
+		}
+
+		var started = time.Now()
+		var jobErr = a.processArchiveJob(j)
+		if jobErr != nil {
+			logger.Errorf("Job %d failed (attempt %d): %s", j.ID, j.Attempts+1, jobErr)
+		}
+
+		// A rebuilt catalog may have been swapped in while we were building the
+		// archive, and the result has to be recorded there
+		a.refresh()
+		err = a.dbh.InTransaction(func(op *db.Operation) error {
+			return op.FinishArchiveJob(j, started, jobErr)
+		})
+		if err != nil {
+			logger.Errorf("Unable to record job %d's result: %s", j.ID, err)
+			return
+		}
 	}
 }
 
@@ -85,15 +110,38 @@ func (a *Archiver) CleanOldArchives() {
 	}
 }
 
-func (a *Archiver) processArchiveJob(j *db.ArchiveJob) bool {
+func (a *Archiver) processArchiveJob(j *db.ArchiveJob) error {
 	logger.Infof("Processing archive job %d", j.ID)
 
-	var tempFile, err = fileutil.TempFile(a.conf.ArchiveOutputLocation, ".wip-", ".tar")
-	var tempName = tempFile.Name()
+	var op = a.dbh.Operation()
+	var files, err = op.GetJobFiles(j)
+	if err != nil {
+		return fmt.Errorf("unable to read job files: %s", err)
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("job has no files which still exist in the catalog")
+	}
+
+	// Restrictions may have been added since the job was queued
+	var allowed []*db.File
+	allowed, err = op.GetDeliverableJobFiles(j, time.Now())
+	if err != nil {
+		return fmt.Errorf("unable to read access restrictions: %s", err)
+	}
+	if len(allowed) < len(files) {
+		logger.Warnf("Job %d: skipping %d file(s) which %q may not access", j.ID, len(files)-len(allowed), j.RequestedBy)
+	}
+	if len(allowed) == 0 {
+		return fmt.Errorf("job has no files which the requester may access")
+	}
+	files = allowed
+
+	var tempFile *os.File
+	tempFile, err = fileutil.TempFile(a.conf.ArchiveOutputLocation, ".wip-", ".tar")
 	if err != nil {
-		logger.Errorf("Unable to create temp archive: %s", err)
-		return false
+		return fmt.Errorf("unable to create temp archive: %s", err)
 	}
+	var tempName = tempFile.Name()
 
 	// Most failures are before the rename, so this helps reduce chances of
 	// leaving orphaned files around
@@ -102,36 +150,32 @@ func (a *Archiver) processArchiveJob(j *db.ArchiveJob) bool {
 	var tw = tar.NewWriter(tempFile)
 
 	logger.Debugf("Adding files to archive")
-	for _, fname := range j.FileList() {
-		var p = filepath.Join(a.conf.DARoot, fname)
-		var fn = strings.Replace(fname, string(os.PathSeparator), "__", -1)
+	for _, f := range files {
+		var p = filepath.Join(a.conf.DARoot, f.FullPath)
+		var fn = strings.Replace(f.FullPath, string(os.PathSeparator), "__", -1)
 		err = addFileToTar(tw, p, fn)
 		if err != nil {
-			logger.Errorf("Unable to add %q to archive: %s", fname, err)
-			return false
+			return fmt.Errorf("unable to add %q to archive: %s", f.FullPath, err)
 		}
 	}
 
 	logger.Debugf("Closing archive")
 	err = tw.Close()
 	if err != nil {
-		logger.Errorf("Error closing tar stream %q: %s", tempName, err)
-		return false
+		return fmt.Errorf("error closing tar stream %q: %s", tempName, err)
 	}
 
 	logger.Debugf("Closing tempfile")
 	err = tempFile.Close()
 	if err != nil {
-		logger.Errorf("Error closing %q: %s", tempName, err)
-		return false
+		return fmt.Errorf("error closing %q: %s", tempName, err)
 	}
 
 	logger.Debugf("Generating new unique filename")
 	var newName string
 	newName, err = fileutil.TempNamedFile(a.conf.ArchiveOutputLocation, "archive-", ".tar")
 	if err != nil {
-		logger.Errorf("Unable to create second temp archive: %s", err)
-		return false
+		return fmt.Errorf("unable to create second temp archive: %s", err)
 	}
 	os.Remove(newName)
 
@@ -142,18 +186,17 @@ func (a *Archiver) processArchiveJob(j *db.ArchiveJob) bool {
 	err = a.notify(to, archiveDownloadURL.String())
 	if err != nil {
 		logger.Criticalf("Unable to notify %q of archive %q being ready: %s", to, archiveDownloadURL, err)
-		return false
+		return fmt.Errorf("unable to send notification email: %s", err)
 	}
 
 	logger.Debugf("Renaming file (via os.Link)")
 	err = os.Link(tempName, newName)
 	if err != nil {
-		logger.Errorf("Error linking %q to %q: %s", tempName, newName, err)
-		return false
+		return fmt.Errorf("error linking %q to %q: %s", tempName, newName, err)
 	}
 
 	logger.Infof("Job %d completed successfully", j.ID)
-	return true
+	return nil
 }
 
 func addFileToTar(tw *tar.Writer, filePath, flatname string) error {
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uoregon-libraries/headlamp/src/config"
+	"github.com/uoregon-libraries/headlamp/src/db"
+	"github.com/uoregon-libraries/headlamp/src/indexer"
+)
+
+// problem describes a single inconsistency and, if it can be fixed, how
+type problem struct {
+	desc   string
+	repair func(*repairer) error
+}
+
+// checker runs all consistency checks against a single operation
+type checker struct {
+	op       *db.Operation
+	problems []*problem
+}
+
+func (c *checker) add(repair func(*repairer) error, format string, args ...interface{}) {
+	c.problems = append(c.problems, &problem{desc: fmt.Sprintf(format, args...), repair: repair})
+}
+
+// run executes all checks in the order their repairs must happen: a file
+// can't be given a proper folder until its category is fixed, and a folder's
+// children can't be fixed until it has been.  The first check which fails
+// stops the run, since its problems may be incomplete.
+func (c *checker) run() error {
+	var checks = []func() error{
+		c.checkFileCategories,
+		c.checkFolderCategories,
+		c.checkFolders,
+		c.checkFiles,
+		c.checkRealFolders,
+		c.checkInventories,
+		c.checkPublicIDs,
+		c.checkAggregates,
+	}
+	for _, check := range checks {
+		var err = check()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkFileCategories finds files whose category doesn't exist
+func (c *checker) checkFileCategories() error {
+	var rows = c.op.Operation.Query(`
+		SELECT f.id, f.category_id, f.full_path FROM files f
+		LEFT JOIN categories c ON c.id = f.category_id
+		WHERE c.id IS NULL`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var catID int
+		var fullPath string
+		rows.Scan(&id, &catID, &fullPath)
+		var fix = func(r *repairer) error {
+			var _, err = r.fixFileCategory(id, fullPath)
+			return err
+		}
+		c.add(fix, "file %d (%q) refers to nonexistent category %d", id, fullPath, catID)
+	}
+	return c.op.Operation.Err()
+}
+
+// checkFolderCategories finds folders whose category doesn't exist.  We have
+// no way to know what category they should be in, so these can't be repaired.
+func (c *checker) checkFolderCategories() error {
+	var rows = c.op.Operation.Query(`
+		SELECT d.id, d.category_id, d.public_path FROM folders d
+		LEFT JOIN categories c ON c.id = d.category_id
+		WHERE c.id IS NULL`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, catID int
+		var publicPath string
+		rows.Scan(&id, &catID, &publicPath)
+		c.add(nil, "folder %d (%q) refers to nonexistent category %d", id, publicPath, catID)
+	}
+	return c.op.Operation.Err()
+}
+
+// checkFolders finds folders whose parent is missing, is in a different
+// category, or has a path which doesn't match the folder's path.  Results
+// are ordered by depth so parents are repaired before their children.
+func (c *checker) checkFolders() error {
+	var rows = c.op.Operation.Query(`
+		SELECT d.id, d.category_id, d.folder_id, d.public_path,
+			COALESCE(p.id, 0), COALESCE(p.category_id, 0), COALESCE(p.public_path, '')
+		FROM folders d
+		JOIN categories c ON c.id = d.category_id
+		LEFT JOIN folders p ON p.id = d.folder_id
+		WHERE (d.folder_id = 0 AND instr(d.public_path, '/') > 0)
+			OR (d.folder_id <> 0 AND (p.id IS NULL OR p.category_id <> d.category_id
+				OR p.public_path || '/' || d.name <> d.public_path))
+		ORDER BY d.depth`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, catID, parentID, pID, pCatID int
+		var publicPath, pPath string
+		rows.Scan(&id, &catID, &parentID, &publicPath, &pID, &pCatID, &pPath)
+
+		var fix = func(r *repairer) error { return r.fixFolderParent(id, catID, publicPath) }
+		switch {
+		case parentID == 0:
+			c.add(fix, "folder %d (%q) has no parent, but its path says it should", id, publicPath)
+		case pID == 0:
+			c.add(fix, "folder %d (%q) is orphaned: parent folder %d does not exist", id, publicPath, parentID)
+		case pCatID != catID:
+			c.add(fix, "folder %d (%q) is in category %d, but its parent folder %d is in category %d",
+				id, publicPath, catID, pID, pCatID)
+		default:
+			c.add(fix, "folder %d (%q) has parent folder %d (%q), which doesn't match its path",
+				id, publicPath, pID, pPath)
+		}
+	}
+	return c.op.Operation.Err()
+}
+
+// checkFiles finds files whose folder is missing, is in a different category,
+// or has a path which doesn't match the file's path
+func (c *checker) checkFiles() error {
+	var rows = c.op.Operation.Query(`
+		SELECT f.id, f.category_id, f.folder_id, f.public_path, f.full_path,
+			COALESCE(d.id, 0), COALESCE(d.category_id, 0), COALESCE(d.public_path, '')
+		FROM files f
+		JOIN categories c ON c.id = f.category_id
+		LEFT JOIN folders d ON d.id = f.folder_id
+		WHERE (f.folder_id = 0 AND instr(f.public_path, '/') > 0)
+			OR (f.folder_id <> 0 AND (d.id IS NULL OR d.category_id <> f.category_id
+				OR d.public_path || '/' || f.name <> f.public_path))`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var catID, folderID, dID, dCatID int
+		var publicPath, fullPath, dPath string
+		rows.Scan(&id, &catID, &folderID, &publicPath, &fullPath, &dID, &dCatID, &dPath)
+
+		var fix = func(r *repairer) error { return r.fixFileFolder(id, catID, publicPath) }
+		switch {
+		case folderID == 0:
+			c.add(fix, "file %d (%q) has no folder, but its path says it should", id, publicPath)
+		case dID == 0:
+			c.add(fix, "file %d (%q) is orphaned: folder %d does not exist", id, publicPath, folderID)
+		case dCatID != catID:
+			// We can't know which record has the wrong category, so the file's full
+			// path decides
+			fix = func(r *repairer) error {
+				var c, err = r.fixFileCategory(id, fullPath)
+				if err != nil {
+					return err
+				}
+				return r.fixFileFolder(id, c.ID, publicPath)
+			}
+			c.add(fix, "file %d (%q) is in category %d, but its folder %d is in category %d",
+				id, publicPath, catID, dID, dCatID)
+		default:
+			c.add(fix, "file %d (%q) has folder %d (%q), which doesn't match its path",
+				id, publicPath, dID, dPath)
+		}
+	}
+	return c.op.Operation.Err()
+}
+
+// checkRealFolders finds real folders which don't point to a public folder
+func (c *checker) checkRealFolders() error {
+	var rows = c.op.Operation.Query(`
+		SELECT r.id, r.folder_id, r.full_path FROM real_folders r
+		LEFT JOIN folders d ON d.id = r.folder_id
+		WHERE d.id IS NULL`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, folderID int
+		var fullPath string
+		rows.Scan(&id, &folderID, &fullPath)
+		c.add(func(r *repairer) error { return r.fixRealFolder(id, fullPath) },
+			"real folder %d (%q) refers to nonexistent folder %d", id, fullPath, folderID)
+	}
+	return c.op.Operation.Err()
+}
+
+// checkInventories finds inventory ids which files refer to, but which don't
+// exist in the inventories table
+func (c *checker) checkInventories() error {
+	var rows = c.op.Operation.Query(`
+		SELECT f.inventory_id, COUNT(*) FROM files f
+		LEFT JOIN inventories i ON i.id = f.inventory_id
+		WHERE i.id IS NULL
+		GROUP BY f.inventory_id`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, count int
+		rows.Scan(&id, &count)
+		c.add(func(r *repairer) error { return r.fixInventory(id) },
+			"%d file(s) refer to nonexistent inventory %d", count, id)
+	}
+	return c.op.Operation.Err()
+}
+
+// checkPublicIDs finds files and folders which haven't been assigned public
+// ids.  The indexer assigns these when it starts, so this should only happen
+// if the indexer hasn't run since the public id migration.
+func (c *checker) checkPublicIDs() error {
+	for _, table := range []string{"files", "folders"} {
+		var n int
+		var rows = c.op.Operation.Query(`SELECT COUNT(*) FROM ` + table + ` WHERE public_id = ''`)
+		if rows.Next() {
+			rows.Scan(&n)
+		}
+		rows.Close()
+		if n > 0 {
+			var fix = func(r *repairer) error {
+				var _, err = r.op.AssignPublicIDs()
+				return err
+			}
+			c.add(fix, "%d %s have no public id", n, table)
+		}
+	}
+	return c.op.Operation.Err()
+}
+
+// checkAggregates finds folders and categories whose stored file totals are
+// out of date.  This runs last so that recomputing the totals happens after
+// any other repairs have moved files around.
+func (c *checker) checkAggregates() error {
+	var folders, categories, err = c.op.StaleAggregates()
+	if err != nil {
+		return fmt.Errorf("unable to check file totals: %s", err)
+	}
+	if folders > 0 || categories > 0 {
+		c.add(func(r *repairer) error { return r.op.RecomputeAggregates() },
+			"%d folder(s) and %d category(ies) have out-of-date file totals", folders, categories)
+	}
+	return nil
+}
+
+// repairer holds the configuration and caches needed to fix problems
+type repairer struct {
+	op   *db.Operation
+	conf *config.Config
+}
+
+// folder returns the folder at the given path in the given category,
+// creating it and any missing ancestors
+func (r *repairer) folder(c *db.Category, publicPath string) (*db.Folder, error) {
+	var parent *db.Folder
+	var curPath string
+	for _, part := range strings.Split(publicPath, string(os.PathSeparator)) {
+		curPath = filepath.Join(curPath, part)
+		var f, err = r.op.FindOrCreateFolder(c, parent, curPath)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't build folder %q: %s", curPath, err)
+		}
+		parent = f
+	}
+	return parent, nil
+}
+
+// parent returns the folder which should contain the given path, or nil if
+// the path is top-level
+func (r *repairer) parent(catID int, publicPath string) (*db.Folder, error) {
+	var dir = filepath.Dir(publicPath)
+	if dir == "." {
+		return nil, nil
+	}
+
+	// Folders' public ids are derived from their category's name, so we need
+	// the real category, not just its id
+	var c, err = r.op.FindCategoryByID(catID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, fmt.Errorf("category %d doesn't exist", catID)
+	}
+	return r.folder(c, dir)
+}
+
+// fixFileCategory re-derives the file's category from its full path,
+// returning the category the file now belongs to
+func (r *repairer) fixFileCategory(id uint64, fullPath string) (*db.Category, error) {
+	var catName, _, _, err = indexer.ParsePath(fullPath, r.conf.PathFormat)
+	if err != nil {
+		return nil, err
+	}
+	var c *db.Category
+	c, err = r.op.FindOrCreateCategory(catName)
+	if err != nil {
+		return nil, err
+	}
+	r.op.Operation.Exec("UPDATE files SET category_id = ? WHERE id = ?", c.ID, id)
+	return c, r.op.Operation.Err()
+}
+
+func (r *repairer) fixFolderParent(id, catID int, publicPath string) error {
+	var p, err = r.parent(catID, publicPath)
+	if err != nil {
+		return err
+	}
+	var pid int
+	if p != nil {
+		pid = p.ID
+	}
+	r.op.Operation.Exec("UPDATE folders SET folder_id = ? WHERE id = ?", pid, id)
+	return r.op.Operation.Err()
+}
+
+func (r *repairer) fixFileFolder(id uint64, catID int, publicPath string) error {
+	var p, err = r.parent(catID, publicPath)
+	if err != nil {
+		return err
+	}
+	var pid int
+	if p != nil {
+		pid = p.ID
+	}
+	r.op.Operation.Exec("UPDATE files SET folder_id = ? WHERE id = ?", pid, id)
+	return r.op.Operation.Err()
+}
+
+// fixRealFolder re-derives the public folder from the real folder's path.  If
+// that public folder already has this real folder, the orphan is removed.
+func (r *repairer) fixRealFolder(id int, fullPath string) error {
+	var catName, _, publicPath, err = indexer.ParsePath(fullPath, r.conf.PathFormat)
+	if err != nil {
+		return err
+	}
+	var c *db.Category
+	c, err = r.op.FindOrCreateCategory(catName)
+	if err != nil {
+		return err
+	}
+	var f *db.Folder
+	f, err = r.folder(c, publicPath)
+	if err != nil {
+		return err
+	}
+
+	var existing *db.RealFolder
+	existing, err = r.op.FindRealFolderByPath(f, fullPath)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		r.op.Operation.Exec("DELETE FROM real_folders WHERE id = ?", id)
+	} else {
+		r.op.Operation.Exec("UPDATE real_folders SET folder_id = ? WHERE id = ?", f.ID, id)
+	}
+	return r.op.Operation.Err()
+}
+
+// fixInventory creates a placeholder for the missing inventory.  Its real
+// path is unknowable, but the placeholder keeps the files' provenance visible
+// rather than silently dropping them.
+func (r *repairer) fixInventory(id int) error {
+	var path = fmt.Sprintf("(missing inventory %d)", id)
+	r.op.Operation.Exec("INSERT INTO inventories (id, path) VALUES (?, ?)", id, path)
+	return r.op.Operation.Err()
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s [--repair] <settings file>", os.Args[0])
+	perr("")
+	perr(`Scans the database for inconsistencies: orphaned files, folders, and
+		real folders; folders whose parent doesn't match their path; files and
+		folders which disagree about their category; and files whose inventory is
+		missing.  With --repair, all fixable problems are corrected in a single
+		transaction.`)
+
+	os.Exit(status)
+}
+
+func getCLI() (conf *config.Config, repair bool) {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--repair":
+			repair = true
+		case "-h", "--help":
+			usage("")
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	if len(args) < 1 {
+		usage("You must specify a settings file")
+	}
+	if len(args) > 1 {
+		usage("Too many arguments")
+	}
+
+	var err error
+	conf, err = config.Read(args[0])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	return conf, repair
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func main() {
+	var conf, repair = getCLI()
+	var dbh = db.New()
+
+	var c = &checker{op: dbh.Operation()}
+	var err = c.run()
+	if err != nil {
+		logger.Fatalf("Unable to check database: %s", err)
+	}
+
+	var unfixable int
+	for _, p := range c.problems {
+		fmt.Println(p.desc)
+		if p.repair == nil {
+			unfixable++
+		}
+	}
+	if len(c.problems) == 0 {
+		logger.Infof("No problems found")
+		return
+	}
+	logger.Warnf("Found %d problem(s), %d of which cannot be repaired automatically", len(c.problems), unfixable)
+
+	if !repair {
+		os.Exit(1)
+	}
+
+	err = dbh.InTransaction(func(op *db.Operation) error {
+		var r = &repairer{op: op, conf: conf}
+		for _, p := range c.problems {
+			if p.repair == nil {
+				continue
+			}
+			var err = p.repair(r)
+			if err != nil {
+				return fmt.Errorf("unable to repair %s: %s", p.desc, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Fatalf("Repair failed; no changes were made: %s", err)
+	}
+
+	logger.Infof("Repaired %d problem(s)", len(c.problems)-unfixable)
+	if unfixable > 0 {
+		os.Exit(1)
+	}
+}
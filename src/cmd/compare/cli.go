@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s [options] <settings file> <directory or manifest> [output file]", os.Args[0])
+	perr("")
+	perr(`Compares local files against the catalog before a transfer, reporting
+		which are already archived, which are new, and which have the same path
+		as an archived file but different content.  Every file in a directory is
+		hashed; a manifest may be sha256sum output or a BagIt
+		manifest-sha256.txt.  The report is written as JSON to the output file,
+		or to standard output if no output file is given.`)
+	perr("")
+	perr("Options:")
+	perr("")
+	perr(`--category=NAME: compare paths only against this category; without it,
+		paths are compared in every category.  Content is always looked for in
+		every category.`)
+	perr("")
+	perr(`--folder=PATH: the folder, within the category, where the local files
+		would go, e.g., --folder=FILES/photos`)
+
+	os.Exit(status)
+}
+
+// options holds what was read from the command line
+type options struct {
+	category string
+	folder   string
+	source   string
+	outfile  string
+}
+
+func getCLI() *options {
+	var opts = &options{}
+	var args []string
+	for _, arg := range os.Args[1:] {
+		if arg == "-h" || arg == "--help" {
+			usage("")
+		}
+		if !strings.HasPrefix(arg, "--") {
+			args = append(args, arg)
+			continue
+		}
+
+		var parts = strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			usage(fmt.Sprintf("Invalid option %q", arg))
+		}
+		switch parts[0] {
+		case "category":
+			opts.category = parts[1]
+		case "folder":
+			opts.folder = strings.Trim(parts[1], "/")
+		default:
+			usage(fmt.Sprintf("Unknown option %q", arg))
+		}
+	}
+
+	if len(args) < 1 {
+		usage("You must specify a settings file")
+	}
+	if len(args) < 2 {
+		usage("You must specify a directory or manifest to compare")
+	}
+	if len(args) > 3 {
+		usage("Too many arguments")
+	}
+
+	var _, err = config.Read(args[0])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	opts.source = args[1]
+	if len(args) == 3 {
+		opts.outfile = args[2]
+	}
+	return opts
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/compare"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func main() {
+	var opts = getCLI()
+
+	var entries, err = compare.Read(opts.source)
+	if err != nil {
+		logger.Fatalf("Unable to read %q: %s", opts.source, err)
+	}
+
+	var op = db.NewReadOnly().Operation()
+	var c *db.Category
+	if opts.category != "" {
+		c, err = op.FindCategoryByName(opts.category)
+		if err != nil {
+			logger.Fatalf("Unable to read category %q: %s", opts.category, err)
+		}
+		if c == nil {
+			logger.Fatalf("Category %q doesn't exist", opts.category)
+		}
+	}
+
+	var rpt *compare.Report
+	rpt, err = compare.Compare(op, entries, c, opts.folder, nil)
+	if err != nil {
+		logger.Fatalf("Unable to compare files against the catalog: %s", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if opts.outfile != "" {
+		var f, err = os.Create(opts.outfile)
+		if err != nil {
+			logger.Fatalf("Unable to create %q: %s", opts.outfile, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var w = bufio.NewWriter(out)
+	err = rpt.WriteJSON(w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		logger.Fatalf("Unable to write the report: %s", err)
+	}
+
+	logger.Infof("Compared %d file(s): %d archived, %d archived at another path, %d changed, %d new",
+		len(rpt.Results), rpt.Counts[compare.StatusArchived], rpt.Counts[compare.StatusElsewhere],
+		rpt.Counts[compare.StatusChanged], rpt.Counts[compare.StatusNew])
+}
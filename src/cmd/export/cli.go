@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s [filters] <settings file> [output file]", os.Args[0])
+	perr("")
+	perr("Writes the catalog as JSON Lines to the output file, or to standard " +
+		"output if no output file is given.")
+	perr("")
+	perr(`Filters export only matching files, along with their notes and tags;
+		folders are rebuilt from the files' paths when the export is imported.
+		Each filter is given as --name=value, using the same names and values as
+		the search filters on the web site: --from and --to (archive dates),
+		--minsize and --maxsize (e.g., 10M), --ext, --format, --checksum, and
+		--inventory (a path or batch number).`)
+
+	os.Exit(status)
+}
+
+func getCLI() (*config.Config, string, db.Filters) {
+	var args []string
+	var filters db.Filters
+	for _, arg := range os.Args[1:] {
+		if arg == "-h" || arg == "--help" {
+			usage("")
+		}
+		if !strings.HasPrefix(arg, "--") {
+			args = append(args, arg)
+			continue
+		}
+
+		var parts = strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)
+		if len(parts) != 2 {
+			usage(fmt.Sprintf("Invalid option %q", arg))
+		}
+		var err = filters.Set(parts[0], parts[1])
+		if err != nil {
+			usage(fmt.Sprintf("Invalid option %q: %s", arg, err))
+		}
+	}
+
+	if len(args) < 1 {
+		usage("You must specify a settings file")
+	}
+	if len(args) > 2 {
+		usage("Too many arguments")
+	}
+
+	var c, err = config.Read(args[0])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	var outfile string
+	if len(args) == 2 {
+		outfile = args[1]
+	}
+	return c, outfile, filters
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/catalog"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func main() {
+	var _, outfile, filters = getCLI()
+
+	var out io.Writer = os.Stdout
+	if outfile != "" {
+		var f, err = os.Create(outfile)
+		if err != nil {
+			logger.Fatalf("Unable to create %q: %s", outfile, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	var w = bufio.NewWriter(out)
+	var err = catalog.Export(db.NewReadOnly(), w, filters)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		logger.Fatalf("Unable to export catalog: %s", err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s <settings file> [category [folder path]]", os.Args[0])
+	perr("")
+	perr(`Reads files from the dark archive and compares each one's SHA256 and
+		size to what its inventory recorded, storing a fixity check event for
+		each file.  A format identification event is also stored the first time
+		a file is checked, or if its format appears to have changed.`)
+	perr("")
+	perr(`With no category, every file in the catalog is checked.  A category
+		restricts the check to files in that category, and a folder path (as
+		shown when browsing) restricts it further to files within that folder.
+		The command exits non-zero if any file fails its check.`)
+
+	os.Exit(status)
+}
+
+func getCLI() (conf *config.Config, category, folderPath string) {
+	if len(os.Args) < 2 {
+		usage("You must specify a settings file")
+	}
+	if len(os.Args) > 4 {
+		usage("Too many arguments")
+	}
+
+	var err error
+	conf, err = config.Read(os.Args[1])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 2 {
+		category = os.Args[2]
+	}
+	if len(os.Args) > 3 {
+		folderPath = os.Args[3]
+	}
+	return conf, category, folderPath
+}
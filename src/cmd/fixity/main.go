@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/config"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// batchSize is how many files we check before storing their events
+const batchSize = 1000
+
+func main() {
+	var conf, cName, folderPath = getCLI()
+	var dbh = db.New()
+	var op = dbh.Operation()
+
+	var category *db.Category
+	var folder *db.Folder
+	var err error
+	if cName != "" {
+		category, err = op.FindCategoryByName(cName)
+		if err != nil {
+			logger.Fatalf("Unable to look up category %q: %s", cName, err)
+		}
+		if category == nil {
+			logger.Errorf("No category found with name %q", cName)
+			os.Exit(1)
+		}
+	}
+	if folderPath != "" {
+		folder, err = op.FindFolderByPath(category, folderPath)
+		if err != nil {
+			logger.Fatalf("Unable to look up folder %q: %s", folderPath, err)
+		}
+		if folder == nil {
+			logger.Errorf("No folder found with path %q in category %q", folderPath, cName)
+			os.Exit(1)
+		}
+	}
+
+	var checked, failed int
+	var lastID uint64
+	for {
+		var files []*db.File
+		files, err = op.FilesAfterID(category, folder, lastID, batchSize)
+		if err != nil {
+			logger.Fatalf("Unable to read files: %s", err)
+		}
+		if len(files) == 0 {
+			break
+		}
+		lastID = files[len(files)-1].ID
+
+		var events []*db.Event
+		for _, f := range files {
+			var fixity, format = checkFile(conf, op, f)
+			events = append(events, fixity)
+			if format != nil {
+				events = append(events, format)
+			}
+			checked++
+			if fixity.Outcome != db.EventSuccess {
+				failed++
+				logger.Errorf("Fixity check failed for %q: %s", f.FullPath, fixity.Detail)
+			}
+		}
+
+		err = dbh.InTransaction(func(op *db.Operation) error {
+			return op.WriteEvents(events...)
+		})
+		if err != nil {
+			logger.Fatalf("Unable to store events: %s", err)
+		}
+		logger.Infof("Checked %d file(s) so far", checked)
+	}
+
+	if failed > 0 {
+		logger.Errorf("%d of %d file(s) failed their fixity check", failed, checked)
+		os.Exit(1)
+	}
+	logger.Infof("All %d file(s) passed their fixity check", checked)
+}
+
+// checkFile reads f from the dark archive and returns a fixity check event,
+// and a format identification event if the file's format hasn't been
+// identified before or no longer matches what was identified
+func checkFile(conf *config.Config, op *db.Operation, f *db.File) (fixity, format *db.Event) {
+	var agent = db.SoftwareAgent("fixity")
+	fixity = db.NewFileEvent(db.EventFixityCheck, f, agent, db.AgentSoftware)
+
+	var fh, err = os.Open(filepath.Join(conf.DARoot, f.FullPath))
+	if err != nil {
+		fixity.Outcome = db.EventFailure
+		fixity.Detail = fmt.Sprintf("Unable to read file: %s", err)
+		return fixity, nil
+	}
+	defer fh.Close()
+
+	var buf [512]byte
+	var n, _ = io.ReadFull(fh, buf[:])
+	var mimeType = identifyFormat(f.Name, buf[:n])
+
+	var h = sha256.New()
+	h.Write(buf[:n])
+	var size int64
+	size, err = io.Copy(h, fh)
+	size += int64(n)
+	if err != nil {
+		fixity.Outcome = db.EventFailure
+		fixity.Detail = fmt.Sprintf("Unable to read file: %s", err)
+		return fixity, nil
+	}
+
+	var sum = hex.EncodeToString(h.Sum(nil))
+	switch {
+	case sum != f.Checksum:
+		fixity.Outcome = db.EventFailure
+		fixity.Detail = fmt.Sprintf("SHA256 mismatch: expected %s, got %s", f.Checksum, sum)
+	case size != f.Filesize:
+		fixity.Outcome = db.EventFailure
+		fixity.Detail = fmt.Sprintf("Size mismatch: expected %d, got %d", f.Filesize, size)
+	default:
+		fixity.Detail = "SHA256 and size match the inventory"
+	}
+
+	var last *db.Event
+	last, err = op.LatestFileEvent(f, db.EventFormatIdentification)
+	if err != nil {
+		logger.Errorf("Unable to read format history for %q: %s", f.FullPath, err)
+	}
+	if err == nil && (last == nil || last.Detail != mimeType) {
+		format = db.NewFileEvent(db.EventFormatIdentification, f, agent, db.AgentSoftware)
+		format.Detail = mimeType
+	}
+
+	return fixity, format
+}
+
+// identifyFormat returns the MIME type of a file based on its first few bytes,
+// falling back to its extension when the content isn't distinctive
+func identifyFormat(name string, head []byte) string {
+	var sniffed = http.DetectContentType(head)
+	if sniffed != "application/octet-stream" && sniffed != "text/plain; charset=utf-8" {
+		return sniffed
+	}
+
+	var byExt = mime.TypeByExtension(filepath.Ext(name))
+	if byExt != "" {
+		return byExt
+	}
+	return sniffed
+}
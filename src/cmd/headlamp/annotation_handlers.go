@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// annotations holds a file's or folder's notes and tags, and the configured
+// tags which could still be added
+type annotations struct {
+	PublicID  string
+	Notes     []*db.Note
+	Tags      []*db.Tag
+	OtherTags []string
+}
+
+// loadAnnotations reads the notes and tags for the given public id
+func loadAnnotations(op *db.Operation, pid string) (*annotations, error) {
+	var a = &annotations{PublicID: pid}
+	var err error
+	a.Notes, err = op.GetNotes(pid)
+	if err == nil {
+		a.Tags, err = op.GetTags(pid)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var seen = make(map[string]bool)
+	for _, t := range a.Tags {
+		seen[t.Tag] = true
+	}
+	for _, t := range conf.Tags {
+		if !seen[t] {
+			a.OtherTags = append(a.OtherTags, t)
+		}
+	}
+	return a, nil
+}
+
+// annotationsHandler changes a file's or folder's notes and tags.  Every
+// request must be a POST to one of these:
+//
+//	/annotations/<public id>/notes               add a note
+//	/annotations/<public id>/notes/<id>          change a note's text
+//	/annotations/<public id>/notes/<id>/delete   delete a note
+//	/annotations/<public id>/tags                add a tag
+//	/annotations/<public id>/tags/delete         remove a tag
+func annotationsHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if r.Method != http.MethodPost || len(parts) < 3 || len(parts) > 5 || parts[1] == "" {
+		_400(w, r, "Invalid request")
+		return
+	}
+
+	var pid, returnPath = findAnnotationTarget(w, r, parts[1])
+	if returnPath == "" {
+		return
+	}
+
+	var ok bool
+	switch strings.Join(parts[2:], "/") {
+	case "notes":
+		ok = addNote(w, r, pid)
+	case "tags":
+		ok = addTag(w, r, pid)
+	case "tags/delete":
+		ok = removeTag(w, r, pid)
+	default:
+		if parts[2] != "notes" || len(parts) == 5 && parts[4] != "delete" {
+			_400(w, r, "Invalid request")
+			return
+		}
+		var id, err = strconv.Atoi(parts[3])
+		if err != nil {
+			_400(w, r, "Invalid note id")
+			return
+		}
+		ok = changeNote(w, r, pid, id, len(parts) == 5)
+	}
+
+	if ok {
+		http.Redirect(w, r, returnPath, http.StatusSeeOther)
+	}
+}
+
+// findAnnotationTarget looks up the file or folder being annotated, returning
+// its current public id (pid may be an old one) and the path of the page to
+// send the user back to.  If the file or folder doesn't exist, or the user may
+// not see it, an error is written and empty strings are returned.
+func findAnnotationTarget(w http.ResponseWriter, r *http.Request, pid string) (string, string) {
+	var op = rdbh.Operation()
+	var restrictions, err = viewerRestrictions(r)
+	var file *db.File
+	var folder *db.Folder
+	if err == nil {
+		switch {
+		case strings.HasPrefix(pid, "f"):
+			file, err = op.FindFileByPublicID(pid)
+		case strings.HasPrefix(pid, "d"):
+			folder, err = op.FindFolderByPublicID(pid)
+		}
+	}
+	if err != nil {
+		logger.Errorf("Error trying to find annotation target %q: %s", pid, err)
+		_500(w, r, "Unable to read the specified file or folder.  Try again or contact support.")
+		return "", ""
+	}
+
+	switch {
+	case file != nil && !restrictions.HidesFile(file):
+		return file.PublicID, viewFileDetailsPath(file)
+	case folder != nil && folder.Category != nil && !restrictions.HidesFolder(folder):
+		return folder.PublicID, browseFolderPath(folder)
+	}
+
+	_404(w, r, "Unable to find the requested file or folder.  Try again or contact support.")
+	return "", ""
+}
+
+// noteBody returns the trimmed note text from the request, setting an alert
+// if there isn't any
+func noteBody(w http.ResponseWriter, r *http.Request) string {
+	var body = strings.TrimSpace(r.FormValue("body"))
+	if body == "" {
+		setAlert(w, r, "Notes can't be empty")
+	}
+	return body
+}
+
+func addNote(w http.ResponseWriter, r *http.Request, pid string) bool {
+	var body = noteBody(w, r)
+	if body == "" {
+		return true
+	}
+
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		var _, err = op.AddNote(pid, requestor(r), body)
+		return err
+	})
+	if err != nil {
+		logger.Errorf("Unable to add note to %q: %s", pid, err)
+		_500(w, r, "Error trying to save the note.  Try again or contact support.")
+		return false
+	}
+	setInfo(w, r, "Note added")
+	return true
+}
+
+func changeNote(w http.ResponseWriter, r *http.Request, pid string, id int, deleting bool) bool {
+	var n, err = rdbh.Operation().FindNoteByID(id)
+	if err != nil {
+		logger.Errorf("Unable to read note %d: %s", id, err)
+		_500(w, r, "Error trying to read the note.  Try again or contact support.")
+		return false
+	}
+	if n == nil || n.PublicID != pid {
+		_404(w, r, fmt.Sprintf("Note %d not found", id))
+		return false
+	}
+
+	if deleting {
+		err = dbh.InTransaction(func(op *db.Operation) error { return op.DeleteNote(n) })
+		if err == nil {
+			setInfo(w, r, "Note deleted")
+		}
+	} else {
+		var body = noteBody(w, r)
+		if body == "" {
+			return true
+		}
+		err = dbh.InTransaction(func(op *db.Operation) error { return op.UpdateNote(n, requestor(r), body) })
+		if err == nil {
+			setInfo(w, r, "Note updated")
+		}
+	}
+	if err != nil {
+		logger.Errorf("Unable to change note %d: %s", id, err)
+		_500(w, r, "Error trying to save the note.  Try again or contact support.")
+		return false
+	}
+	return true
+}
+
+func addTag(w http.ResponseWriter, r *http.Request, pid string) bool {
+	var tag = r.FormValue("tag")
+	if !conf.ValidTag(tag) {
+		_400(w, r, fmt.Sprintf("%q is not a valid tag", tag))
+		return false
+	}
+
+	var err = dbh.InTransaction(func(op *db.Operation) error { return op.AddTag(pid, tag, requestor(r)) })
+	if err != nil {
+		logger.Errorf("Unable to tag %q with %q: %s", pid, tag, err)
+		_500(w, r, "Error trying to add the tag.  Try again or contact support.")
+		return false
+	}
+	setInfo(w, r, fmt.Sprintf("Tagged %q", tag))
+	return true
+}
+
+func removeTag(w http.ResponseWriter, r *http.Request, pid string) bool {
+	var tag = r.FormValue("tag")
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		var _, err = op.RemoveTag(pid, tag)
+		return err
+	})
+	if err != nil {
+		logger.Errorf("Unable to remove tag %q from %q: %s", tag, pid, err)
+		_500(w, r, "Error trying to remove the tag.  Try again or contact support.")
+		return false
+	}
+	setInfo(w, r, fmt.Sprintf("Removed tag %q", tag))
+	return true
+}
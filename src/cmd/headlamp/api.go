@@ -0,0 +1,348 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"time"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// apiVersion is the path element every API URL starts with after "api/".  If
+// responses ever change in a way that would break existing scripts, the new
+// responses get a new version and the old one keeps working.
+const apiVersion = "v1"
+
+// defaultPageSize is how many items a list returns if the request doesn't
+// say; no request may ask for more than maxFiles
+const defaultPageSize = 100
+
+// Records the API sends.  Files and folders are always identified by their
+// public ids, which don't change when the catalog is rebuilt, never by
+// database ids.
+
+type apiCategory struct {
+	Name           string            `json:"name"`
+	FileCount      int               `json:"file_count"`
+	TotalBytes     int64             `json:"total_bytes"`
+	MinArchiveDate string            `json:"min_archive_date,omitempty"`
+	MaxArchiveDate string            `json:"max_archive_date,omitempty"`
+	Links          map[string]string `json:"links"`
+}
+
+type apiFolder struct {
+	ID             string            `json:"id"`
+	Category       string            `json:"category"`
+	Path           string            `json:"path"`
+	Name           string            `json:"name"`
+	FileCount      int               `json:"file_count"`
+	TotalBytes     int64             `json:"total_bytes"`
+	MinArchiveDate string            `json:"min_archive_date,omitempty"`
+	MaxArchiveDate string            `json:"max_archive_date,omitempty"`
+	Title          string            `json:"title,omitempty"`
+	Tags           []string          `json:"tags"`
+	Links          map[string]string `json:"links"`
+}
+
+type apiFile struct {
+	ID          string            `json:"id"`
+	Category    string            `json:"category"`
+	ArchiveDate string            `json:"archive_date"`
+	Path        string            `json:"path"`
+	Name        string            `json:"name"`
+	Filesize    int64             `json:"filesize"`
+	Checksum    string            `json:"checksum"`
+	Title       string            `json:"title,omitempty"`
+	Tags        []string          `json:"tags"`
+	Links       map[string]string `json:"links"`
+}
+
+// apiDetails is what a single file or folder's endpoint adds to the record
+// shown in lists
+type apiDetails struct {
+	Metadata []apiMetadata `json:"metadata"`
+	Notes    []apiNote     `json:"notes"`
+}
+
+type apiFolderDetails struct {
+	apiFolder
+	apiDetails
+}
+
+type apiFileDetails struct {
+	apiFile
+	apiDetails
+	Inventory string   `json:"inventory"`
+	Versions  []string `json:"versions"`
+}
+
+type apiMetadata struct {
+	Field string `json:"field"`
+	Value string `json:"value"`
+}
+
+type apiNote struct {
+	ID        int       `json:"id"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+}
+
+type apiRealFolder struct {
+	FullPath string `json:"full_path"`
+}
+
+type apiQueue struct {
+	Files      []string `json:"files"`
+	TotalBytes int64    `json:"total_bytes"`
+}
+
+type apiJob struct {
+	ID          int        `json:"id"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by,omitempty"`
+	Emails      []string   `json:"emails,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	Files       []string   `json:"files"`
+}
+
+// apiChecksum is the result of looking up one checksum: every visible file
+// with that content.  Label is the uploaded file's name, if there was one.
+type apiChecksum struct {
+	Checksum string    `json:"checksum"`
+	Label    string    `json:"label,omitempty"`
+	Files    []apiFile `json:"files"`
+}
+
+// apiCompletion is one autocomplete suggestion: a folder or file whose name
+// or path starts with what was typed
+type apiCompletion struct {
+	Type     string `json:"type"`
+	ID       string `json:"id"`
+	Category string `json:"category"`
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+}
+
+// apiList is a single page of a longer list.  Next is the URL of the next
+// page, or empty if this is the last one.
+type apiList struct {
+	Total  uint64      `json:"total"`
+	Offset uint64      `json:"offset"`
+	Limit  uint64      `json:"limit"`
+	Next   string      `json:"next,omitempty"`
+	Items  interface{} `json:"items"`
+}
+
+type apiErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// apiPath returns the URL for an API endpoint
+func apiPath(parts ...string) string {
+	return joinPaths(append([]string{"api", apiVersion}, parts...)...)
+}
+
+// sendJSON writes v to the response as JSON with the given status code
+func sendJSON(w http.ResponseWriter, status int, v interface{}) {
+	var data, err = json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logger.Errorf("Unable to encode API response: %s", err)
+		status = http.StatusInternalServerError
+		data = []byte(`{"error": "Unable to encode the response"}`)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+	w.Write([]byte("\n"))
+}
+
+// apiError sends an error message as JSON
+func apiError(w http.ResponseWriter, status int, msg string) {
+	sendJSON(w, status, apiErrorResponse{Error: msg})
+}
+
+// getPage reads the offset and limit from the request's query string
+func getPage(r *http.Request) (offset, limit uint64, err error) {
+	var q = r.URL.Query()
+	limit = defaultPageSize
+	if q.Get("offset") != "" {
+		offset, err = strconv.ParseUint(q.Get("offset"), 10, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid offset %q", q.Get("offset"))
+		}
+	}
+	if q.Get("limit") != "" {
+		limit, err = strconv.ParseUint(q.Get("limit"), 10, 64)
+		if err != nil || limit == 0 || limit > maxFiles {
+			return 0, 0, fmt.Errorf("invalid limit %q; limit must be from 1 to %d", q.Get("limit"), maxFiles)
+		}
+	}
+	return offset, limit, nil
+}
+
+// newAPIList wraps a page of items, linking to the next page if there is one
+func newAPIList(r *http.Request, items interface{}, total, offset, limit uint64) *apiList {
+	var l = &apiList{Total: total, Offset: offset, Limit: limit, Items: items}
+	if offset+limit < total {
+		var u = *r.URL
+		var q = u.Query()
+		q.Set("offset", strconv.FormatUint(offset+limit, 10))
+		q.Set("limit", strconv.FormatUint(limit, 10))
+		u.RawQuery = q.Encode()
+		l.Next = u.RequestURI()
+	}
+	return l
+}
+
+func newAPICategory(c *db.Category) apiCategory {
+	return apiCategory{
+		Name:           c.Name,
+		FileCount:      c.FileCount,
+		TotalBytes:     c.TotalBytes,
+		MinArchiveDate: c.MinArchiveDate,
+		MaxArchiveDate: c.MaxArchiveDate,
+		Links: map[string]string{
+			"self":    apiPath("categories", c.Name),
+			"folders": apiPath("categories", c.Name, "folders"),
+			"files":   apiPath("categories", c.Name, "files"),
+			"html":    browseCategoryPath(c),
+		},
+	}
+}
+
+func newAPIFolder(f *db.Folder, l *listing) apiFolder {
+	return apiFolder{
+		ID:             f.PublicID,
+		Category:       f.Category.Name,
+		Path:           sanitizePath(f.PublicPath),
+		Name:           f.Name,
+		FileCount:      f.FileCount,
+		TotalBytes:     f.TotalBytes,
+		MinArchiveDate: f.MinArchiveDate,
+		MaxArchiveDate: f.MaxArchiveDate,
+		Title:          l.Titles[f.PublicID],
+		Tags:           apiTags(l, f.PublicID),
+		Links: map[string]string{
+			"self":         apiPath("folders", f.PublicID),
+			"folders":      apiPath("folders", f.PublicID, "folders"),
+			"files":        apiPath("folders", f.PublicID, "files"),
+			"real_folders": apiPath("folders", f.PublicID, "real-folders"),
+			"html":         browseFolderPath(f),
+			"premis":       folderPREMISPath(f),
+		},
+	}
+}
+
+func newAPIFile(f *db.File, l *listing) apiFile {
+	return apiFile{
+		ID:          f.PublicID,
+		Category:    f.Category.Name,
+		ArchiveDate: f.ArchiveDate,
+		Path:        sanitizePath(f.PublicPath),
+		Name:        f.Name,
+		Filesize:    f.Filesize,
+		Checksum:    f.Checksum,
+		Title:       l.Titles[f.PublicID],
+		Tags:        apiTags(l, f.PublicID),
+		Links: map[string]string{
+			"self":     apiPath("files", f.PublicID),
+			"view":     viewFilePath(f),
+			"download": downloadFilePath(f),
+			"html":     viewFileDetailsPath(f),
+			"premis":   filePREMISPath(f),
+		},
+	}
+}
+
+// apiTags returns the tags for a public id, never nil, so lists always have
+// a "tags" array even when it's empty
+func apiTags(l *listing, pid string) []string {
+	var tags = l.Tags[pid]
+	if tags == nil {
+		tags = []string{}
+	}
+	return tags
+}
+
+func newAPIFolders(folders []*db.Folder, l *listing) []apiFolder {
+	var list = make([]apiFolder, len(folders))
+	for i, f := range folders {
+		list[i] = newAPIFolder(f, l)
+	}
+	return list
+}
+
+func newAPIFiles(files []*db.File, l *listing) []apiFile {
+	var list = make([]apiFile, len(files))
+	for i, f := range files {
+		list[i] = newAPIFile(f, l)
+	}
+	return list
+}
+
+// loadAPIDetails reads a file's or folder's metadata and notes
+func loadAPIDetails(op *db.Operation, pid string) (apiDetails, error) {
+	var d = apiDetails{Metadata: []apiMetadata{}, Notes: []apiNote{}}
+	var meta, err = op.GetMetadata(pid)
+	if err != nil {
+		return d, err
+	}
+	for _, m := range meta {
+		d.Metadata = append(d.Metadata, apiMetadata{Field: m.Field, Value: m.Value})
+	}
+
+	var notes []*db.Note
+	notes, err = op.GetNotes(pid)
+	for _, n := range notes {
+		d.Notes = append(d.Notes, apiNote{
+			ID:        n.ID,
+			Author:    n.Author,
+			CreatedAt: n.CreatedAt,
+			UpdatedBy: n.UpdatedBy,
+			UpdatedAt: n.UpdatedAt,
+			Body:      n.Body,
+		})
+	}
+	return d, err
+}
+
+// newAPIJob describes an archive job.  Who requested it and who is notified
+// are only given to its requestor.
+func newAPIJob(j *db.ArchiveJob, files []*db.File, viewer string) apiJob {
+	var aj = apiJob{
+		ID:        j.ID,
+		Status:    j.Status,
+		CreatedAt: j.CreatedAt,
+		Attempts:  j.Attempts,
+		LastError: j.LastError,
+		Files:     []string{},
+	}
+
+	if j.RequestedBy == viewer {
+		aj.RequestedBy = j.RequestedBy
+
+		// Scripts want plain addresses, not the display form j.Emails() gives
+		var addrs, _ = mail.ParseAddressList(j.NotificationEmails)
+		for _, a := range addrs {
+			aj.Emails = append(aj.Emails, a.Address)
+		}
+	}
+	if !j.CompletedAt.IsZero() {
+		aj.CompletedAt = &j.CompletedAt
+	}
+	for _, f := range files {
+		aj.Files = append(aj.Files, f.PublicID)
+	}
+	return aj
+}
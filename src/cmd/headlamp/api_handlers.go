@@ -0,0 +1,765 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// apiRequest holds what every API endpoint needs: the database operation,
+// what the requestor may not see, and the browse options, along with the id
+// taken from the URL, if any
+type apiRequest struct {
+	w            http.ResponseWriter
+	r            *http.Request
+	op           *db.Operation
+	restrictions *db.Restrictions
+	opts         browseOptions
+	id           string
+}
+
+// apiRoute ties a method and path pattern to an endpoint.  A pattern element
+// of "{id}" matches any one path element and stores it in the apiRequest.
+type apiRoute struct {
+	method  string
+	pattern string
+	handler func(*apiRequest)
+}
+
+// apiRoutes lists every endpoint; static/api/openapi.yaml documents them
+var apiRoutes = []apiRoute{
+	{http.MethodGet, "categories", (*apiRequest).listCategories},
+	{http.MethodGet, "categories/{id}", (*apiRequest).getCategory},
+	{http.MethodGet, "categories/{id}/folders", (*apiRequest).listCategoryFolders},
+	{http.MethodGet, "categories/{id}/files", (*apiRequest).listCategoryFiles},
+	{http.MethodGet, "folders", (*apiRequest).findFolder},
+	{http.MethodGet, "folders/{id}", (*apiRequest).getFolder},
+	{http.MethodGet, "folders/{id}/folders", (*apiRequest).listFolderFolders},
+	{http.MethodGet, "folders/{id}/files", (*apiRequest).listFolderFiles},
+	{http.MethodGet, "folders/{id}/real-folders", (*apiRequest).listRealFolders},
+	{http.MethodGet, "files/{id}", (*apiRequest).getFile},
+	{http.MethodGet, "search/folders", (*apiRequest).searchFolders},
+	{http.MethodGet, "search/files", (*apiRequest).searchFiles},
+	{http.MethodGet, "autocomplete", (*apiRequest).autocomplete},
+	{http.MethodGet, "queue", (*apiRequest).getQueue},
+	{http.MethodPost, "queue", (*apiRequest).changeQueue},
+	{http.MethodDelete, "queue", (*apiRequest).emptyQueue},
+	{http.MethodPost, "jobs", (*apiRequest).createJob},
+	{http.MethodGet, "jobs/{id}", (*apiRequest).getJob},
+	{http.MethodPost, "checksums", (*apiRequest).lookupChecksums},
+	{http.MethodGet, "checksums/{id}", (*apiRequest).getChecksum},
+}
+
+// match returns true if the path elements fit the route's pattern, along
+// with the "{id}" element, if the pattern has one
+func (rt apiRoute) match(parts []string) (bool, string) {
+	var pattern = strings.Split(rt.pattern, "/")
+	if len(pattern) != len(parts) {
+		return false, ""
+	}
+
+	var id string
+	for i, p := range pattern {
+		switch {
+		case p == "{id}" && parts[i] != "":
+			id = parts[i]
+		case p != parts[i]:
+			return false, ""
+		}
+	}
+	return true, id
+}
+
+// apiHandler serves the JSON API at /api/v1/...
+func apiHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) < 3 || parts[1] != apiVersion {
+		apiError(w, http.StatusNotFound, "Unknown API version")
+		return
+	}
+	parts = parts[2:]
+	if len(parts) > 1 && parts[len(parts)-1] == "" {
+		parts = parts[:len(parts)-1]
+	}
+
+	var found bool
+	for _, rt := range apiRoutes {
+		var ok, id = rt.match(parts)
+		if !ok {
+			continue
+		}
+		found = true
+		if rt.method != r.Method {
+			continue
+		}
+
+		var ar = newAPIRequest(w, r)
+		if ar != nil {
+			ar.id = id
+			rt.handler(ar)
+		}
+		return
+	}
+
+	if found {
+		apiError(w, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed here", r.Method))
+		return
+	}
+	apiError(w, http.StatusNotFound, "Unknown API endpoint")
+}
+
+// newAPIRequest reads the request's browse options and restrictions.  If
+// anything goes wrong, the error is sent and nil is returned.
+func newAPIRequest(w http.ResponseWriter, r *http.Request) *apiRequest {
+	var ar = &apiRequest{w: w, r: r, op: rdbh.Operation()}
+	var err error
+	ar.opts, err = getBrowseOptions(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, fmt.Sprintf("Unable to read the requested options: %s", err))
+		return nil
+	}
+
+	ar.restrictions, err = viewerRestrictions(r)
+	if err != nil {
+		ar.serverError("Unable to read restrictions", err)
+		return nil
+	}
+	return ar
+}
+
+// filter returns the db.FileFilter for what the requestor asked to see and is
+// allowed to see
+func (ar *apiRequest) filter() db.FileFilter {
+	return db.FileFilter{AsOf: ar.opts.AsOf, Restrictions: ar.restrictions, Filters: ar.opts.Filters}
+}
+
+// serverError logs err and sends a generic error
+func (ar *apiRequest) serverError(msg string, err error) {
+	logger.Errorf("API error: %s: %s", msg, err)
+	apiError(ar.w, http.StatusInternalServerError, msg+".  Try again or contact support.")
+}
+
+// readBody decodes the request's JSON body into v, sending an error and
+// returning false if it can't
+func (ar *apiRequest) readBody(v interface{}) bool {
+	var err = json.NewDecoder(ar.r.Body).Decode(v)
+	if err != nil {
+		apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %s", err))
+		return false
+	}
+	return true
+}
+
+// category returns the named category, or nil if it's missing or hidden, in
+// which case the error has been sent
+func (ar *apiRequest) category(name string) *db.Category {
+	var c, err = ar.op.FindCategoryByName(name)
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read category %q", name), err)
+		return nil
+	}
+	if c == nil || ar.restrictions.HidesCategory(c) {
+		apiError(ar.w, http.StatusNotFound, fmt.Sprintf("Category %q not found", name))
+		return nil
+	}
+	return c
+}
+
+// folder returns the folder with the given public id, or nil if it's missing
+// or hidden, in which case the error has been sent
+func (ar *apiRequest) folder(pid string) *db.Folder {
+	var f, err = ar.op.FindFolderByPublicID(pid)
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read folder %q", pid), err)
+		return nil
+	}
+	if f == nil || f.Category == nil || ar.restrictions.HidesFolder(f) {
+		apiError(ar.w, http.StatusNotFound, fmt.Sprintf("Folder %q not found", pid))
+		return nil
+	}
+	return f
+}
+
+// page reads the requested offset and limit, sending an error and returning
+// false if they're invalid
+func (ar *apiRequest) page() (offset, limit uint64, ok bool) {
+	var err error
+	offset, limit, err = getPage(ar.r)
+	if err != nil {
+		apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Unable to read the requested page: %s", err))
+		return 0, 0, false
+	}
+	return offset, limit, true
+}
+
+// sendFolders sends one page of the folders sel finds
+func (ar *apiRequest) sendFolders(sel *db.FSelect) {
+	var offset, limit, ok = ar.page()
+	if !ok {
+		return
+	}
+
+	var folders []*db.Folder
+	var total, err = sel.Filter(ar.filter()).Limit(limit).Offset(offset).AllObjects(&folders)
+	var list *listing
+	if err == nil {
+		list, err = loadListing(ar.op, nil, folders)
+	}
+	if err != nil {
+		ar.serverError("Unable to read folders", err)
+		return
+	}
+	sendJSON(ar.w, http.StatusOK, newAPIList(ar.r, newAPIFolders(folders, list), total, offset, limit))
+}
+
+// sendFiles sends one page of the files sel finds
+func (ar *apiRequest) sendFiles(sel *db.FSelect) {
+	var offset, limit, ok = ar.page()
+	if !ok {
+		return
+	}
+
+	var files []*db.File
+	var total, err = sel.LatestOnly(ar.opts.Latest).Filter(ar.filter()).Limit(limit).Offset(offset).AllObjects(&files)
+	var list *listing
+	if err == nil {
+		list, err = loadListing(ar.op, files, nil)
+	}
+	if err != nil {
+		ar.serverError("Unable to read files", err)
+		return
+	}
+	sendJSON(ar.w, http.StatusOK, newAPIList(ar.r, newAPIFiles(files, list), total, offset, limit))
+}
+
+func (ar *apiRequest) listCategories() {
+	var categories, err = ar.op.AllCategories()
+	if err != nil {
+		ar.serverError("Unable to read categories", err)
+		return
+	}
+
+	var items = []apiCategory{}
+	for _, c := range categories {
+		if !ar.restrictions.HidesCategory(c) {
+			ar.op.CategoryTotals(c, ar.filter())
+			items = append(items, newAPICategory(c))
+		}
+	}
+	err = ar.op.Operation.Err()
+	if err != nil {
+		ar.serverError("Unable to compute category totals", err)
+		return
+	}
+	sendJSON(ar.w, http.StatusOK, vars{"items": items})
+}
+
+func (ar *apiRequest) getCategory() {
+	var c = ar.category(ar.id)
+	if c == nil {
+		return
+	}
+	var err = ar.op.CategoryTotals(c, ar.filter())
+	if err != nil {
+		ar.serverError("Unable to compute category totals", err)
+		return
+	}
+	sendJSON(ar.w, http.StatusOK, newAPICategory(c))
+}
+
+func (ar *apiRequest) listCategoryFolders() {
+	var c = ar.category(ar.id)
+	if c != nil {
+		ar.sendFolders(ar.op.FolderSelect(c, nil))
+	}
+}
+
+func (ar *apiRequest) listCategoryFiles() {
+	var c = ar.category(ar.id)
+	if c != nil {
+		ar.sendFiles(ar.op.FileSelect(c, nil))
+	}
+}
+
+// findFolder looks up a folder by its category and path, for scripts which
+// only know where a folder is, not its public id
+func (ar *apiRequest) findFolder() {
+	var q = ar.r.URL.Query()
+	if q.Get("category") == "" || q.Get("path") == "" {
+		apiError(ar.w, http.StatusBadRequest, "A category and path are required")
+		return
+	}
+
+	var c = ar.category(q.Get("category"))
+	if c == nil {
+		return
+	}
+	var path = filepath.Join(strings.Split(q.Get("path"), "/")...)
+	var f, err = ar.op.FindFolderByPath(c, path)
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read folder %q", path), err)
+		return
+	}
+	if f == nil || ar.restrictions.HidesFolder(f) {
+		apiError(ar.w, http.StatusNotFound, fmt.Sprintf("Folder %q not found", q.Get("path")))
+		return
+	}
+	f.Category = c
+	ar.sendFolder(f)
+}
+
+func (ar *apiRequest) getFolder() {
+	var f = ar.folder(ar.id)
+	if f != nil {
+		ar.sendFolder(f)
+	}
+}
+
+// sendFolder sends a folder's details
+func (ar *apiRequest) sendFolder(f *db.Folder) {
+	var err = ar.op.FolderTotals([]*db.Folder{f}, ar.filter())
+	var list *listing
+	if err == nil {
+		list, err = loadListing(ar.op, nil, []*db.Folder{f})
+	}
+	var details apiDetails
+	if err == nil {
+		details, err = loadAPIDetails(ar.op, f.PublicID)
+	}
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read folder %q", f.PublicID), err)
+		return
+	}
+	sendJSON(ar.w, http.StatusOK, apiFolderDetails{newAPIFolder(f, list), details})
+}
+
+func (ar *apiRequest) listFolderFolders() {
+	var f = ar.folder(ar.id)
+	if f != nil {
+		ar.sendFolders(ar.op.FolderSelect(f.Category, f))
+	}
+}
+
+func (ar *apiRequest) listFolderFiles() {
+	var f = ar.folder(ar.id)
+	if f != nil {
+		ar.sendFiles(ar.op.FileSelect(f.Category, f))
+	}
+}
+
+func (ar *apiRequest) listRealFolders() {
+	var f = ar.folder(ar.id)
+	if f == nil {
+		return
+	}
+	var realFolders, err = ar.op.GetRealFolders(f)
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read filesystem data for %q", f.PublicID), err)
+		return
+	}
+
+	var items = []apiRealFolder{}
+	for _, rf := range realFolders {
+		items = append(items, apiRealFolder{FullPath: sanitizePath(rf.FullPath)})
+	}
+	sendJSON(ar.w, http.StatusOK, vars{"items": items})
+}
+
+func (ar *apiRequest) getFile() {
+	var f, err = ar.op.FindFileByPublicID(ar.id)
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read file %q", ar.id), err)
+		return
+	}
+	if f == nil || ar.restrictions.HidesFile(f) {
+		apiError(ar.w, http.StatusNotFound, fmt.Sprintf("File %q not found", ar.id))
+		return
+	}
+
+	err = ar.op.PopulateCategories([]*db.File{f}, nil)
+	var inv *db.Inventory
+	if err == nil {
+		inv, err = ar.op.FindInventoryByID(f.InventoryID)
+	}
+	var versions []*db.File
+	if err == nil {
+		versions, err = ar.op.GetFileVersions(f.Category, f.PublicPath)
+	}
+	var list *listing
+	if err == nil {
+		list, err = loadListing(ar.op, []*db.File{f}, nil)
+	}
+	var details apiDetails
+	if err == nil {
+		details, err = loadAPIDetails(ar.op, f.PublicID)
+	}
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read file %q", f.PublicID), err)
+		return
+	}
+
+	var fd = apiFileDetails{apiFile: newAPIFile(f, list), apiDetails: details, Versions: []string{}}
+	if inv != nil {
+		fd.Inventory = inv.Path
+	}
+	for _, v := range ar.restrictions.FilterFiles(versions) {
+		fd.Versions = append(fd.Versions, v.PublicID)
+	}
+	sendJSON(ar.w, http.StatusOK, fd)
+}
+
+// searchScope returns the category and folder a search is limited to, if
+// any.  ok is false if an error was sent.
+func (ar *apiRequest) searchScope() (c *db.Category, f *db.Folder, ok bool) {
+	var q = ar.r.URL.Query()
+	if q.Get("folder") != "" {
+		f = ar.folder(q.Get("folder"))
+		if f == nil {
+			return nil, nil, false
+		}
+		c = f.Category
+		if q.Get("category") != "" && q.Get("category") != c.Name {
+			apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Folder %q isn't in category %q", f.PublicID, q.Get("category")))
+			return nil, nil, false
+		}
+		return c, f, true
+	}
+
+	if q.Get("category") != "" {
+		c = ar.category(q.Get("category"))
+		if c == nil {
+			return nil, nil, false
+		}
+	}
+	return c, nil, true
+}
+
+// search reads the search term and scope, and returns a tree-mode select
+// for the given kind of item, with the term applied.  The term is one of
+// the search page's: q matches file paths or folder names, nq notes and
+// tags, and mq descriptive metadata.  With no term, filters alone may narrow
+// the search.  nil is returned if an error was sent.
+func (ar *apiRequest) search(newSelect func(*db.Category, *db.Folder) *db.FSelect, nameField string) *db.FSelect {
+	var c, f, ok = ar.searchScope()
+	if !ok {
+		return nil
+	}
+
+	var q = ar.r.URL.Query()
+	var sel = newSelect(c, f).TreeMode(true)
+	var terms int
+	if q.Get("q") != "" {
+		sel.Search(nameField+" LIKE ?", q.Get("q"))
+		terms++
+	}
+	if q.Get("nq") != "" {
+		sel.Annotated(q.Get("nq"))
+		terms++
+	}
+	if q.Get("mq") != "" {
+		sel.Described(q.Get("mq"))
+		terms++
+	}
+	if terms == 0 && ar.opts.Filters.Empty() {
+		apiError(ar.w, http.StatusBadRequest, "You must provide a search term (q, nq, or mq) or a filter")
+		return nil
+	}
+	return sel
+}
+
+func (ar *apiRequest) searchFolders() {
+	var sel = ar.search(ar.op.FolderSelect, "name")
+	if sel != nil {
+		ar.sendFolders(sel)
+	}
+}
+
+func (ar *apiRequest) searchFiles() {
+	var sel = ar.search(ar.op.FileSelect, "public_path")
+	if sel != nil {
+		// q is a LIKE pattern, usually "%term%": rank by the term inside
+		sel.Rank(searchRanking(), []string{strings.Trim(ar.r.URL.Query().Get("q"), "%")})
+		ar.sendFiles(sel)
+	}
+}
+
+// loadQueue returns the requestor's bulk file queue from their session
+func (ar *apiRequest) loadQueue() *BulkFileQueue {
+	var q = NewBulkFileQueue()
+	var err = sessionManager.Load(ar.r).GetObject("Queue", q)
+	if err != nil {
+		ar.serverError("Unable to load your bulk file queue", err)
+		return nil
+	}
+	return q
+}
+
+// sendQueue sends the queue's file ids and total size
+func (ar *apiRequest) sendQueue(q *BulkFileQueue) {
+	var qp, err = NewQueuePresenter(q)
+	if err != nil {
+		ar.serverError("Unable to load your bulk file queue", err)
+		return
+	}
+
+	var aq = apiQueue{Files: []string{}}
+	for _, f := range qp.Files {
+		aq.Files = append(aq.Files, f.PublicID)
+		aq.TotalBytes += f.Filesize
+	}
+	sendJSON(ar.w, http.StatusOK, aq)
+}
+
+// visibleFiles looks up the files with the given public ids.  If any aren't
+// in the catalog, or are hidden from the requestor, an error is sent and nil
+// is returned.
+func (ar *apiRequest) visibleFiles(pids []string) []*db.File {
+	var files, err = ar.op.GetFilesByPublicIDs(pids)
+	if err != nil {
+		ar.serverError("Unable to read files", err)
+		return nil
+	}
+
+	var seen = make(map[string]bool)
+	for _, f := range ar.restrictions.FilterFiles(files) {
+		seen[f.PublicID] = true
+	}
+	var missing []string
+	for _, pid := range pids {
+		if !seen[pid] {
+			missing = append(missing, pid)
+		}
+	}
+	if len(missing) > 0 {
+		apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Unknown file ids: %s", strings.Join(missing, ", ")))
+		return nil
+	}
+	return files
+}
+
+func (ar *apiRequest) getQueue() {
+	var q = ar.loadQueue()
+	if q != nil {
+		ar.sendQueue(q)
+	}
+}
+
+// changeQueue adds and removes files from the requestor's bulk file queue.
+// As with the queue buttons, files which can't be seen can't be added, but
+// anything can be removed.
+func (ar *apiRequest) changeQueue() {
+	var body struct {
+		Add    []string `json:"add"`
+		Remove []string `json:"remove"`
+	}
+	if !ar.readBody(&body) {
+		return
+	}
+	var q = ar.loadQueue()
+	if q == nil {
+		return
+	}
+
+	var files []*db.File
+	if len(body.Add) > 0 {
+		files = ar.visibleFiles(body.Add)
+		if files == nil {
+			return
+		}
+	}
+	for _, f := range files {
+		q.AddFile(f)
+	}
+	for _, pid := range body.Remove {
+		delete(q.PublicIDs, pid)
+	}
+
+	var err = sessionManager.Load(ar.r).PutObject(ar.w, "Queue", q)
+	if err != nil {
+		ar.serverError("Unable to save your bulk file queue", err)
+		return
+	}
+	ar.sendQueue(q)
+}
+
+func (ar *apiRequest) emptyQueue() {
+	var err = sessionManager.Load(ar.r).Remove(ar.w, "Queue")
+	if err != nil {
+		ar.serverError("Unable to empty your bulk file queue", err)
+		return
+	}
+	ar.sendQueue(NewBulkFileQueue())
+}
+
+// createJob queues an archive job for the given files, or for everything in
+// the requestor's bulk file queue if no files are given.  The queue is
+// emptied once the job is created from it.
+func (ar *apiRequest) createJob() {
+	var body struct {
+		Files  []string `json:"files"`
+		Emails []string `json:"emails"`
+	}
+	if !ar.readBody(&body) {
+		return
+	}
+
+	var addrs, err = mail.ParseAddressList(strings.Join(body.Emails, ", "))
+	if len(body.Emails) == 0 || err != nil {
+		apiError(ar.w, http.StatusBadRequest, "At least one valid notification email address is required")
+		return
+	}
+
+	var fromQueue = len(body.Files) == 0
+	var files []*db.File
+	if fromQueue {
+		var q = ar.loadQueue()
+		if q == nil {
+			return
+		}
+		files, err = q.Files()
+		if err != nil {
+			ar.serverError("Unable to load your bulk file queue", err)
+			return
+		}
+
+		// Files may have been restricted since they were queued
+		var visible = make(map[string]bool)
+		for _, f := range ar.restrictions.FilterFiles(files) {
+			visible[f.PublicID] = true
+		}
+		var hidden []string
+		for _, f := range files {
+			if !visible[f.PublicID] {
+				hidden = append(hidden, f.PublicID)
+			}
+		}
+		if len(hidden) > 0 {
+			apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Unknown file ids: %s", strings.Join(hidden, ", ")))
+			return
+		}
+	} else {
+		files = ar.visibleFiles(body.Files)
+		if files == nil {
+			return
+		}
+	}
+	if len(files) == 0 {
+		apiError(ar.w, http.StatusBadRequest, "There are no files to archive")
+		return
+	}
+
+	var j *db.ArchiveJob
+	err = dbh.InTransaction(func(op *db.Operation) error {
+		j, err = op.QueueArchiveJob(requestor(ar.r), addrs, files)
+		return err
+	})
+	if err != nil {
+		ar.serverError("Unable to queue the archive job", err)
+		return
+	}
+	if fromQueue {
+		sessionManager.Load(ar.r).Remove(ar.w, "Queue")
+	}
+
+	ar.w.Header().Set("Location", apiPath("jobs", strconv.Itoa(j.ID)))
+	sendJSON(ar.w, http.StatusCreated, newAPIJob(j, files, j.RequestedBy))
+}
+
+// getJob describes an archive job, listing only the files the requestor is
+// allowed to see
+func (ar *apiRequest) getJob() {
+	var id, err = strconv.Atoi(ar.id)
+	if err != nil {
+		apiError(ar.w, http.StatusBadRequest, "Invalid archive job id")
+		return
+	}
+
+	var j *db.ArchiveJob
+	j, err = ar.op.FindArchiveJobByID(id)
+	var files []*db.File
+	if err == nil && j != nil {
+		files, err = ar.op.GetJobFiles(j)
+	}
+	if err != nil {
+		ar.serverError(fmt.Sprintf("Unable to read archive job %d", id), err)
+		return
+	}
+	if j == nil {
+		apiError(ar.w, http.StatusNotFound, fmt.Sprintf("Archive job %d not found", id))
+		return
+	}
+	sendJSON(ar.w, http.StatusOK, newAPIJob(j, ar.restrictions.FilterFiles(files), requestor(ar.r)))
+}
+
+// lookupChecksums finds files by content.  A JSON body lists the checksums to
+// look up; any other body is a file to hash and look up, named by the "name"
+// query parameter if given.
+func (ar *apiRequest) lookupChecksums() {
+	var lookups []*checksumLookup
+	if strings.HasPrefix(ar.r.Header.Get("Content-Type"), "application/json") {
+		var body struct {
+			Checksums []string `json:"checksums"`
+		}
+		if !ar.readBody(&body) {
+			return
+		}
+
+		var invalid []string
+		lookups, invalid = parseChecksumList(strings.Join(body.Checksums, "\n"))
+		if len(invalid) > 0 {
+			apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Invalid SHA256 checksums: %s", strings.Join(invalid, ", ")))
+			return
+		}
+		if len(lookups) == 0 {
+			apiError(ar.w, http.StatusBadRequest, "At least one checksum is required")
+			return
+		}
+	} else {
+		var l, err = hashUpload(ar.r.Body, ar.r.URL.Query().Get("name"))
+		if err != nil {
+			apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Unable to read the uploaded file: %s", err))
+			return
+		}
+		lookups = append(lookups, l)
+	}
+	ar.sendChecksums(lookups)
+}
+
+func (ar *apiRequest) getChecksum() {
+	var sum = strings.ToLower(ar.id)
+	if !sha256RE.MatchString(sum) {
+		apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("%q is not a SHA256 checksum", ar.id))
+		return
+	}
+	ar.sendChecksums([]*checksumLookup{{Checksum: sum}})
+}
+
+// sendChecksums finds the files for each lookup and sends them
+func (ar *apiRequest) sendChecksums(lookups []*checksumLookup) {
+	var err = findChecksums(ar.op, lookups, ar.restrictions)
+	var files []*db.File
+	for _, l := range lookups {
+		files = append(files, l.Files...)
+	}
+	var list *listing
+	if err == nil {
+		list, err = loadListing(ar.op, files, nil)
+	}
+	if err != nil {
+		ar.serverError("Unable to look up checksums", err)
+		return
+	}
+
+	var items = make([]apiChecksum, len(lookups))
+	for i, l := range lookups {
+		items[i] = apiChecksum{Checksum: l.Checksum, Label: l.Label, Files: newAPIFiles(l.Files, list)}
+	}
+	sendJSON(ar.w, http.StatusOK, vars{"items": items})
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// autocompleteLimit is how many folders and how many files are suggested
+const autocompleteLimit = 10
+
+// autocompleteCandidates is how many folders or files are read, and cached,
+// for a prefix.  There are more than are suggested so some are left after
+// collapsing versions.  When a prefix has fewer candidates than this, the
+// list holds every match, so it can answer longer prefixes without the
+// database.
+const autocompleteCandidates = 200
+
+// minAutocompleteLength is the shortest prefix suggestions are given for
+const minAutocompleteLength = 2
+
+// completions are the candidates read for a prefix.  Nothing hidden by the
+// restrictions they were read with is included, so they're only shared by
+// people with the same restrictions.
+type completions struct {
+	files    []*db.File
+	folders  []*db.Folder
+	complete bool
+}
+
+// completionCache holds completions so typing a name usually takes one
+// database query, for the first few letters, and the rest come from memory.
+// Entries expire after a few minutes so new files show up.
+var completionCache = cache.New(5*time.Minute, 10*time.Minute)
+
+// completionKey identifies cached completions.  The database file is part of
+// the key since a rebuilt catalog has different ids.
+func completionKey(kind string, c *db.Category, f *db.Folder, r *db.Restrictions, prefix string) string {
+	var cid, fid int
+	if c != nil {
+		cid = c.ID
+	}
+	if f != nil {
+		fid = f.ID
+	}
+	return fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%s\x00%s", rdbh.File(), kind, cid, fid, r.Key(), prefix)
+}
+
+// lookupCompletions returns the candidate folders or files (kind is "folders"
+// or "files") under c and f which start with prefix and aren't hidden by r.
+// A cached list for a shorter prefix is used if it holds every match.
+func lookupCompletions(op *db.Operation, kind string, c *db.Category, f *db.Folder, r *db.Restrictions, prefix string) (*completions, error) {
+	prefix = strings.ToLower(prefix)
+	var runes = []rune(prefix)
+	for n := len(runes); n >= minAutocompleteLength; n-- {
+		var cached, ok = completionCache.Get(completionKey(kind, c, f, r, string(runes[:n])))
+		if ok && (n == len(runes) || cached.(*completions).complete) {
+			return cached.(*completions).narrow(f, prefix), nil
+		}
+	}
+
+	var comp = &completions{}
+	var err error
+	if kind == "folders" {
+		comp.folders, err = op.CompleteFolders(c, f, prefix, r, autocompleteCandidates)
+		comp.complete = len(comp.folders) < autocompleteCandidates
+	} else {
+		comp.files, err = op.CompleteFiles(c, f, prefix, r, autocompleteCandidates)
+		comp.complete = len(comp.files) < autocompleteCandidates
+	}
+	if err != nil {
+		return nil, err
+	}
+	completionCache.SetDefault(completionKey(kind, c, f, r, prefix), comp)
+	return comp.narrow(f, prefix), nil
+}
+
+// narrow returns the completions which really start with prefix: a cached
+// list may be for a shorter prefix, and the database's LIKE treats "_" as a
+// wildcard.  Folders match on their name or their path relative to f.
+func (comp *completions) narrow(f *db.Folder, prefix string) *completions {
+	var pathPrefix = prefix
+	if f != nil {
+		pathPrefix = strings.ToLower(f.PublicPath) + "/" + prefix
+	}
+
+	var n = &completions{complete: comp.complete}
+	for _, file := range comp.files {
+		if strings.HasPrefix(strings.ToLower(file.Name), prefix) {
+			n.files = append(n.files, file)
+		}
+	}
+	for _, folder := range comp.folders {
+		if strings.HasPrefix(strings.ToLower(folder.Name), prefix) ||
+			strings.HasPrefix(strings.ToLower(folder.PublicPath), pathPrefix) {
+			n.folders = append(n.folders, folder)
+		}
+	}
+	return n
+}
+
+// autocompletePath returns the autocomplete endpoint's URL for suggestions
+// of the given types ("folders", "files", or both, comma-separated) under
+// the category and folder, either of which may be nil
+func autocompletePath(c *db.Category, f *db.Folder, types string) string {
+	var v = url.Values{"type": {types}}
+	if c != nil {
+		v.Set("category", c.Name)
+	}
+	if f != nil {
+		v.Set("folder", f.PublicID)
+	}
+	return apiPath("autocomplete") + "?" + v.Encode()
+}
+
+// autocomplete suggests folders and files whose names (or, for folders,
+// paths relative to the folder searched) start with the "term" parameter.
+// "type" chooses "folders", "files", or both (the default).  Each version
+// of a file is suggested once, and nothing hidden from the requestor is
+// suggested.
+func (ar *apiRequest) autocomplete() {
+	var c, f, ok = ar.searchScope()
+	if !ok {
+		return
+	}
+
+	var q = ar.r.URL.Query()
+	var term = strings.TrimSpace(q.Get("term"))
+	var items = []apiCompletion{}
+	if len([]rune(term)) < minAutocompleteLength {
+		sendJSON(ar.w, http.StatusOK, vars{"items": items})
+		return
+	}
+
+	var types = q.Get("type")
+	if types == "" {
+		types = "folders,files"
+	}
+	var categories, err = ar.op.AllCategories()
+	if err != nil {
+		ar.serverError("Unable to read categories", err)
+		return
+	}
+	var names = make(map[int]string)
+	for _, cat := range categories {
+		names[cat.ID] = cat.Name
+	}
+
+	for _, kind := range strings.Split(types, ",") {
+		if kind != "folders" && kind != "files" {
+			apiError(ar.w, http.StatusBadRequest, fmt.Sprintf("Unknown type %q; use folders, files, or both", kind))
+			return
+		}
+
+		var comp, err = lookupCompletions(ar.op, kind, c, f, ar.restrictions, term)
+		if err != nil {
+			ar.serverError("Unable to read suggestions", err)
+			return
+		}
+		items = append(items, ar.visibleCompletions(comp, names)...)
+	}
+	sendJSON(ar.w, http.StatusOK, vars{"items": items})
+}
+
+// visibleCompletions returns up to autocompleteLimit folders and files from
+// comp, with one entry per file however many versions it has.  comp was read
+// with the requestor's restrictions, but they're checked again here since a
+// mistake would reveal hidden names.
+func (ar *apiRequest) visibleCompletions(comp *completions, categoryNames map[int]string) []apiCompletion {
+	var items []apiCompletion
+	for _, folder := range comp.folders {
+		if len(items) == autocompleteLimit {
+			break
+		}
+		if !ar.restrictions.HidesFolder(folder) {
+			items = append(items, apiCompletion{Type: "folder", ID: folder.PublicID,
+				Category: categoryNames[folder.CategoryID], Path: folder.PublicPath, Name: folder.Name})
+		}
+	}
+
+	var seen = make(map[string]bool)
+	for _, file := range comp.files {
+		if len(seen) == autocompleteLimit {
+			break
+		}
+		var key = fmt.Sprintf("%d/%s", file.CategoryID, file.PublicPath)
+		if seen[key] || ar.restrictions.HidesFile(file) {
+			continue
+		}
+		seen[key] = true
+		items = append(items, apiCompletion{Type: "file", ID: file.PublicID,
+			Category: categoryNames[file.CategoryID], Path: file.PublicPath, Name: file.Name})
+	}
+	return items
+}
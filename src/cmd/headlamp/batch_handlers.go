@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func batchesHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) < 2 || parts[1] == "" {
+		listBatches(w, r)
+		return
+	}
+
+	var id, err = strconv.Atoi(parts[1])
+	if err != nil {
+		_400(w, r, "Invalid batch id")
+		return
+	}
+	viewBatch(w, r, id)
+}
+
+func listBatches(w http.ResponseWriter, r *http.Request) {
+	var inventories, err = rdbh.Operation().AllInventories()
+	var restrictions *db.Restrictions
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
+	if err != nil {
+		logger.Errorf("Unable to read inventories: %s", err)
+		_500(w, r, "Error trying to read the list of batches.  Try again or contact support.")
+		return
+	}
+
+	var visible []*db.Inventory
+	for _, inv := range inventories {
+		if !restrictions.HidesInventory(inv) {
+			visible = append(visible, inv)
+		}
+	}
+
+	batchList.Render(w, r, vars{"Title": "Headlamp: Batches", "Inventories": visible})
+}
+
+func viewBatch(w http.ResponseWriter, r *http.Request, id int) {
+	var op = rdbh.Operation()
+	var inv, err = op.FindInventoryByID(id)
+	var restrictions *db.Restrictions
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
+	if err != nil {
+		logger.Errorf("Unable to read inventory %d: %s", id, err)
+		_500(w, r, "Error trying to read the batch.  Try again or contact support.")
+		return
+	}
+	if inv == nil || restrictions.HidesInventory(inv) {
+		_404(w, r, fmt.Sprintf("Batch %d not found", id))
+		return
+	}
+
+	var term = r.URL.Query().Get("q")
+	var files []*db.File
+	var totalFileCount uint64
+	files, totalFileCount, err = op.GetInventoryFiles(inv, term, restrictions, maxFiles+1)
+	if err != nil {
+		logger.Errorf("Unable to read files for inventory %d: %s", id, err)
+		_500(w, r, "Error trying to read the batch's files.  Try again or contact support.")
+		return
+	}
+
+	var tooManyFiles = false
+	if len(files) > maxFiles {
+		files = files[:maxFiles]
+		tooManyFiles = true
+	}
+
+	batch.Render(w, r, vars{
+		"Title":        fmt.Sprintf("Headlamp: Batch %s", inv.Path),
+		"Inventory":    inv,
+		"SearchTerm":   term,
+		"Files":        files,
+		"TooManyFiles": tooManyFiles,
+		"MaxFiles":     maxFiles,
+		"TotalFiles":   totalFileCount,
+	})
+}
@@ -43,14 +43,16 @@ func (c *breadCrumbs) nav() template.HTML {
 }
 
 // breadcrumbs displays the category (if any) and each path element of the
-// current folder (if any), each as a clickable location for easier navigation
-func breadcrumbs(c *db.Category, f *db.Folder) template.HTML {
+// current folder (if any), each as a clickable location for easier navigation.
+// If a query string is given, it's added to each link.
+func breadcrumbs(c *db.Category, f *db.Folder, query ...string) template.HTML {
 	if c == nil {
 		return template.HTML("")
 	}
 
+	var q = strings.Join(query, "")
 	var crumbs = &breadCrumbs{}
-	crumbs.add(c.Name, browseCategoryPath(c))
+	crumbs.add(c.Name, browseCategoryPath(c)+q)
 	var folderPathParts []string
 	if f != nil {
 		folderPathParts = strings.Split(f.PublicPath, string(os.PathSeparator))
@@ -58,7 +60,7 @@ func breadcrumbs(c *db.Category, f *db.Folder) template.HTML {
 	var dummyFolder = &db.Folder{Category: c}
 	for _, part := range folderPathParts {
 		dummyFolder.PublicPath = filepath.Join(dummyFolder.PublicPath, part)
-		crumbs.add(part, browseFolderPath(dummyFolder))
+		crumbs.add(part, browseFolderPath(dummyFolder)+q)
 	}
 
 	return crumbs.nav()
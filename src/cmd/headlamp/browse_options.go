@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// browseOptions holds the query-string settings which change what browsing
+// and searching show, so links can carry them from page to page
+type browseOptions struct {
+	// Latest hides all but the most recent version of each file
+	Latest bool
+
+	// AsOf, if set, shows the catalog as it was on the given archive date
+	AsOf string
+
+	// Filters narrows browsing and searching to files with certain
+	// properties, such as a size range or extension
+	Filters db.Filters
+}
+
+// getBrowseOptions reads the browse options from the request's query string
+func getBrowseOptions(r *http.Request) (browseOptions, error) {
+	var q = r.URL.Query()
+	var opts = browseOptions{Latest: q.Get("latest") == "1", AsOf: q.Get("asof")}
+	if opts.AsOf != "" {
+		var _, err = time.Parse("2006-01-02", opts.AsOf)
+		if err != nil {
+			return opts, fmt.Errorf("invalid date %q; dates must be formatted as YYYY-MM-DD", opts.AsOf)
+		}
+	}
+	for _, name := range db.FilterNames {
+		var err = opts.Filters.Set(name, q.Get(name))
+		if err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// searchValues returns the options which carry over into a search: the
+// "as of" date and the filters
+func (o browseOptions) searchValues() url.Values {
+	var v = url.Values{}
+	if o.AsOf != "" {
+		v.Set("asof", o.AsOf)
+	}
+	for _, name := range db.FilterNames {
+		var val = o.Filters.Get(name)
+		if val != "" {
+			v.Set(name, val)
+		}
+	}
+	return v
+}
+
+func (o browseOptions) values() url.Values {
+	var v = o.searchValues()
+	if o.Latest {
+		v.Set("latest", "1")
+	}
+	return v
+}
+
+// SearchFields returns the options a search form should pass along as hidden
+// fields, keyed by field name
+func (o browseOptions) SearchFields() map[string]string {
+	var v = o.searchValues()
+	var fields = make(map[string]string)
+	for k := range v {
+		fields[k] = v.Get(k)
+	}
+	return fields
+}
+
+// FilterSummary describes the filters which are set, e.g., "extension tif,
+// at least 10 MiB", or returns an empty string if none are
+func (o browseOptions) FilterSummary() string {
+	var f = o.Filters
+	var parts []string
+	if f.FromDate != "" {
+		parts = append(parts, "archived on or after "+f.FromDate)
+	}
+	if f.ToDate != "" {
+		parts = append(parts, "archived on or before "+f.ToDate)
+	}
+	if f.MinSize > 0 {
+		parts = append(parts, "at least "+humanFilesize(f.MinSize))
+	}
+	if f.MaxSize > 0 {
+		parts = append(parts, "at most "+humanFilesize(f.MaxSize))
+	}
+	if f.Extension != "" {
+		parts = append(parts, "with extension "+f.Extension)
+	}
+	if f.Format != "" {
+		parts = append(parts, "identified as "+f.Format)
+	}
+	if f.Checksum != "" {
+		parts = append(parts, "with checksum "+f.Checksum)
+	}
+	if f.Inventory != "" {
+		parts = append(parts, "from inventory "+f.Inventory)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Query returns the options as a query string to append to a URL, or an
+// empty string if no options are set
+func (o browseOptions) Query() string {
+	var v = o.values()
+	if len(v) == 0 {
+		return ""
+	}
+	return "?" + v.Encode()
+}
+
+// SearchQuery returns a query string for a file search for q with the
+// options which carry over into searches, for links to other searches
+func (o browseOptions) SearchQuery(q string, fuzzy bool) string {
+	var v = o.searchValues()
+	v.Set("q", q)
+	if fuzzy {
+		v.Set("fuzzy", "1")
+	}
+	return "?" + v.Encode()
+}
+
+// LatestQuery returns a relative URL for the current page with Latest set to l
+func (o browseOptions) LatestQuery(l bool) string {
+	o.Latest = l
+	return "?" + o.values().Encode()
+}
+
+// FacetsQuery returns a relative URL for the current page with its facets
+// shown or hidden
+func (o browseOptions) FacetsQuery(show bool) string {
+	var v = o.values()
+	if show {
+		v.Set("facets", "1")
+	}
+	return "?" + v.Encode()
+}
+
+// AsOfQuery returns a relative URL for the current page as of the given date
+func (o browseOptions) AsOfQuery(date string) string {
+	o.AsOf = date
+	return "?" + o.values().Encode()
+}
+
+// adjacentArchiveDates returns the archive dates just before and just after
+// asOf.  An empty asOf means the catalog as it is today, which is the same as
+// viewing it as of the last archive date.
+func adjacentArchiveDates(dates []string, asOf string) (prev, next string) {
+	if len(dates) == 0 {
+		return "", ""
+	}
+	if asOf == "" {
+		asOf = dates[len(dates)-1]
+	}
+	for _, d := range dates {
+		if d < asOf {
+			prev = d
+		}
+		if d > asOf && next == "" {
+			next = d
+		}
+	}
+	return prev, next
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"net/http"
 	"net/mail"
-	"strconv"
 
 	"github.com/uoregon-libraries/gopkg/logger"
 	"github.com/uoregon-libraries/gopkg/webutil"
@@ -18,25 +17,31 @@ func bulkQueueHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify we have a valid numeric ID
 	var operation = parts[1]
-	var fileIDString = parts[2]
-	var fileID, err = strconv.ParseUint(fileIDString, 10, 64)
+	var pid = parts[2]
+
+	// Verify that the file exists
+	var op = rdbh.Operation()
+	var f, err = op.FindFileByPublicID(pid)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		logger.Errorf("Unable to look up file id %q: %s", pid, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if f == nil {
+		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	// Verify that the file exists
-	var op = dbh.Operation()
-	var f *db.File
-	f, err = op.FindFileByID(fileID)
+	// Files the user can't see can't be queued, but they can always be removed
+	var restrictions *db.Restrictions
+	restrictions, err = viewerRestrictions(r)
 	if err != nil {
-		logger.Errorf("Unable to look up file id %d: %s", fileID, err)
+		logger.Errorf("Unable to read restrictions: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if f == nil {
+	if operation == "add" && restrictions.HidesFile(f) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
@@ -138,6 +143,21 @@ func bulkCreateArchiveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Files may have been restricted since they were queued
+	var restrictions *db.Restrictions
+	restrictions, err = viewerRestrictions(r)
+	if err != nil {
+		logger.Errorf("Unable to read restrictions: %s", err)
+		_500(w, r, "Unable to load your bulk download queue.  Try again or contact support.")
+		return
+	}
+	var visible = restrictions.FilterFiles(files)
+	if len(visible) != len(files) {
+		setAlert(w, r, "Some files in your queue are no longer available.  Please remove them and try again.")
+		http.Redirect(w, r, viewBulkQueuePath(), http.StatusTemporaryRedirect)
+		return
+	}
+
 	if len(files) == 0 {
 		setAlert(w, r, "You don't have any files to archive!")
 		http.Redirect(w, r, viewBulkQueuePath(), http.StatusTemporaryRedirect)
@@ -158,7 +178,10 @@ func bulkCreateArchiveHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = dbh.Operation().QueueArchiveJob(addrs, files)
+	err = dbh.InTransaction(func(op *db.Operation) error {
+		var _, err = op.QueueArchiveJob(requestor(r), addrs, files)
+		return err
+	})
 	if err != nil {
 		logger.Errorf("Error trying to queue new archive: %s", err)
 		setAlert(w, r, "Unable to queue the archive creation.  Please try again or contact support.")
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// maxChecksumList is the most text we'll read from a pasted list of checksums
+const maxChecksumList = 1 << 20
+
+var sha256RE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// checksumLookup is one checksum somebody asked about, and the files in the
+// archive with that content
+type checksumLookup struct {
+	Label    string // A file name from sha256sum output or an upload, if known
+	Checksum string
+	Files    []*db.File
+}
+
+// parseChecksumList reads pasted checksums, one per line.  Lines may be in
+// sha256sum's output format, in which case the file name is kept as the
+// lookup's label.  Lines which don't start with a checksum are returned as
+// invalid.
+func parseChecksumList(text string) (lookups []*checksumLookup, invalid []string) {
+	for _, line := range strings.Split(text, "\n") {
+		var fields = strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		var sum = strings.ToLower(fields[0])
+		if !sha256RE.MatchString(sum) {
+			invalid = append(invalid, strings.TrimSpace(line))
+			continue
+		}
+		var label = strings.TrimPrefix(strings.Join(fields[1:], " "), "*")
+		lookups = append(lookups, &checksumLookup{Label: label, Checksum: sum})
+	}
+	return lookups, invalid
+}
+
+// hashUpload computes the SHA256 of an uploaded file without keeping it
+func hashUpload(r io.Reader, name string) (*checksumLookup, error) {
+	var h = sha256.New()
+	var _, err = io.Copy(h, r)
+	if err != nil {
+		return nil, err
+	}
+	return &checksumLookup{Label: name, Checksum: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// findChecksums fills in each lookup's files, skipping those hidden by r
+func findChecksums(op *db.Operation, lookups []*checksumLookup, r *db.Restrictions) error {
+	var sums []string
+	var seen = make(map[string]bool)
+	for _, l := range lookups {
+		if !seen[l.Checksum] {
+			seen[l.Checksum] = true
+			sums = append(sums, l.Checksum)
+		}
+	}
+
+	var files, err = op.GetFilesByChecksums(sums, r)
+	if err != nil {
+		return err
+	}
+	for _, l := range lookups {
+		for _, f := range files {
+			if f.Checksum == l.Checksum {
+				l.Files = append(l.Files, f)
+			}
+		}
+	}
+	return nil
+}
+
+// checksumHandler serves the lookup form, the results of a POSTed lookup, and
+// permalinks for a single checksum, /checksum/<sha256>
+func checksumHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) > 1 && parts[1] != "" {
+		if len(parts) > 2 || r.Method != http.MethodGet {
+			_400(w, r, "Invalid request")
+			return
+		}
+		var sum = strings.ToLower(parts[1])
+		if !sha256RE.MatchString(sum) {
+			_400(w, r, fmt.Sprintf("%q is not a SHA256 checksum", parts[1]))
+			return
+		}
+		renderChecksums(w, r, []*checksumLookup{{Checksum: sum}}, nil)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		checksums.Render(w, r, vars{"Title": "Headlamp: Checksum Lookup"})
+		return
+	}
+
+	var lookups, invalid, err = readChecksumForm(r)
+	if err != nil {
+		logger.Warnf("Unable to read checksum lookup form: %s", err)
+		_400(w, r, "Unable to read the uploaded checksums or file.  Try again or contact support.")
+		return
+	}
+	if len(lookups) == 0 && len(invalid) == 0 {
+		setAlert(w, r, "Paste at least one checksum or choose a file to upload")
+		w.WriteHeader(http.StatusBadRequest)
+		checksums.Render(w, r, vars{"Title": "Headlamp: Checksum Lookup"})
+		return
+	}
+	renderChecksums(w, r, lookups, invalid)
+}
+
+// readChecksumForm reads the pasted checksums and the uploaded file, if any,
+// from the lookup form.  Uploads are hashed as they're read, so they're never
+// stored.
+func readChecksumForm(r *http.Request) (lookups []*checksumLookup, invalid []string, err error) {
+	var mr *multipart.Reader
+	mr, err = r.MultipartReader()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for {
+		var part *multipart.Part
+		part, err = mr.NextPart()
+		if err == io.EOF {
+			return lookups, invalid, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		switch part.FormName() {
+		case "checksums":
+			var data []byte
+			data, err = ioutil.ReadAll(io.LimitReader(part, maxChecksumList))
+			if err != nil {
+				return nil, nil, err
+			}
+			var l, inv = parseChecksumList(string(data))
+			lookups = append(lookups, l...)
+			invalid = append(invalid, inv...)
+		case "file":
+			if part.FileName() == "" {
+				continue
+			}
+			var l *checksumLookup
+			l, err = hashUpload(part, part.FileName())
+			if err != nil {
+				return nil, nil, err
+			}
+			lookups = append(lookups, l)
+		}
+	}
+}
+
+func renderChecksums(w http.ResponseWriter, r *http.Request, lookups []*checksumLookup, invalid []string) {
+	var op = rdbh.Operation()
+	var restrictions, err = viewerRestrictions(r)
+	if err == nil {
+		err = findChecksums(op, lookups, restrictions)
+	}
+	if err != nil {
+		logger.Errorf("Unable to look up checksums: %s", err)
+		_500(w, r, "Error trying to look up checksums.  Try again or contact support.")
+		return
+	}
+
+	checksums.Render(w, r, vars{
+		"Title":   "Headlamp: Checksum Lookup",
+		"Lookups": lookups,
+		"Invalid": invalid,
+	})
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/compare"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// maxFormField is the most we'll read from a plain (non-file) form field
+const maxFormField = 4096
+
+// compareForm holds what was submitted on the comparison form
+type compareForm struct {
+	Category string
+	Folder   string
+	Entries  []compare.Entry
+	HasFile  bool
+}
+
+// compareHandler shows the form for comparing an uploaded manifest against
+// the catalog, and the report once a manifest is uploaded
+func compareHandler(w http.ResponseWriter, r *http.Request) {
+	var op = rdbh.Operation()
+	var categories, err = op.AllCategories()
+	var restrictions *db.Restrictions
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
+	if err != nil {
+		logger.Errorf("Unable to read categories or restrictions: %s", err)
+		_500(w, r, "Error trying to read categories.  Try again or contact support.")
+		return
+	}
+
+	var visible []*db.Category
+	for _, c := range categories {
+		if !restrictions.HidesCategory(c) {
+			visible = append(visible, c)
+		}
+	}
+	var data = vars{"Title": "Headlamp: Compare a Manifest", "Categories": visible}
+
+	if r.Method != http.MethodPost {
+		comparison.Render(w, r, data)
+		return
+	}
+
+	var form *compareForm
+	form, err = readCompareForm(r)
+	if err == nil && !form.HasFile {
+		err = fmt.Errorf("choose a manifest to upload")
+	}
+	if err != nil {
+		// Alerts aren't escaped, and the error may quote the manifest
+		setAlert(w, r, html.EscapeString(fmt.Sprintf("Unable to read the manifest: %s", err)))
+		w.WriteHeader(http.StatusBadRequest)
+		comparison.Render(w, r, data)
+		return
+	}
+	data["Form"] = form
+
+	var c *db.Category
+	for _, vc := range visible {
+		if vc.Name == form.Category {
+			c = vc
+		}
+	}
+	if form.Category != "" && c == nil {
+		_400(w, r, fmt.Sprintf("Category %q not found", form.Category))
+		return
+	}
+
+	var rpt *compare.Report
+	rpt, err = compare.Compare(op, form.Entries, c, form.Folder, restrictions)
+	if err != nil {
+		logger.Errorf("Unable to compare manifest against the catalog: %s", err)
+		_500(w, r, "Error trying to compare the manifest.  Try again or contact support.")
+		return
+	}
+	data["Report"] = rpt
+	comparison.Render(w, r, data)
+}
+
+// readCompareForm reads the comparison form's fields.  The manifest is
+// parsed as it's read rather than stored.
+func readCompareForm(r *http.Request) (*compareForm, error) {
+	var mr, err = r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	var form = &compareForm{}
+	for {
+		var part *multipart.Part
+		part, err = mr.NextPart()
+		if err == io.EOF {
+			return form, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch part.FormName() {
+		case "category", "folder":
+			var data []byte
+			data, err = ioutil.ReadAll(io.LimitReader(part, maxFormField))
+			if err != nil {
+				return nil, err
+			}
+			if part.FormName() == "category" {
+				form.Category = string(data)
+			} else {
+				form.Folder = strings.Trim(strings.TrimSpace(string(data)), "/")
+			}
+		case "manifest":
+			if part.FileName() == "" {
+				continue
+			}
+			form.HasFile = true
+			form.Entries, err = compare.ReadManifest(part)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// conflictsHandler lists unresolved conflicts, or resolves one when POSTed to
+// /conflicts/<id>/resolve
+func conflictsHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) < 2 || parts[1] == "" {
+		listConflicts(w, r)
+		return
+	}
+
+	if len(parts) != 3 || parts[2] != "resolve" || r.Method != http.MethodPost {
+		_400(w, r, "Invalid request")
+		return
+	}
+
+	var id, err = strconv.Atoi(parts[1])
+	if err != nil {
+		_400(w, r, "Invalid conflict id")
+		return
+	}
+	resolveConflict(w, r, id)
+}
+
+func listConflicts(w http.ResponseWriter, r *http.Request) {
+	var conflicts, err = rdbh.Operation().UnresolvedConflicts()
+	if err != nil {
+		logger.Errorf("Unable to read conflicts: %s", err)
+		_500(w, r, "Error trying to read conflicts.  Try again or contact support.")
+		return
+	}
+
+	conflictList.Render(w, r, vars{"Title": "Headlamp: Conflicts", "Conflicts": conflicts})
+}
+
+func resolveConflict(w http.ResponseWriter, r *http.Request, id int) {
+	var c *db.Conflict
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		var err error
+		c, err = op.FindConflictByID(id)
+		if err != nil || c == nil {
+			return err
+		}
+		return op.ResolveConflict(c, requestor(r))
+	})
+	if err != nil {
+		logger.Errorf("Unable to resolve conflict %d: %s", id, err)
+		_500(w, r, "Error trying to resolve the conflict.  Try again or contact support.")
+		return
+	}
+	if c == nil {
+		_404(w, r, fmt.Sprintf("Conflict %d not found", id))
+		return
+	}
+
+	setInfo(w, r, fmt.Sprintf("Conflict for %q marked as resolved", c.PublicPath))
+	http.Redirect(w, r, viewConflictsPath(), http.StatusSeeOther)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+	"github.com/uoregon-libraries/headlamp/src/premis"
+)
+
+// fileDetailsHandler shows a file's catalog data and the history of events
+// recorded for it
+func fileDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	var file = findFile(w, r, viewFileDetailsPath)
+	if file == nil {
+		return
+	}
+
+	var op = rdbh.Operation()
+	op.PopulateCategories([]*db.File{file}, nil)
+	var inv, err = op.FindInventoryByID(file.InventoryID)
+	var events []*db.Event
+	if err == nil {
+		events, err = op.FileEvents([]*db.File{file})
+	}
+	var notes *annotations
+	if err == nil {
+		notes, err = loadAnnotations(op, file.PublicID)
+	}
+	var meta []*db.Metadata
+	if err == nil {
+		meta, err = op.GetMetadata(file.PublicID)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to read details for file %q: %s", file.PublicID, err)
+		_500(w, r, "Unable to read the specified file's data.  Try again or contact support.")
+		return
+	}
+
+	fileDetails.Render(w, r, vars{
+		"Title":       fmt.Sprintf("Headlamp: %s", file.PublicPath),
+		"File":        file,
+		"Inventory":   inv,
+		"Events":      events,
+		"Annotations": notes,
+		"Metadata":    meta,
+	})
+}
+
+// premisHandler sends PREMIS XML describing a single file
+// (/premis/files/<pid>) or every file within a folder (/premis/folders/<pid>)
+func premisHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) != 3 {
+		_400(w, r, "Invalid request")
+		return
+	}
+
+	var files []*db.File
+	var name string
+	switch parts[1] {
+	case "files":
+		var file = findFile(w, r, filePREMISPath)
+		if file == nil {
+			return
+		}
+		files = []*db.File{file}
+		name = file.PublicID
+
+	case "folders":
+		var folder, err = rdbh.Operation().FindFolderByPublicID(parts[2])
+		var restrictions *db.Restrictions
+		if err == nil {
+			restrictions, err = viewerRestrictions(r)
+		}
+		if err != nil {
+			logger.Errorf("Error trying to find folder id %q: %s", parts[2], err)
+			_500(w, r, "Unable to read the specified folder's data.  Try again or contact support.")
+			return
+		}
+		if folder == nil || folder.Category == nil || restrictions.HidesFolder(folder) {
+			_404(w, r, "Unable to find the requested folder.  Try again or contact support.")
+			return
+		}
+		files, err = rdbh.Operation().GetAllFiles(folder.Category, folder, restrictions)
+		if err != nil {
+			logger.Errorf("Error trying to read files under folder %q: %s", folder.PublicID, err)
+			_500(w, r, "Unable to read the specified folder's data.  Try again or contact support.")
+			return
+		}
+		name = folder.PublicID
+
+	default:
+		_400(w, r, "Invalid request")
+		return
+	}
+
+	var op = rdbh.Operation()
+	var invPaths, err = op.InventoryPaths(files)
+	var events []*db.Event
+	if err == nil {
+		events, err = op.FileEvents(files)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to read events for %q: %s", name, err)
+		_500(w, r, "Unable to read the event history.  Try again or contact support.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-premis.xml", name))
+	err = premis.New(files, events, invPaths).Write(w)
+	if err != nil {
+		logger.Errorf("Error writing PREMIS XML for %q: %s", name, err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// facetTitles are the headings shown above each facet
+var facetTitles = map[string]string{
+	db.FacetCategory:  "Category",
+	db.FacetYear:      "Archive Year",
+	db.FacetExtension: "Extension",
+	db.FacetFormat:    "Format",
+	db.FacetSize:      "Size",
+}
+
+// facetLink is a facet value which links to the results narrowed to it
+type facetLink struct {
+	Label string
+	Count uint64
+	URL   string
+}
+
+// facetList is a facet ready to display
+type facetList struct {
+	Title string
+	Links []facetLink
+}
+
+// facetLinks turns facets into links which narrow the current page's
+// results.  path returns the page to link to for a category, or for the
+// current category if it's nil; extra holds query-string values other than
+// the browse options, such as the search term.  A value whose filters can't
+// combine with the ones already chosen is left out, since it couldn't match
+// anything.
+func facetLinks(bsd browseSearchData, facets []*db.Facet, path func(*db.Category) string, extra url.Values) []facetList {
+	var lists []facetList
+	for _, f := range facets {
+		var list = facetList{Title: facetTitles[f.Name]}
+		for _, fv := range f.Values {
+			var opts = bsd.opts
+			var combined, err = opts.Filters.Combine(fv.Filters)
+			if err != nil {
+				continue
+			}
+			opts.Filters = combined
+
+			var v = opts.values()
+			for k := range extra {
+				v.Set(k, extra.Get(k))
+			}
+			list.Links = append(list.Links, facetLink{Label: fv.Label, Count: fv.Count, URL: path(fv.Category) + "?" + v.Encode()})
+		}
+		lists = append(lists, list)
+	}
+	return lists
+}
@@ -14,49 +14,82 @@ import (
 	"github.com/uoregon-libraries/headlamp/src/db"
 )
 
-// getFile returns an *os.File retrieved using the id in the last path element,
-// or nil if no file was retrieved.  If nil is returned, the caller shouldn't
-// render or output anything; 400, 500, and 404 errors will already have been
-// sent to the browser.
-func getFile(w http.ResponseWriter, r *http.Request) *os.File {
-	var fileID uint64
+// findFile returns the file identified by the public id in the last path
+// element, or nil if no file was found.  If nil is returned, the caller
+// shouldn't render or output anything; 400, 500, and 404 errors (or a
+// redirect) will already have been sent to the browser.
+//
+// Old URLs used database ids, which aren't stable, so a numeric id is looked
+// up and redirected to the URL built by pathFn.  So is a public id which the
+// file had before its path was recomputed.
+func findFile(w http.ResponseWriter, r *http.Request, pathFn func(*db.File) string) *db.File {
 	var err error
-	var op = dbh.Operation()
+	var op = rdbh.Operation()
 
 	var parts = getPathParts(r)
 	var idString = parts[len(parts)-1]
-	fileID, err = strconv.ParseUint(idString, 10, 64)
-	if err != nil {
+	if idString == "" {
 		_400(w, r, "Invalid request")
 		return nil
 	}
 
 	var file *db.File
-	file, err = op.FindFileByID(fileID)
+	var fileID, numErr = strconv.ParseUint(idString, 10, 64)
+	if numErr == nil {
+		file, err = op.FindFileByID(fileID)
+	} else {
+		file, err = op.FindFileByPublicID(idString)
+	}
 	if err != nil {
-		logger.Errorf("Error trying to find file id %d: %s", fileID, err)
+		logger.Errorf("Error trying to find file id %q: %s", idString, err)
 		_500(w, r, "Unable to read the specified file's data.  Try again or contact support.")
 		return nil
 	}
 
-	if file == nil {
+	var restrictions *db.Restrictions
+	if file != nil {
+		restrictions, err = viewerRestrictions(r)
+		if err != nil {
+			logger.Errorf("Error trying to read restrictions: %s", err)
+			_500(w, r, "Unable to read the specified file's data.  Try again or contact support.")
+			return nil
+		}
+	}
+
+	if file == nil || restrictions.HidesFile(file) {
 		_404(w, r, "Unable to find the requested file.  Try again or contact support.")
 		return nil
 	}
 
+	if file.PublicID != idString {
+		http.Redirect(w, r, pathFn(file), http.StatusMovedPermanently)
+		return nil
+	}
+
+	return file
+}
+
+// getFile uses findFile to look up the requested file, then opens it and
+// sets the response's content type.  As with findFile, nil is returned if
+// anything has already been sent to the browser.
+func getFile(w http.ResponseWriter, r *http.Request, pathFn func(*db.File) string) (*db.File, *os.File) {
+	var file = findFile(w, r, pathFn)
+	if file == nil {
+		return nil, nil
+	}
+
 	var fullPath = filepath.Join(conf.DARoot, file.FullPath)
 	if !fileutil.IsFile(fullPath) {
 		logger.Errorf("File id %d describes a file I cannot find: %q / %q", file.ID, conf.DARoot, file.FullPath)
 		_500(w, r, fmt.Sprintf("Unable to find %q.  Try again or contact support.", file.FullPath))
-		return nil
+		return nil, nil
 	}
 
-	var fh *os.File
-	fh, err = os.Open(fullPath)
+	var fh, err = os.Open(fullPath)
 	if err != nil {
 		logger.Errorf("Error trying to Open file %q: %s", file.FullPath, err)
 		_500(w, r, fmt.Sprintf("Unable to open %q.  Try again or contact support.", file.FullPath))
-		return nil
+		return nil, nil
 	}
 
 	// Get mimetype via a modified version of golang's FileServer code
@@ -69,30 +102,45 @@ func getFile(w http.ResponseWriter, r *http.Request) *os.File {
 		if err != nil {
 			logger.Errorf("Error trying to Seek() on file %q: %s", file.FullPath, err)
 			_500(w, r, fmt.Sprintf("Unable to read %q.  Try again or contact support.", file.FullPath))
-			return nil
+			return nil, nil
 		}
 	}
 	w.Header().Set("Content-Type", mimeType)
 
-	return fh
+	return file, fh
+}
+
+// logDissemination records that a file was sent to the user.  Failing to log
+// it isn't worth failing the request over, so errors are just logged.
+func logDissemination(r *http.Request, file *db.File, detail string) {
+	var ev = db.NewFileEvent(db.EventDissemination, file, requestor(r), db.AgentPerson)
+	ev.Detail = detail
+	var err = dbh.InTransaction(func(op *db.Operation) error { return op.WriteEvents(ev) })
+	if err != nil {
+		logger.Errorf("Unable to record dissemination of %q: %s", file.PublicID, err)
+	}
 }
 
 func viewFileHandler(w http.ResponseWriter, r *http.Request) {
-	var fh = getFile(w, r)
+	var file, fh = getFile(w, r, viewFilePath)
 	if fh == nil {
 		return
 	}
+	defer fh.Close()
 
+	logDissemination(r, file, "Viewed in the browser")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("filename=%s", filepath.Base(fh.Name())))
 	io.Copy(w, fh)
 }
 
 func downloadFileHandler(w http.ResponseWriter, r *http.Request) {
-	var fh = getFile(w, r)
+	var file, fh = getFile(w, r, downloadFilePath)
 	if fh == nil {
 		return
 	}
+	defer fh.Close()
 
+	logDissemination(r, file, "Downloaded")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(fh.Name())))
 	io.Copy(w, fh)
 }
@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strings"
 
 	"github.com/uoregon-libraries/gopkg/logger"
 	"github.com/uoregon-libraries/headlamp/src/db"
+	"github.com/uoregon-libraries/headlamp/src/query"
 )
 
 // maxFiles tells the app how many files to display on at once; if there are
@@ -37,37 +39,80 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func renderHome(w http.ResponseWriter, r *http.Request) {
-	var categories, err = dbh.Operation().AllCategories()
+	var op = rdbh.Operation()
+	var categories, err = op.AllCategories()
+	var restrictions *db.Restrictions
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
 	if err != nil {
 		logger.Errorf("Unable to find categories: %s", err)
 		_500(w, r, "Error trying to find category list.  Try again or contact support.")
 		return
 	}
 
-	home.Render(w, r, vars{"Title": "Headlamp", "Categories": categories})
+	var visible []*db.Category
+	for _, c := range categories {
+		if !restrictions.HidesCategory(c) {
+			op.CategoryTotals(c, db.FileFilter{Restrictions: restrictions})
+			visible = append(visible, c)
+		}
+	}
+	err = op.Operation.Err()
+	if err != nil {
+		logger.Errorf("Unable to compute category totals: %s", err)
+		_500(w, r, "Error trying to find category list.  Try again or contact support.")
+		return
+	}
+
+	home.Render(w, r, vars{"Title": "Headlamp", "Categories": visible})
 }
 
 type browseSearchData struct {
-	op         *db.Operation
-	pName      string
-	category   *db.Category
-	folderPath string
-	folder     *db.Folder
-	hadError   bool
+	op           *db.Operation
+	pName        string
+	category     *db.Category
+	folderPath   string
+	folder       *db.Folder
+	opts         browseOptions
+	restrictions *db.Restrictions
+	hadError     bool
+}
+
+// filter returns the db.FileFilter for what the user asked to see and is
+// allowed to see
+func (bsd browseSearchData) filter() db.FileFilter {
+	return db.FileFilter{AsOf: bsd.opts.AsOf, Restrictions: bsd.restrictions, Filters: bsd.opts.Filters}
 }
 
 // getBrowseSearchData centralizes some of the common things we need to check /
 // pull from the database for both browsing and searching:
 //
-// - Get the current category, if this isn't a top-level search
-// - Get the current folder, if one is set
+//   - Get the current category, if this isn't a top-level search
+//   - Get the current folder, if one is set
+//   - Read the browse options and what the user isn't allowed to see, and
+//     recompute totals as needed
 func getBrowseSearchData(w http.ResponseWriter, r *http.Request) browseSearchData {
 	var bsd browseSearchData
 	var bsde = browseSearchData{hadError: true}
 	var parts = getPathParts(r)
 
+	var err error
+	bsd.opts, err = getBrowseOptions(r)
+	if err != nil {
+		_400(w, r, fmt.Sprintf("Unable to read the requested options: %s", err))
+		return bsde
+	}
+
 	// We're doing a lot, so let's grab a single operation for all this lovely work
-	bsd.op = dbh.Operation()
+	bsd.op = rdbh.Operation()
+
+	bsd.restrictions, err = viewerRestrictions(r)
+	if err != nil {
+		logger.Errorf("Error trying to read restrictions: %s", err)
+		_500(w, r, "Error trying to read access restrictions.  Try again or contact support.")
+		return bsde
+	}
 
 	if len(parts) < 2 {
 		return bsd
@@ -82,14 +127,13 @@ func getBrowseSearchData(w http.ResponseWriter, r *http.Request) browseSearchDat
 		return bsd
 	}
 
-	var err error
 	bsd.category, err = bsd.op.FindCategoryByName(bsd.pName)
 	if err != nil {
 		logger.Errorf("Error trying to read category %q from the database: %s", bsd.pName, err)
 		_500(w, r, fmt.Sprintf("Error trying to find category %q.  Try again or contact support.", bsd.pName))
 		return bsde
 	}
-	if bsd.category == nil {
+	if bsd.category == nil || bsd.restrictions.HidesCategory(bsd.category) {
 		_404(w, r, fmt.Sprintf("Category %q not found", bsd.pName))
 		return bsde
 	}
@@ -102,12 +146,23 @@ func getBrowseSearchData(w http.ResponseWriter, r *http.Request) browseSearchDat
 			_500(w, r, fmt.Sprintf("Error trying to find folder %q.  Try again or contact support.", bsd.folderPath))
 			return bsde
 		}
-		if bsd.folder == nil {
+		if bsd.folder == nil || bsd.restrictions.HidesFolder(bsd.folder) {
 			_404(w, r, fmt.Sprintf("Folder %q not found", bsd.folderPath))
 			return bsde
 		}
 	}
 
+	bsd.op.CategoryTotals(bsd.category, bsd.filter())
+	if bsd.folder != nil {
+		bsd.op.FolderTotals([]*db.Folder{bsd.folder}, bsd.filter())
+	}
+	err = bsd.op.Operation.Err()
+	if err != nil {
+		logger.Errorf("Error trying to compute totals for %q (in category %q): %s", bsd.folderPath, bsd.pName, err)
+		_500(w, r, fmt.Sprintf("Error trying to read %q.  Try again or contact support.", bsd.pName))
+		return bsde
+	}
+
 	return bsd
 }
 
@@ -117,7 +172,7 @@ func browseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var folders, err = bsd.op.GetFolders(bsd.category, bsd.folder)
+	var folders, err = bsd.op.GetFolders(bsd.category, bsd.folder, bsd.filter())
 	if err != nil {
 		logger.Errorf("Error trying to read folders under %q (in category %q) from the database: %s",
 			bsd.folderPath, bsd.pName, err)
@@ -127,7 +182,7 @@ func browseHandler(w http.ResponseWriter, r *http.Request) {
 
 	var files []*db.File
 	var totalFileCount uint64
-	files, totalFileCount, err = bsd.op.GetFiles(bsd.category, bsd.folder, maxFiles+1)
+	files, totalFileCount, err = bsd.op.GetFiles(bsd.category, bsd.folder, bsd.opts.Latest, bsd.filter(), maxFiles+1)
 	if err != nil {
 		logger.Errorf("Error trying to read files under %q (in category %q) from the database: %s",
 			bsd.folderPath, bsd.pName, err)
@@ -135,21 +190,71 @@ func browseHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var dates []string
+	dates, err = bsd.op.ArchiveDates(bsd.category, bsd.restrictions)
+	if err != nil {
+		logger.Errorf("Error trying to read archive dates for category %q: %s", bsd.pName, err)
+		_500(w, r, fmt.Sprintf("Error trying to read folder %q.  Try again or contact support.", bsd.folderPath))
+		return
+	}
+	var prevDate, nextDate = adjacentArchiveDates(dates, bsd.opts.AsOf)
+
 	var tooManyFiles = false
 	if len(files) > maxFiles {
 		files = files[:maxFiles]
 		tooManyFiles = true
 	}
 
+	// Facets describe everything under this folder, not just its own files.
+	// Counting them scans the whole subtree several times, so they're only
+	// shown when asked for.
+	var showFacets = r.URL.Query().Get("facets") == "1"
+	var facets []*db.Facet
+	if showFacets {
+		facets, err = bsd.op.FileSelect(bsd.category, bsd.folder).TreeMode(true).LatestOnly(bsd.opts.Latest).
+			Filter(bsd.filter()).Facets()
+	}
+	if err != nil {
+		logger.Errorf("Error trying to count facets under %q (in category %q): %s", bsd.folderPath, bsd.pName, err)
+		_500(w, r, fmt.Sprintf("Error trying to read folder %q.  Try again or contact support.", bsd.folderPath))
+		return
+	}
+	var currentPage = func(*db.Category) string { return "" }
+
+	var list *listing
+	var notes *annotations
+	var meta []*db.Metadata
+	list, err = loadListing(bsd.op, files, folders)
+	if err == nil && bsd.folder != nil {
+		notes, err = loadAnnotations(bsd.op, bsd.folder.PublicID)
+	}
+	if err == nil && bsd.folder != nil {
+		meta, err = bsd.op.GetMetadata(bsd.folder.PublicID)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to read descriptive data under %q (in category %q): %s", bsd.folderPath, bsd.pName, err)
+		_500(w, r, fmt.Sprintf("Error trying to read folder %q.  Try again or contact support.", bsd.folderPath))
+		return
+	}
+
 	browse.Render(w, r, vars{
-		"Title":        fmt.Sprintf("Headlamp: Browsing %s", bsd.category.Name),
-		"Category":     bsd.category,
-		"Folder":       bsd.folder,
-		"Folders":      folders,
-		"Files":        files,
-		"TooManyFiles": tooManyFiles,
-		"MaxFiles":     maxFiles,
-		"TotalFiles":   totalFileCount,
+		"Title":           fmt.Sprintf("Headlamp: Browsing %s", bsd.category.Name),
+		"Category":        bsd.category,
+		"Folder":          bsd.folder,
+		"Folders":         folders,
+		"Files":           files,
+		"TooManyFiles":    tooManyFiles,
+		"MaxFiles":        maxFiles,
+		"TotalFiles":      totalFileCount,
+		"Options":         bsd.opts,
+		"ArchiveDates":    dates,
+		"PrevArchiveDate": prevDate,
+		"NextArchiveDate": nextDate,
+		"Listing":         list,
+		"Annotations":     notes,
+		"Metadata":        meta,
+		"ShowFacets":      showFacets,
+		"Facets":          facetLinks(bsd, facets, currentPage, url.Values{"facets": {"1"}}),
 	})
 }
 
@@ -161,7 +266,14 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 
 	var q = r.URL.Query().Get("q")
 	var fq = r.URL.Query().Get("fq")
-	if q == "" && fq == "" {
+	var nq = r.URL.Query().Get("nq")
+	var mq = r.URL.Query().Get("mq")
+
+	// Filters alone are enough to search for every file which passes them
+	if q == "" && fq == "" && nq == "" && mq == "" && !bsd.opts.Filters.Empty() {
+		q = "%"
+	}
+	if q == "" && fq == "" && nq == "" && mq == "" {
 		setAlert(w, r, "You must provide a search term")
 		w.WriteHeader(http.StatusBadRequest)
 
@@ -178,11 +290,71 @@ func searchHandler(w http.ResponseWriter, r *http.Request) {
 		folderSearch(w, r, bsd, fq)
 		return
 	}
+	if nq != "" {
+		combinedSearch(w, r, bsd, "NoteSearchTerm", nq, bsd.op.SearchAnnotatedFolders, bsd.op.SearchAnnotatedFiles)
+		return
+	}
+	if mq != "" {
+		combinedSearch(w, r, bsd, "MetadataSearchTerm", mq, bsd.op.SearchDescribedFolders, bsd.op.SearchDescribedFiles)
+		return
+	}
 	fileSearch(w, r, bsd, q)
 }
 
+func searchHelpHandler(w http.ResponseWriter, r *http.Request) {
+	searchHelp.Render(w, r, vars{"Title": "Headlamp: Search Help"})
+}
+
+// fileSearch parses term as a query (see the query package) and shows the
+// files matching it.  Mistakes in the query are shown with the search form so
+// they can be fixed.  A fuzzy search also finds words spelled like the
+// query's words, and a search which finds nothing suggests a respelled query
+// when one would find something.
 func fileSearch(w http.ResponseWriter, r *http.Request, bsd browseSearchData, term string) {
-	var files, totalFileCount, err = bsd.op.SearchFiles(bsd.category, bsd.folder, term, maxFiles+1)
+	var fuzzy = r.URL.Query().Get("fuzzy") == "1"
+	var qry, err = query.Parse(term)
+	if err == nil && qry.Category != "" {
+		var c *db.Category
+		c, err = bsd.op.FindCategoryByName(qry.Category)
+		if err != nil {
+			logger.Errorf("Error trying to read category %q from the database: %s", qry.Category, err)
+			_500(w, r, fmt.Sprintf("Error trying to find category %q.  Try again or contact support.", qry.Category))
+			return
+		}
+		err = bsd.useQueryCategory(c, qry.Category)
+	}
+	if err == nil && fuzzy {
+		var ferr = qry.Fuzz(bsd.op, bsd.restrictions)
+		if ferr != nil {
+			logger.Errorf("Error trying to find words similar to %q: %s", term, ferr)
+			_500(w, r, "Error trying to search for files.  Try again or contact support.")
+			return
+		}
+	}
+
+	var sel *db.FSelect
+	if err == nil {
+		sel = bsd.op.FileSelect(bsd.category, bsd.folder).TreeMode(true).Limit(maxFiles + 1)
+		err = qry.Apply(sel, bsd.filter())
+		sel.Rank(searchRanking(), qry.Terms)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		search.Render(w, r, vars{
+			"Title":      "Headlamp: File Search",
+			"SearchTerm": term,
+			"Fuzzy":      fuzzy,
+			"QueryError": err.Error(),
+			"Category":   bsd.category,
+			"Folder":     bsd.folder,
+			"Options":    bsd.opts,
+		})
+		return
+	}
+
+	var files []*db.File
+	var totalFileCount uint64
+	totalFileCount, err = sel.AllObjects(&files)
 	if err != nil {
 		logger.Errorf("Error trying to search for files under %q (in category %q) from the database: %s",
 			bsd.folderPath, bsd.pName, err)
@@ -196,20 +368,122 @@ func fileSearch(w http.ResponseWriter, r *http.Request, bsd browseSearchData, te
 		tooManyFiles = true
 	}
 
+	var list *listing
+	list, err = loadListing(bsd.op, files, nil)
+	if err != nil {
+		logger.Errorf("Error trying to read tags and titles for file search results: %s", err)
+		_500(w, r, "Error trying to search for files.  Try again or contact support.")
+		return
+	}
+
+	var suggestion string
+	if len(files) == 0 {
+		suggestion = suggestSearch(bsd, qry, fuzzy)
+	}
+
+	var facets []*db.Facet
+	facets, err = sel.Facets()
+	if err != nil {
+		logger.Errorf("Error trying to count facets for file search %q: %s", term, err)
+		_500(w, r, "Error trying to search for files.  Try again or contact support.")
+		return
+	}
+	var searchIn = func(c *db.Category) string {
+		if c == nil {
+			return searchPath(bsd.category, bsd.folder)
+		}
+		return searchPath(c, nil)
+	}
+	var extra = url.Values{"q": {term}}
+	if fuzzy {
+		extra.Set("fuzzy", "1")
+	}
+
+	var relevance = make(map[string]string)
+	for _, f := range files {
+		var reasons = searchRanking().Explain(f, qry.Terms)
+		if len(reasons) > 0 {
+			relevance[f.PublicID] = strings.Join(reasons, ", ")
+		}
+	}
+
 	search.Render(w, r, vars{
 		"Title":        "Headlamp: File Search",
+		"Listing":      list,
+		"Relevance":    relevance,
 		"SearchTerm":   term,
+		"Fuzzy":        fuzzy,
+		"Suggestion":   suggestion,
+		"Facets":       facetLinks(bsd, facets, searchIn, extra),
 		"Category":     bsd.category,
 		"Folder":       bsd.folder,
 		"Files":        files,
 		"TooManyFiles": tooManyFiles,
 		"MaxFiles":     maxFiles,
 		"TotalFiles":   totalFileCount,
+		"Options":      bsd.opts,
 	})
 }
 
+// suggestSearch returns qry with its words respelled as words in the
+// catalog, but only if that finds something the viewer can see.  Errors are
+// logged rather than returned, since a suggestion is only a nicety.
+func suggestSearch(bsd browseSearchData, qry *query.Query, fuzzy bool) string {
+	var suggestion, err = qry.Suggest(bsd.op, bsd.restrictions)
+	if err != nil {
+		logger.Errorf("Error trying to suggest a search: %s", err)
+		return ""
+	}
+	if suggestion == "" {
+		return ""
+	}
+
+	var sq *query.Query
+	sq, err = query.Parse(suggestion)
+	if err == nil && fuzzy {
+		err = sq.Fuzz(bsd.op, bsd.restrictions)
+	}
+	var sel = bsd.op.FileSelect(bsd.category, bsd.folder).TreeMode(true).Limit(1)
+	if err == nil {
+		err = sq.Apply(sel, bsd.filter())
+	}
+	var files []*db.File
+	if err == nil {
+		_, err = sel.AllObjects(&files)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to check suggested search %q: %s", suggestion, err)
+		return ""
+	}
+	if len(files) == 0 {
+		return ""
+	}
+	return suggestion
+}
+
+// searchRanking returns the configured weights for ordering file search
+// results by relevance
+func searchRanking() db.Ranking {
+	var sr = conf.SearchRanking
+	return db.Ranking{ExactName: sr.ExactName, NamePrefix: sr.NamePrefix, PathWord: sr.PathWord}
+}
+
+// useQueryCategory switches a search to the category a query named.  A
+// search already under a category can't switch to another one.
+func (bsd *browseSearchData) useQueryCategory(c *db.Category, name string) error {
+	if c == nil || bsd.restrictions.HidesCategory(c) {
+		return fmt.Errorf("there is no category named %q", name)
+	}
+	if bsd.category != nil && bsd.category.ID != c.ID {
+		return fmt.Errorf("cat:%s can't be used when searching within %s; search from the home page instead", name, bsd.category.Name)
+	}
+	bsd.category = c
+	bsd.pName = c.Name
+	return nil
+}
+
 func folderSearch(w http.ResponseWriter, r *http.Request, bsd browseSearchData, term string) {
-	var folders, totalFolderCount, err = bsd.op.SearchFolders(bsd.category, bsd.folder, term, maxFiles+1)
+	var folders, totalFolderCount, err = bsd.op.SearchFolders(bsd.category, bsd.folder, term, bsd.filter(), maxFiles+1)
 	if err != nil {
 		logger.Errorf("Error trying to search for folders under %q (in category %q) from the database: %s",
 			bsd.folderPath, bsd.pName, err)
@@ -223,8 +497,17 @@ func folderSearch(w http.ResponseWriter, r *http.Request, bsd browseSearchData,
 		tooManyFolders = true
 	}
 
+	var list *listing
+	list, err = loadListing(bsd.op, nil, folders)
+	if err != nil {
+		logger.Errorf("Error trying to read tags and titles for folder search results: %s", err)
+		_500(w, r, "Error trying to search for folders.  Try again or contact support.")
+		return
+	}
+
 	search.Render(w, r, vars{
 		"Title":            "Headlamp: Folder Search",
+		"Listing":          list,
 		"FolderSearchTerm": term,
 		"Category":         bsd.category,
 		"Folder":           bsd.folder,
@@ -232,6 +515,62 @@ func folderSearch(w http.ResponseWriter, r *http.Request, bsd browseSearchData,
 		"TooManyFolders":   tooManyFolders,
 		"MaxFolders":       maxFiles,
 		"TotalFolders":     totalFolderCount,
+		"Options":          bsd.opts,
+	})
+}
+
+// searchFoldersFunc and searchFilesFunc find folders or files under a
+// category and folder which match a term, as ff's viewer would see them
+type searchFoldersFunc func(*db.Category, *db.Folder, string, db.FileFilter, uint64) ([]*db.Folder, uint64, error)
+type searchFilesFunc func(*db.Category, *db.Folder, string, db.FileFilter, uint64) ([]*db.File, uint64, error)
+
+// combinedSearch finds both files and folders matching term, such as a
+// search of notes and tags.  The term is passed to the template under the
+// given name.
+func combinedSearch(w http.ResponseWriter, r *http.Request, bsd browseSearchData, termName, term string,
+	findFolders searchFoldersFunc, findFiles searchFilesFunc) {
+	var folders, totalFolderCount, err = findFolders(bsd.category, bsd.folder, term, bsd.filter(), maxFiles+1)
+	var files []*db.File
+	var totalFileCount uint64
+	if err == nil {
+		files, totalFileCount, err = findFiles(bsd.category, bsd.folder, term, bsd.filter(), maxFiles+1)
+	}
+	var list *listing
+	if err == nil {
+		list, err = loadListing(bsd.op, files, folders)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to search for %q under %q (in category %q) from the database: %s",
+			term, bsd.folderPath, bsd.pName, err)
+		_500(w, r, "Error trying to search.  Try again or contact support.")
+		return
+	}
+
+	var tooManyFolders, tooManyFiles = false, false
+	if len(folders) > maxFiles {
+		folders = folders[:maxFiles]
+		tooManyFolders = true
+	}
+	if len(files) > maxFiles {
+		files = files[:maxFiles]
+		tooManyFiles = true
+	}
+
+	search.Render(w, r, vars{
+		"Title":          "Headlamp: Search",
+		termName:         term,
+		"Category":       bsd.category,
+		"Folder":         bsd.folder,
+		"Folders":        folders,
+		"TooManyFolders": tooManyFolders,
+		"MaxFolders":     maxFiles,
+		"TotalFolders":   totalFolderCount,
+		"Files":          files,
+		"TooManyFiles":   tooManyFiles,
+		"MaxFiles":       maxFiles,
+		"TotalFiles":     totalFileCount,
+		"Listing":        list,
+		"Options":        bsd.opts,
 	})
 }
 
@@ -260,3 +599,26 @@ func viewRealFoldersHandler(w http.ResponseWriter, r *http.Request) {
 		"RealFolders": realFolders,
 	})
 }
+
+// folderPermalinkHandler redirects a folder's public id to its browse page.
+// A hidden folder is treated as missing, so its id doesn't reveal its path.
+func folderPermalinkHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	var pid = parts[len(parts)-1]
+	var folder, err = rdbh.Operation().FindFolderByPublicID(pid)
+	var restrictions *db.Restrictions
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to find folder id %q: %s", pid, err)
+		_500(w, r, "Unable to read the specified folder's data.  Try again or contact support.")
+		return
+	}
+	if folder == nil || folder.Category == nil || restrictions.HidesFolder(folder) {
+		_404(w, r, "Unable to find the requested folder.  Try again or contact support.")
+		return
+	}
+
+	http.Redirect(w, r, browseFolderPath(folder), http.StatusMovedPermanently)
+}
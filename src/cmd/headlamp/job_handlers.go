@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// maxJobs is how many archive jobs we show on the job list
+const maxJobs = 100
+
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) < 2 || parts[1] == "" {
+		listJobs(w, r)
+		return
+	}
+
+	var id, err = strconv.Atoi(parts[1])
+	if err != nil {
+		_400(w, r, "Invalid archive job id")
+		return
+	}
+	viewJob(w, r, id)
+}
+
+func listJobs(w http.ResponseWriter, r *http.Request) {
+	var jobs, err = rdbh.Operation().RecentArchiveJobs(maxJobs)
+	if err != nil {
+		logger.Errorf("Unable to read archive jobs: %s", err)
+		_500(w, r, "Error trying to read archive jobs.  Try again or contact support.")
+		return
+	}
+
+	jobList.Render(w, r, vars{"Title": "Headlamp: Archive Jobs", "Jobs": jobs, "Requestor": requestor(r)})
+}
+
+// viewJob shows an archive job's status and the files in it the requestor is
+// allowed to see.  Who requested the job and who is notified are only shown
+// to the requestor.
+func viewJob(w http.ResponseWriter, r *http.Request, id int) {
+	var op = rdbh.Operation()
+	var j, err = op.FindArchiveJobByID(id)
+	if err != nil {
+		logger.Errorf("Unable to read archive job %d: %s", id, err)
+		_500(w, r, "Error trying to read the archive job.  Try again or contact support.")
+		return
+	}
+	if j == nil {
+		_404(w, r, fmt.Sprintf("Archive job %d not found", id))
+		return
+	}
+
+	var files []*db.File
+	var restrictions *db.Restrictions
+	files, err = op.GetJobFiles(j)
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
+	if err != nil {
+		logger.Errorf("Unable to read files for archive job %d: %s", id, err)
+		_500(w, r, "Error trying to read the archive job.  Try again or contact support.")
+		return
+	}
+
+	var attempts []*db.JobAttempt
+	attempts, err = op.GetJobAttempts(j)
+	if err != nil {
+		logger.Errorf("Unable to read attempts for archive job %d: %s", id, err)
+		_500(w, r, "Error trying to read the archive job.  Try again or contact support.")
+		return
+	}
+
+	var visible = restrictions.FilterFiles(files)
+	job.Render(w, r, vars{
+		"Title":    fmt.Sprintf("Headlamp: Archive Job %d", j.ID),
+		"Job":      j,
+		"Mine":     j.RequestedBy == requestor(r),
+		"Files":    visible,
+		"Hidden":   len(files) - len(visible),
+		"Attempts": attempts,
+	})
+}
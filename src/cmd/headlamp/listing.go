@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// listing holds the extra data shown alongside each file and folder in a
+// list, keyed by public id
+type listing struct {
+	Tags   map[string][]string
+	Titles map[string]string
+}
+
+// loadListing reads the tags and titles for the given files and folders
+func loadListing(op *db.Operation, files []*db.File, folders []*db.Folder) (*listing, error) {
+	var pids []string
+	for _, f := range files {
+		pids = append(pids, f.PublicID)
+	}
+	for _, f := range folders {
+		pids = append(pids, f.PublicID)
+	}
+
+	var l = &listing{}
+	var err error
+	l.Tags, err = op.TagNames(pids)
+	if err == nil {
+		l.Titles, err = op.MetadataValues(pids, "title")
+	}
+	return l, err
+}
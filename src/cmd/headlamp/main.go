@@ -17,8 +17,13 @@ import (
 	"github.com/uoregon-libraries/headlamp/src/db"
 )
 
-// dbh is our global database handle for DA searches
+// dbh is our global database handle for anything which writes data, such as
+// queueing archive jobs
 var dbh = db.New()
+
+// rdbh is our global read-only database handle for DA searches and other page
+// loads, so they're never stuck waiting on the indexer or archiver
+var rdbh = db.NewReadOnly()
 var basePath string
 var conf *config.Config
 var sessionManager *scs.Manager
@@ -27,6 +32,7 @@ func main() {
 	conf = getCLI()
 
 	var s = startServer()
+	go watchDatabase()
 	interrupts.TrapIntTerm(func() {
 		var ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(time.Minute))
 		defer cancel()
@@ -38,6 +44,22 @@ func main() {
 	}
 }
 
+// watchDatabase checks for a rebuilt catalog every few seconds, switching
+// both database handles over to it once it's been swapped in
+func watchDatabase() {
+	for range time.Tick(time.Second * 10) {
+		for _, h := range []*db.Database{dbh, rdbh} {
+			var swapped, err = h.Refresh()
+			if err != nil {
+				logger.Errorf("Unable to check for a swapped database: %s", err)
+			}
+			if swapped {
+				logger.Infof("Database was swapped; now using %q", h.File())
+			}
+		}
+	}
+}
+
 func startServer() *http.Server {
 	var mux = http.NewServeMux()
 	var u, _ = url.Parse(conf.WebPath)
@@ -46,13 +68,25 @@ func startServer() *http.Server {
 	logger.Debugf("Serving root from %q", basePath)
 	mux.HandleFunc(basePath+"/", homeHandler)
 	mux.HandleFunc(basePath+"/browse/", browseHandler)
+	mux.HandleFunc(basePath+"/folders/", folderPermalinkHandler)
 	mux.HandleFunc(basePath+"/search/", searchHandler)
+	mux.HandleFunc(basePath+"/help/search", searchHelpHandler)
 	mux.HandleFunc(basePath+"/view/", viewFileHandler)
 	mux.HandleFunc(basePath+"/download/", downloadFileHandler)
+	mux.HandleFunc(basePath+"/versions/", versionsHandler)
+	mux.HandleFunc(basePath+"/files/", fileDetailsHandler)
+	mux.HandleFunc(basePath+"/premis/", premisHandler)
+	mux.HandleFunc(basePath+"/annotations/", annotationsHandler)
 	mux.HandleFunc(basePath+"/bulk/", bulkQueueHandler)
 	mux.HandleFunc(basePath+"/bulk/create", bulkCreateArchiveHandler)
 	mux.HandleFunc(basePath+"/bulk-download/", bulkDownloadHandler)
 	mux.HandleFunc(basePath+"/filesystem/", viewRealFoldersHandler)
+	mux.HandleFunc(basePath+"/jobs/", jobsHandler)
+	mux.HandleFunc(basePath+"/batches/", batchesHandler)
+	mux.HandleFunc(basePath+"/conflicts/", conflictsHandler)
+	mux.HandleFunc(basePath+"/checksum/", checksumHandler)
+	mux.HandleFunc(basePath+"/compare/", compareHandler)
+	mux.HandleFunc(basePath+"/api/", apiHandler)
 
 	var staticPath = filepath.Join(conf.Approot, "static")
 	var fileServer = http.FileServer(http.Dir(staticPath))
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// requestor returns the identity of the user making the request: the value
+// of the configured auth header if there is one, otherwise the client's IP
+func requestor(r *http.Request) string {
+	if conf.AuthUserHeader != "" {
+		var user = r.Header.Get(conf.AuthUserHeader)
+		if user != "" {
+			return user
+		}
+	}
+
+	var host, _, err = net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// viewerRestrictions returns what's hidden from the user making the request
+func viewerRestrictions(r *http.Request) (*db.Restrictions, error) {
+	return rdbh.Operation().RestrictionsFor(requestor(r), time.Now())
+}
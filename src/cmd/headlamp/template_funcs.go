@@ -7,6 +7,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/uoregon-libraries/gopkg/humanize"
 	"github.com/uoregon-libraries/gopkg/tmpl"
@@ -17,16 +18,38 @@ import (
 var localTemplateFuncs = tmpl.FuncMap{
 	"BreadCrumbs":                breadcrumbs,
 	"SearchPath":                 searchPath,
+	"SearchHelpPath":             searchHelpPath,
+	"AutocompletePath":           autocompletePath,
 	"AddToQueueButton":           addToQueueButton,
 	"RemoveFromQueueButton":      removeFromQueueButton,
 	"ViewBulkQueuePath":          viewBulkQueuePath,
 	"BrowseCategoryPath":         browseCategoryPath,
 	"BrowseFolderPath":           browseFolderPath,
 	"BrowseContainingFolderPath": browseContainingFolderPath,
+	"FolderPermalink":            folderPermalink,
 	"ViewFilePath":               viewFilePath,
+	"ViewVersionsPath":           viewVersionsPath,
+	"ViewFileDetailsPath":        viewFileDetailsPath,
+	"FilePREMISPath":             filePREMISPath,
+	"FolderPREMISPath":           folderPREMISPath,
 	"ViewRealFoldersPath":        viewRealFoldersPath,
 	"DownloadFilePath":           downloadFilePath,
 	"BulkDownloadCreatePath":     bulkDownloadCreatePath,
+	"ViewJobsPath":               viewJobsPath,
+	"ViewJobPath":                viewJobPath,
+	"ViewBatchesPath":            viewBatchesPath,
+	"ViewBatchPath":              viewBatchPath,
+	"ViewConflictsPath":          viewConflictsPath,
+	"ChecksumLookupPath":         checksumLookupPath,
+	"ChecksumPath":               checksumPath,
+	"ComparePath":                comparePath,
+	"ResolveConflictPath":        resolveConflictPath,
+	"AddNotePath":                addNotePath,
+	"UpdateNotePath":             updateNotePath,
+	"DeleteNotePath":             deleteNotePath,
+	"AddTagPath":                 addTagPath,
+	"RemoveTagPath":              removeTagPath,
+	"FormatTime":                 formatTime,
 	"Pathify":                    pathify,
 	"GenericPath":                joinPaths,
 	"stripCategoryFolder":        stripCategoryFolder,
@@ -56,12 +79,16 @@ func searchPath(category *db.Category, folder *db.Folder) string {
 	return joinPaths("search", pathify(category, folder))
 }
 
+func searchHelpPath() string {
+	return joinPaths("help", "search")
+}
+
 func addToQueuePath(file *db.File) string {
-	return joinPaths("bulk", "add", strconv.FormatUint(file.ID, 10))
+	return joinPaths("bulk", "add", file.PublicID)
 }
 
 func removeFromQueuePath(file *db.File) string {
-	return joinPaths("bulk", "remove", strconv.FormatUint(file.ID, 10))
+	return joinPaths("bulk", "remove", file.PublicID)
 }
 
 func makeButton(val string, classes []string, attrs map[string]string, disabled bool) template.HTML {
@@ -84,7 +111,7 @@ func bulkButtonID(add bool, file *db.File) string {
 	} else {
 		prefix = "remove"
 	}
-	return fmt.Sprintf("%s-queue-%d", prefix, file.ID)
+	return fmt.Sprintf("%s-queue-%s", prefix, file.PublicID)
 }
 
 func addToQueueButton(q *BulkFileQueue, file *db.File) template.HTML {
@@ -127,7 +154,25 @@ func browseContainingFolderPath(file *db.File) string {
 }
 
 func viewFilePath(file *db.File) string {
-	return joinPaths("view", strconv.FormatUint(file.ID, 10))
+	return joinPaths("view", file.PublicID)
+}
+
+// viewVersionsPath returns the URL listing every version of the given file
+func viewVersionsPath(file *db.File) string {
+	return joinPaths("versions", file.Category.Name, sanitizePath(file.PublicPath))
+}
+
+// viewFileDetailsPath returns the URL for a file's details and event history
+func viewFileDetailsPath(file *db.File) string {
+	return joinPaths("files", file.PublicID)
+}
+
+func filePREMISPath(file *db.File) string {
+	return joinPaths("premis", "files", file.PublicID)
+}
+
+func folderPREMISPath(folder *db.Folder) string {
+	return joinPaths("premis", "folders", folder.PublicID)
 }
 
 func viewRealFoldersPath(folder *db.Folder) string {
@@ -135,13 +180,84 @@ func viewRealFoldersPath(folder *db.Folder) string {
 }
 
 func downloadFilePath(file *db.File) string {
-	return joinPaths("download", strconv.FormatUint(file.ID, 10))
+	return joinPaths("download", file.PublicID)
+}
+
+// folderPermalink returns a URL for the folder which won't change even if the
+// catalog is rebuilt
+func folderPermalink(folder *db.Folder) string {
+	return joinPaths("folders", folder.PublicID)
 }
 
 func bulkDownloadCreatePath() string {
 	return joinPaths("bulk", "create")
 }
 
+func viewJobsPath() string {
+	return joinPaths("jobs") + "/"
+}
+
+func viewJobPath(j *db.ArchiveJob) string {
+	return joinPaths("jobs", strconv.Itoa(j.ID))
+}
+
+func viewBatchesPath() string {
+	return joinPaths("batches") + "/"
+}
+
+func viewBatchPath(i *db.Inventory) string {
+	return joinPaths("batches", strconv.Itoa(i.ID))
+}
+
+func viewConflictsPath() string {
+	return joinPaths("conflicts") + "/"
+}
+
+func checksumLookupPath() string {
+	return joinPaths("checksum") + "/"
+}
+
+func checksumPath(sum string) string {
+	return joinPaths("checksum", sum)
+}
+
+func comparePath() string {
+	return joinPaths("compare") + "/"
+}
+
+func resolveConflictPath(c *db.Conflict) string {
+	return joinPaths("conflicts", strconv.Itoa(c.ID), "resolve")
+}
+
+func addNotePath(pid string) string {
+	return joinPaths("annotations", pid, "notes")
+}
+
+func updateNotePath(n *db.Note) string {
+	return joinPaths("annotations", n.PublicID, "notes", strconv.Itoa(n.ID))
+}
+
+func deleteNotePath(n *db.Note) string {
+	return joinPaths("annotations", n.PublicID, "notes", strconv.Itoa(n.ID), "delete")
+}
+
+func addTagPath(pid string) string {
+	return joinPaths("annotations", pid, "tags")
+}
+
+func removeTagPath(pid string) string {
+	return joinPaths("annotations", pid, "tags", "delete")
+}
+
+// formatTime returns a human-friendly timestamp, or an empty string if t is
+// the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
 // stripCategoryFolder takes a string representing a path, and strips out the
 // current folder context, if any exists
 func stripCategoryFolder(f *db.Folder, path string) string {
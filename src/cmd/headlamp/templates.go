@@ -14,7 +14,7 @@ type Template struct {
 	*tmpl.Template
 }
 
-var home, browse, search, bulk, fsinfo, empty *Template
+var home, browse, search, searchHelp, bulk, fsinfo, jobList, job, batchList, batch, versions, conflictList, checksums, comparison, fileDetails, empty *Template
 
 func initTemplates(webroot string) {
 	webutil.Webroot = webroot
@@ -27,12 +27,22 @@ func initTemplates(webroot string) {
 	root.Funcs(tmpl.DefaultTemplateFunctions)
 	root.Funcs(webutil.FuncMap)
 	root.Funcs(localTemplateFuncs)
-	root.MustReadPartials("layout.go.html", "_search_form.go.html", "_tables.go.html")
+	root.MustReadPartials("layout.go.html", "_search_form.go.html", "_tables.go.html", "_annotations.go.html")
 	home = t("home")
 	browse = t("browse")
 	search = t("search")
+	searchHelp = t("search_help")
 	bulk = t("bulk")
 	fsinfo = t("fsinfo")
+	jobList = t("jobs")
+	job = t("job")
+	batchList = t("batches")
+	batch = t("batch")
+	versions = t("versions")
+	conflictList = t("conflicts")
+	checksums = t("checksums")
+	comparison = t("compare")
+	fileDetails = t("file")
 	empty = &Template{root.Template()}
 }
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// fileVersion wraps a version of a file with the archive dates of any other
+// versions which have the exact same content
+type fileVersion struct {
+	*db.File
+	IdenticalTo []string
+}
+
+// versionsHandler shows every archived version of a single public path
+func versionsHandler(w http.ResponseWriter, r *http.Request) {
+	var parts = getPathParts(r)
+	if len(parts) < 3 || parts[1] == "" {
+		_400(w, r, "Invalid request")
+		return
+	}
+
+	var op = rdbh.Operation()
+	var cName = parts[1]
+	var publicPath = filepath.Join(parts[2:]...)
+	var category, err = op.FindCategoryByName(cName)
+	var restrictions *db.Restrictions
+	if err == nil {
+		restrictions, err = viewerRestrictions(r)
+	}
+	if err != nil {
+		logger.Errorf("Error trying to read category %q from the database: %s", cName, err)
+		_500(w, r, fmt.Sprintf("Error trying to find category %q.  Try again or contact support.", cName))
+		return
+	}
+	if category == nil || restrictions.HidesCategory(category) {
+		_404(w, r, fmt.Sprintf("Category %q not found", cName))
+		return
+	}
+
+	var files []*db.File
+	files, err = op.GetFileVersions(category, publicPath)
+	if err != nil {
+		logger.Errorf("Error trying to read versions of %q (in category %q): %s", publicPath, cName, err)
+		_500(w, r, fmt.Sprintf("Error trying to read versions of %q.  Try again or contact support.", publicPath))
+		return
+	}
+	files = restrictions.FilterFiles(files)
+	if len(files) == 0 {
+		_404(w, r, fmt.Sprintf("File %q not found", publicPath))
+		return
+	}
+
+	versions.Render(w, r, vars{
+		"Title":      fmt.Sprintf("Headlamp: Versions of %s", publicPath),
+		"Category":   category,
+		"PublicPath": publicPath,
+		"Latest":     files[0],
+		"Versions":   buildVersions(files),
+	})
+}
+
+// buildVersions wraps each file and figures out which ones share a checksum
+func buildVersions(files []*db.File) []*fileVersion {
+	var dates = make(map[string][]string)
+	for _, f := range files {
+		dates[f.Checksum] = append(dates[f.Checksum], f.ArchiveDate)
+	}
+
+	var list []*fileVersion
+	for _, f := range files {
+		var v = &fileVersion{File: f}
+		for _, d := range dates[f.Checksum] {
+			if d != f.ArchiveDate {
+				v.IdenticalTo = append(v.IdenticalTo, d)
+			}
+		}
+		list = append(list, v)
+	}
+	return list
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"io"
+	"os"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/catalog"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func main() {
+	var _, infile = getCLI()
+
+	var in io.Reader = os.Stdin
+	if infile != "-" {
+		var f, err = os.Open(infile)
+		if err != nil {
+			logger.Fatalf("Unable to open %q: %s", infile, err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	var stats, err = catalog.Import(db.New(), in)
+	if err != nil {
+		logger.Fatalf("Unable to import catalog: %s", err)
+	}
+	logger.Infof("Imported %d records; %d new database rows created", stats.Records, stats.Created)
+}
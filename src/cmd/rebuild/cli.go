@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s [--force] [--no-swap] [--drop-restrictions] <settings file>", os.Args[0])
+	perr("")
+	perr(`Indexes every inventory into a new database file next to the live one,
+		copies over the data indexing can't recreate (events, restrictions,
+		conflict resolutions, notes, tags, and archive jobs), and compares the
+		new catalog to the live one.  If every inventory made it into the new
+		catalog with at least as many files and bytes as before, the live
+		database is swapped for the new one.  Running web servers, indexers,
+		and archivers switch to the new database on their own.`)
+	perr("")
+	perr(`--force swaps even if the new catalog is missing inventories or files.
+		--no-swap builds and compares the new catalog, but leaves the live
+		database alone.  --drop-restrictions swaps even if some restrictions
+		couldn't be matched to a folder or inventory in the new catalog, which
+		makes whatever they hid visible; --force doesn't do this.`)
+
+	os.Exit(status)
+}
+
+func getCLI() (conf *config.Config, force, noSwap, dropRestrictions bool) {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--force":
+			force = true
+		case "--no-swap":
+			noSwap = true
+		case "--drop-restrictions":
+			dropRestrictions = true
+		case "-h", "--help":
+			usage("")
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	if len(args) < 1 {
+		usage("You must specify a settings file")
+	}
+	if len(args) > 1 {
+		usage("Too many arguments")
+	}
+
+	var err error
+	conf, err = config.Read(args[0])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	return conf, force, noSwap, dropRestrictions
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/uoregon-libraries/gopkg/fileutil"
+	"github.com/uoregon-libraries/gopkg/interrupts"
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+	"github.com/uoregon-libraries/headlamp/src/indexer"
+)
+
+func main() {
+	var conf, force, noSwap, dropRestrictions = getCLI()
+
+	// There's no sense spending hours on a rebuild we can't swap in
+	if !noSwap {
+		var err = db.CheckSwappable()
+		if err != nil {
+			logger.Fatalf("Unable to rebuild: %s", err)
+		}
+	}
+
+	var live = db.New()
+	var path = db.RebuildPath(time.Now())
+	if fileutil.Exists(path) {
+		logger.Fatalf("Unable to rebuild: %q already exists", path)
+	}
+	var rebuilt = db.NewAt(path)
+	var err = rebuilt.CopySchema(live)
+	if err != nil {
+		logger.Fatalf("Unable to create %q: %s", path, err)
+	}
+
+	logger.Infof("Indexing into %q", path)
+	var interrupted int32
+	var i = indexer.New(rebuilt, conf)
+	interrupts.TrapIntTerm(func() {
+		atomic.StoreInt32(&interrupted, 1)
+		i.Stop()
+	})
+	err = i.Index()
+	if err != nil {
+		logger.Fatalf("Unable to index into %q: %s", path, err)
+	}
+	if atomic.LoadInt32(&interrupted) == 1 {
+		logger.Fatalf("Interrupted; the unfinished catalog in %q can be removed", path)
+	}
+
+	var ok bool
+	ok, err = compare(live, rebuilt)
+	if err != nil {
+		logger.Fatalf("Unable to compare catalogs: %s", err)
+	}
+	if !ok && !force {
+		logger.Errorf("The rebuilt catalog in %q is missing data; not swapping (use --force to swap anyway)", path)
+		os.Exit(1)
+	}
+	if noSwap {
+		_, err = carryOver(live, rebuilt)
+		if err != nil {
+			logger.Fatalf("Unable to copy data from the live catalog: %s", err)
+		}
+		logger.Infof("Rebuilt catalog left in %q", path)
+		return
+	}
+
+	swap(live, rebuilt, path, dropRestrictions)
+}
+
+// carryOver copies what indexing can't recreate from the live catalog into
+// the rebuilt one, and reports what was copied
+func carryOver(live, rebuilt *db.Database) (*db.CarryOverStats, error) {
+	var stats, err = db.CarryOver(live, rebuilt)
+	if err != nil {
+		return nil, err
+	}
+	reportCarryOver(stats)
+	return stats, nil
+}
+
+// swap brings the rebuilt catalog up to date and swaps it in.  Writes to the
+// live catalog are blocked from the start of the carry-over until the swap,
+// so nothing saved in between is left behind in the old file.
+//
+// A restriction which couldn't be carried over would leave what it hid open
+// to everybody, so unless dropRestrictions is set, the swap is called off.
+func swap(live, rebuilt *db.Database, path string, dropRestrictions bool) {
+	logger.Infof("Blocking changes to the live catalog while its data is copied")
+	var unlock, err = db.LockForSwap(live)
+	if err != nil {
+		logger.Fatalf("Unable to lock the live catalog: %s", err)
+	}
+
+	var old = live.File()
+	var stats *db.CarryOverStats
+	stats, err = carryOver(live, rebuilt)
+	if err != nil {
+		unlock()
+		logger.Fatalf("Unable to copy data from the live catalog: %s", err)
+	}
+	var skipped = stats.Skipped["restrictions"]
+	if skipped > 0 && !dropRestrictions {
+		unlock()
+		logger.Fatalf("%d restriction(s) couldn't be carried over to %q; not swapping "+
+			"(use --drop-restrictions to swap anyway, making what they hid visible)", skipped, path)
+	}
+	err = db.Swap(path)
+	unlock()
+	if err != nil {
+		logger.Fatalf("Unable to swap in %q: %s", path, err)
+	}
+	logger.Infof("Swapped in %q; the previous catalog is still in %q", path, old)
+}
+
+// reportCarryOver prints what was copied from the live catalog, and what was
+// left behind
+func reportCarryOver(stats *db.CarryOverStats) {
+	var kinds []string
+	for k := range stats.Copied {
+		kinds = append(kinds, k)
+	}
+	for k := range stats.Skipped {
+		if _, ok := stats.Copied[k]; !ok {
+			kinds = append(kinds, k)
+		}
+	}
+	sort.Strings(kinds)
+
+	fmt.Printf("%-24s %12s %12s\n", "Carried over", "Copied", "Skipped")
+	for _, k := range kinds {
+		fmt.Printf("%-24s %12d %12d\n", k, stats.Copied[k], stats.Skipped[k])
+	}
+	fmt.Println()
+}
+
+// compare prints the live and rebuilt catalogs' counts side by side, and any
+// inventory the rebuilt catalog is missing.  It returns false if the rebuilt
+// catalog lost any inventories, files, or bytes.  Categories and folders may
+// legitimately change, e.g. with a new archive path format, so those are
+// only reported.
+func compare(live, rebuilt *db.Database) (bool, error) {
+	var lop, rop = live.Operation(), rebuilt.Operation()
+	var lc, err = lop.CatalogCounts()
+	if err != nil {
+		return false, err
+	}
+	var rc *db.CatalogCounts
+	rc, err = rop.CatalogCounts()
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("%-24s %12s %12s\n", "Catalog", "Live", "Rebuilt")
+	fmt.Printf("%-24s %12d %12d\n", "categories", lc.Categories, rc.Categories)
+	fmt.Printf("%-24s %12d %12d\n", "inventories", lc.Inventories, rc.Inventories)
+	fmt.Printf("%-24s %12d %12d\n", "folders", lc.Folders, rc.Folders)
+	fmt.Printf("%-24s %12d %12d\n", "files", lc.Files, rc.Files)
+	fmt.Printf("%-24s %12d %12d\n", "bytes", lc.Bytes, rc.Bytes)
+	fmt.Println()
+
+	var liveInvs, rebuiltInvs []*db.Inventory
+	liveInvs, err = lop.AllInventories()
+	if err == nil {
+		rebuiltInvs, err = rop.AllInventories()
+	}
+	if err != nil {
+		return false, err
+	}
+	var seen = make(map[string]bool)
+	for _, inv := range rebuiltInvs {
+		seen[inv.Path] = true
+	}
+	var missing int
+	for _, inv := range liveInvs {
+		if !seen[inv.Path] {
+			fmt.Printf("Missing inventory: %s\n", inv.Path)
+			missing++
+		}
+	}
+
+	return missing == 0 && rc.Files >= lc.Files && rc.Bytes >= lc.Bytes, nil
+}
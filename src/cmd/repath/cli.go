@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s [--apply] <settings file>", os.Args[0])
+	perr("")
+	perr(`Re-derives every file's category, archive date, and public path from
+		its stored full path using the settings file's ARCHIVE_PATH_FORMAT, and
+		rebuilds the folder tree to match.  File ids don't change, and notes,
+		tags, metadata, events, restrictions, and conflicts are moved to the
+		files' and folders' new public ids.  Paths the format can't parse are
+		reported, and nothing is changed if there are any.`)
+	perr("")
+	perr(`Without --apply, this is a dry run: the work is done and reported, then
+		thrown away.  Stop the indexer before applying changes, and restart it
+		afterward.`)
+
+	os.Exit(status)
+}
+
+func getCLI() (conf *config.Config, apply bool) {
+	var args []string
+	for _, arg := range os.Args[1:] {
+		switch arg {
+		case "--apply":
+			apply = true
+		case "-h", "--help":
+			usage("")
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	if len(args) < 1 {
+		usage("You must specify a settings file")
+	}
+	if len(args) > 1 {
+		usage("Too many arguments")
+	}
+
+	var err error
+	conf, err = config.Read(args[0])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	return conf, apply
+}
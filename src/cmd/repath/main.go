@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// errDryRun rolls back the transaction when we're only reporting
+var errDryRun = errors.New("dry run")
+
+func main() {
+	var conf, apply = getCLI()
+	var dbh = db.New()
+
+	var r *repather
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		r = newRepather(op, conf)
+		var err = r.run()
+		if err == nil && (len(r.problems) > 0 || !apply) {
+			err = errDryRun
+		}
+		return err
+	})
+	if err != nil && err != errDryRun {
+		logger.Fatalf("Unable to recompute paths; no changes were made: %s", err)
+	}
+
+	if len(r.problems) > 0 {
+		for _, p := range r.problems {
+			fmt.Println(p)
+		}
+		logger.Errorf("Found %d problem(s) using path format %q; no changes were made", len(r.problems), conf.PathFormatString)
+		os.Exit(1)
+	}
+
+	for _, line := range r.summary {
+		fmt.Println(line)
+	}
+	if !apply {
+		logger.Infof("Dry run; no changes were made.  Use --apply to save them.")
+		return
+	}
+	logger.Infof("Recomputed paths using path format %q", conf.PathFormatString)
+}
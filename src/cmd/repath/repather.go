@@ -0,0 +1,492 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/uoregon-libraries/headlamp/src/config"
+	"github.com/uoregon-libraries/headlamp/src/db"
+	"github.com/uoregon-libraries/headlamp/src/indexer"
+)
+
+// batchSize is how many files are read into memory at once
+const batchSize = 5000
+
+// repather re-derives the catalog's categories, folders, and public paths
+// from each file's full path.  Everything happens in one transaction, so a
+// dry run is just a repath which gets rolled back.
+//
+// Each file's old and new values are staged in a temporary table before any
+// file is changed.  That lets us find files which would collide under the new
+// format before touching anything, and lets every table keyed by public id be
+// remapped with a single query.
+type repather struct {
+	op   *db.Operation
+	conf *config.Config
+
+	categories  map[string]*db.Category
+	folders     map[string]*db.Folder
+	realFolders map[string]bool
+
+	// folderIDs and folderPIDs map each old folder to the new folders which
+	// hold the same real folders.  A folder can become several if the new
+	// format splits its contents apart.
+	folderIDs  map[int][]int
+	folderPIDs map[string][]string
+
+	problems []string
+	summary  []string
+}
+
+func newRepather(op *db.Operation, conf *config.Config) *repather {
+	return &repather{
+		op:          op,
+		conf:        conf,
+		categories:  make(map[string]*db.Category),
+		folders:     make(map[string]*db.Folder),
+		realFolders: make(map[string]bool),
+		folderIDs:   make(map[int][]int),
+		folderPIDs:  make(map[string][]string),
+	}
+}
+
+func (r *repather) report(format string, args ...interface{}) {
+	r.summary = append(r.summary, fmt.Sprintf(format, args...))
+}
+
+func (r *repather) exec(sql string, args ...interface{}) int64 {
+	return r.op.Operation.Exec(sql, args...).RowsAffected()
+}
+
+func (r *repather) count(sql string, args ...interface{}) int {
+	var n int
+	var rows = r.op.Operation.Query(sql, args...)
+	if rows.Next() {
+		rows.Scan(&n)
+	}
+	rows.Close()
+	return n
+}
+
+// run does the repath.  If any paths can't be parsed or files would collide,
+// they're added to the problems list and the catalog is left partly changed,
+// so the caller must roll back.
+func (r *repather) run() error {
+	r.snapshot()
+	var err = r.stageFiles()
+	if err != nil {
+		return err
+	}
+	r.findCollisions()
+	if len(r.problems) > 0 || r.op.Operation.Err() != nil {
+		return r.op.Operation.Err()
+	}
+
+	r.applyFiles()
+	r.mapFolders()
+	r.remapFileData()
+	r.remapFolderData()
+	r.remapRestrictions()
+	r.remapConflicts()
+	r.aliasPublicIDs()
+	r.removeEmptyCategories()
+	r.op.RecomputeAggregates()
+	r.op.IndexAllWords()
+
+	r.exec("DROP TABLE repath")
+	r.exec("DROP TABLE repath_folders")
+	r.exec("DROP TABLE repath_real_folders")
+	return r.op.Operation.Err()
+}
+
+// snapshot stores what we need to know about the old folder tree, then
+// removes it so it can be built again from scratch
+func (r *repather) snapshot() {
+	r.exec(`CREATE TEMPORARY TABLE repath (
+		id INTEGER PRIMARY KEY,
+		old_public_id TEXT, old_category_id INTEGER, old_archive_date TEXT, old_public_path TEXT,
+		public_id TEXT, category_id INTEGER, archive_date TEXT, public_path TEXT,
+		folder_id INTEGER, depth INTEGER)`)
+	r.exec("CREATE INDEX repath_old_public_id ON repath (old_public_id)")
+	r.exec("CREATE INDEX repath_old_path ON repath (old_category_id, old_archive_date, old_public_path)")
+	r.exec("CREATE TEMPORARY TABLE repath_folders AS SELECT id, public_id FROM folders")
+	r.exec("CREATE TEMPORARY TABLE repath_real_folders AS SELECT folder_id, full_path FROM real_folders")
+	r.exec("CREATE INDEX repath_real_folders_full_path ON repath_real_folders (full_path)")
+
+	r.report("Folders before: %d", r.count("SELECT COUNT(*) FROM folders"))
+	r.exec("DELETE FROM real_folders")
+	r.exec("DELETE FROM folders")
+}
+
+// stageFiles works out every file's new category, folder, and paths
+func (r *repather) stageFiles() error {
+	var last uint64
+	for {
+		var files []*db.File
+		r.op.Files.Select().Where("id > ?", last).Order("id").Limit(batchSize).AllObjects(&files)
+		if len(files) == 0 || r.op.Operation.Err() != nil {
+			return r.op.Operation.Err()
+		}
+
+		for _, f := range files {
+			last = f.ID
+			var err = r.stageFile(f)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (r *repather) stageFile(f *db.File) error {
+	var catName, archiveDate, publicPath, err = indexer.ParsePath(f.FullPath, r.conf.PathFormat)
+	if err != nil {
+		r.problems = append(r.problems, fmt.Sprintf("%s: %s", f.FullPath, err))
+		return nil
+	}
+
+	var c = r.categories[catName]
+	if c == nil {
+		c, err = r.op.FindOrCreateCategory(catName)
+		if err != nil {
+			return fmt.Errorf("couldn't create category %q: %s", catName, err)
+		}
+		r.categories[catName] = c
+	}
+
+	var folder *db.Folder
+	folder, err = r.buildFolders(c, f.FullPath)
+	if err != nil {
+		return err
+	}
+	var fid int
+	if folder != nil {
+		fid = folder.ID
+	}
+
+	r.exec("INSERT INTO repath VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		f.ID, f.PublicID, f.CategoryID, f.ArchiveDate, f.PublicPath,
+		db.FilePublicID(c.Name, archiveDate, publicPath), c.ID, archiveDate, publicPath,
+		fid, strings.Count(publicPath, string(os.PathSeparator)))
+	return r.op.Operation.Err()
+}
+
+// buildFolders creates the public and real folders for each of the file's
+// directories the same way the indexer does, returning the folder the file
+// lives in, or nil if it's at the top of its category
+func (r *repather) buildFolders(c *db.Category, fullPath string) (*db.Folder, error) {
+	var parts = strings.Split(fullPath, string(os.PathSeparator))
+	var folder *db.Folder
+	var curPath string
+	for index, part := range parts[:len(parts)-1] {
+		curPath = filepath.Join(curPath, part)
+
+		// Nothing above the public path is exposed, so there are no folders there
+		if index < len(r.conf.PathFormat) {
+			continue
+		}
+
+		var _, _, publicPath, err = indexer.ParsePath(curPath, r.conf.PathFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		var key = fmt.Sprintf("%d/%s", c.ID, publicPath)
+		var next = r.folders[key]
+		if next == nil {
+			next, err = r.op.FindOrCreateFolder(c, folder, publicPath)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't build folder %q: %s", publicPath, err)
+			}
+			r.folders[key] = next
+		}
+		folder = next
+
+		if !r.realFolders[curPath] {
+			_, err = r.op.FindOrCreateRealFolder(folder, curPath)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't build real folder %q: %s", curPath, err)
+			}
+			r.realFolders[curPath] = true
+		}
+	}
+
+	return folder, nil
+}
+
+// findCollisions reports files which would end up with the same category,
+// archive date, and public path
+func (r *repather) findCollisions() {
+	var rows = r.op.Operation.Query(`SELECT c.name, r.archive_date, r.public_path, COUNT(*)
+		FROM repath r JOIN categories c ON c.id = r.category_id
+		GROUP BY r.category_id, r.archive_date, r.public_path HAVING COUNT(*) > 1`)
+	for rows.Next() {
+		var catName, archiveDate, publicPath string
+		var n int
+		rows.Scan(&catName, &archiveDate, &publicPath, &n)
+		r.problems = append(r.problems, fmt.Sprintf("%d files would all be %s/%s (%s)", n, catName, publicPath, archiveDate))
+	}
+	rows.Close()
+}
+
+// applyFiles moves each file to its staged values.  Every file first gets a
+// category id no other file can have, so the files' unique index can't trip
+// on two files trading places.
+func (r *repather) applyFiles() {
+	r.exec("UPDATE files SET category_id = -id")
+	r.exec(`UPDATE files SET
+		public_id = (SELECT public_id FROM repath WHERE repath.id = files.id),
+		category_id = (SELECT category_id FROM repath WHERE repath.id = files.id),
+		archive_date = (SELECT archive_date FROM repath WHERE repath.id = files.id),
+		public_path = (SELECT public_path FROM repath WHERE repath.id = files.id),
+		folder_id = (SELECT folder_id FROM repath WHERE repath.id = files.id),
+		depth = (SELECT depth FROM repath WHERE repath.id = files.id)`)
+
+	r.report("Files: %d", r.count("SELECT COUNT(*) FROM repath"))
+	r.report("Files with a new public id: %d", r.count("SELECT COUNT(*) FROM repath WHERE public_id <> old_public_id"))
+	r.report("Folders after: %d", r.count("SELECT COUNT(*) FROM folders"))
+}
+
+// mapFolders matches each old folder to the new folders holding its real
+// folders
+func (r *repather) mapFolders() {
+	var rows = r.op.Operation.Query(`SELECT DISTINCT o.id, o.public_id, n.id, n.public_id
+		FROM real_folders nrf
+		JOIN repath_real_folders orf ON orf.full_path = nrf.full_path
+		JOIN repath_folders o ON o.id = orf.folder_id
+		JOIN folders n ON n.id = nrf.folder_id
+		ORDER BY o.id, n.id`)
+	for rows.Next() {
+		var oldID, newID int
+		var oldPID, newPID string
+		rows.Scan(&oldID, &oldPID, &newID, &newPID)
+		r.folderIDs[oldID] = append(r.folderIDs[oldID], newID)
+		r.folderPIDs[oldPID] = append(r.folderPIDs[oldPID], newPID)
+	}
+	rows.Close()
+}
+
+// remapFileData moves everything attached to a file's public id to its new
+// one.  Tags get a placeholder first, since their unique index could trip on
+// two files trading public ids.
+func (r *repather) remapFileData() {
+	const changed = "(SELECT old_public_id FROM repath WHERE old_public_id <> public_id)"
+	var remap = func(table, col string) int64 {
+		return r.exec(fmt.Sprintf(`UPDATE %[1]s SET
+			%[2]s = (SELECT public_id FROM repath WHERE old_public_id = %[1]s.%[2]s)
+			WHERE %[2]s IN %[3]s`, table, col, changed))
+	}
+
+	r.report("File events moved: %d", remap("events", "file_public_id"))
+	r.report("File notes moved: %d", remap("notes", "public_id"))
+	r.report("File metadata values moved: %d", remap("metadata", "public_id"))
+
+	r.exec("UPDATE tags SET public_id = '~' || public_id WHERE public_id IN " + changed)
+	var n = r.exec(`UPDATE tags SET
+		public_id = (SELECT public_id FROM repath WHERE old_public_id = substr(tags.public_id, 2))
+		WHERE public_id LIKE '~%'`)
+	r.report("File tags moved: %d", n)
+}
+
+// remapFolderData moves folders' notes, tags, and metadata to the new folders
+// holding the same real folders.  Anything on a folder which no longer exists
+// is left alone and reported.
+func (r *repather) remapFolderData() {
+	var moved, orphaned = make(map[string]int), make(map[string]int)
+	var targets = func(kind, pid string) []string {
+		var pids, ok = r.folderPIDs[pid]
+		if !ok {
+			orphaned[kind]++
+			return nil
+		}
+		if len(pids) == 1 && pids[0] == pid {
+			return nil
+		}
+		moved[kind]++
+		return pids
+	}
+
+	var notes []*db.Note
+	r.op.Notes.Select().Where("public_id LIKE 'd%'").Order("id").AllObjects(&notes)
+	for _, n := range notes {
+		for i, pid := range targets("notes", n.PublicID) {
+			if i > 0 {
+				n.ID = 0
+			}
+			n.PublicID = pid
+			r.op.Notes.Save(n)
+		}
+	}
+
+	var list []*db.Metadata
+	r.op.Metadata.Select().Where("public_id LIKE 'd%'").Order("id").AllObjects(&list)
+	for _, m := range list {
+		for i, pid := range targets("metadata values", m.PublicID) {
+			if i > 0 {
+				m.ID = 0
+			}
+			m.PublicID = pid
+			r.op.Metadata.Save(m)
+		}
+	}
+
+	// Tags are removed before any are added back so a tag can't collide with
+	// itself on a folder which swapped public ids with another
+	var tags, moving []*db.Tag
+	var tagPIDs = make(map[*db.Tag][]string)
+	r.op.Tags.Select().Where("public_id LIKE 'd%'").Order("id").AllObjects(&tags)
+	for _, t := range tags {
+		var pids = targets("tags", t.PublicID)
+		if len(pids) > 0 {
+			r.exec("DELETE FROM tags WHERE id = ?", t.ID)
+			moving = append(moving, t)
+			tagPIDs[t] = pids
+		}
+	}
+	for _, t := range moving {
+		for _, pid := range tagPIDs[t] {
+			if r.op.Tags.Select().Where("public_id = ? AND tag = ?", pid, t.Tag).Count().RowCount() == 0 {
+				var nt = *t
+				nt.ID, nt.PublicID = 0, pid
+				r.op.Tags.Save(&nt)
+			}
+		}
+	}
+
+	for _, kind := range []string{"notes", "tags", "metadata values"} {
+		r.report("Folder %s moved: %d", kind, moved[kind])
+		if orphaned[kind] > 0 {
+			r.report("Folder %s left on folders which no longer exist: %d", kind, orphaned[kind])
+		}
+	}
+}
+
+// remapRestrictions points category and folder restrictions at the new
+// categories and folders.  If the old one was split, the restriction is
+// copied so it still covers everything it did.  See orphanedRestriction for
+// folder restrictions whose folder is gone entirely.
+func (r *repather) remapRestrictions() {
+	var categoryIDs = make(map[int][]int)
+	var rows = r.op.Operation.Query("SELECT DISTINCT old_category_id, category_id FROM repath ORDER BY category_id")
+	for rows.Next() {
+		var oldID, newID int
+		rows.Scan(&oldID, &newID)
+		categoryIDs[oldID] = append(categoryIDs[oldID], newID)
+	}
+	rows.Close()
+
+	var list, _ = r.op.AllRestrictions()
+	for _, rs := range list {
+		var ids []int
+		var field *int
+		switch {
+		case rs.CategoryID != 0:
+			ids, field = categoryIDs[rs.CategoryID], &rs.CategoryID
+			if len(ids) == 0 {
+				continue
+			}
+		case rs.FolderID != 0:
+			ids, field = r.folderIDs[rs.FolderID], &rs.FolderID
+			if len(ids) == 0 {
+				r.orphanedRestriction(rs)
+				continue
+			}
+		default:
+			continue
+		}
+
+		var origID = rs.ID
+		for i, id := range ids {
+			if i > 0 {
+				rs.ID = 0
+			}
+			*field = id
+			r.op.Restrictions.Save(rs)
+		}
+		if len(ids) > 1 {
+			r.report("Restriction %d copied to cover %d categories or folders", origID, len(ids))
+		}
+	}
+}
+
+// orphanedRestriction deals with a restriction on a folder which has no new
+// folder holding any of its real folders.  If the folder held no files, the
+// restriction hid nothing, so it's removed; its folder id could be reused.
+// Otherwise its files are now above any folder (e.g., the new format moved
+// the folder's name into the category), and dropping the restriction would
+// show everybody what it hid, so it's reported as a problem instead.
+func (r *repather) orphanedRestriction(rs *db.Restriction) {
+	var n = r.count(`SELECT COUNT(*) FROM repath_real_folders orf JOIN files f
+		ON SUBSTR(f.full_path, 1, LENGTH(orf.full_path) + 1) = orf.full_path || '/'
+		WHERE orf.folder_id = ?`, rs.FolderID)
+	if n > 0 {
+		r.problems = append(r.problems, fmt.Sprintf("Restriction %d: its folder's %d file(s) wouldn't be "+
+			"in any folder; remove the restriction or restrict their category instead", rs.ID, n))
+		return
+	}
+
+	r.exec("DELETE FROM restrictions WHERE id = ?", rs.ID)
+	r.report("Restriction %d removed: its folder no longer exists", rs.ID)
+}
+
+// remapConflicts updates the category and paths conflicts refer to.
+// Conflicts from rejected inventories describe files which were never
+// stored, so those keep their old paths.
+func (r *repather) remapConflicts() {
+	var list []*db.Conflict
+	r.op.Conflicts.Select().Order("id").AllObjects(&list)
+	var n int
+	for _, c := range list {
+		var rows = r.op.Operation.Query(`SELECT category_id, archive_date, public_path FROM repath
+			WHERE old_category_id = ? AND old_archive_date = ? AND old_public_path = ?`,
+			c.CategoryID, c.ArchiveDate, c.PublicPath)
+		var found = rows.Next()
+		var moved = *c
+		if found {
+			rows.Scan(&moved.CategoryID, &moved.ArchiveDate, &moved.PublicPath)
+		}
+		rows.Close()
+		if found && moved != *c {
+			r.op.Conflicts.Save(&moved)
+			n++
+		}
+	}
+	r.report("Conflicts moved: %d", n)
+}
+
+// aliasPublicIDs keeps links to old public ids working.  Files which got a
+// new id are simple; a folder which no longer exists is aliased to the first
+// of the new folders holding its contents.
+func (r *repather) aliasPublicIDs() {
+	var aliases = make(map[string]string)
+	var rows = r.op.Operation.Query("SELECT old_public_id, public_id FROM repath WHERE old_public_id <> public_id")
+	for rows.Next() {
+		var old, pid string
+		rows.Scan(&old, &pid)
+		aliases[old] = pid
+	}
+	rows.Close()
+
+	for old, pids := range r.folderPIDs {
+		var kept bool
+		for _, pid := range pids {
+			kept = kept || pid == old
+		}
+		if !kept {
+			aliases[old] = pids[0]
+		}
+	}
+
+	r.op.AddPublicIDAliases(aliases)
+	r.report("Old public ids which now lead to the new ones: %d", len(aliases))
+}
+
+// removeEmptyCategories removes categories which had files before the repath
+// and have none now
+func (r *repather) removeEmptyCategories() {
+	var n = r.exec(`DELETE FROM categories WHERE id IN (SELECT old_category_id FROM repath)
+		AND id NOT IN (SELECT category_id FROM files)`)
+	r.report("Categories removed: %d", n)
+}
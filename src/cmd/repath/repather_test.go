@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uoregon-libraries/headlamp/src/config"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// migrationsDir is found before any test changes directories
+var migrationsDir, _ = filepath.Abs("../../../db/migrations")
+
+// newCatalog creates a catalog in a temporary directory with every migration
+// applied, holding a file for each of the given full paths.  The files'
+// categories and public paths are placeholders until the first repath.
+func newCatalog(t *testing.T, paths []string) *db.Database {
+	t.Helper()
+	var path = filepath.Join(t.TempDir(), "da.db")
+	var raw, err = sql.Open("sqlite3_headlamp", "file:"+path)
+	if err != nil {
+		t.Fatalf("Unable to create %q: %s", path, err)
+	}
+	var migrations []string
+	migrations, err = filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("Unable to find migrations: %v", err)
+	}
+	for _, m := range migrations {
+		var data, err = ioutil.ReadFile(m)
+		if err != nil {
+			t.Fatalf("Unable to read %s: %s", m, err)
+		}
+		_, err = raw.Exec(strings.SplitN(string(data), "-- +goose Down", 2)[0])
+		if err != nil {
+			t.Fatalf("Unable to apply %s: %s", m, err)
+		}
+	}
+	raw.Close()
+
+	var dbh = db.NewAt(path)
+	var op = dbh.Operation()
+	for _, p := range paths {
+		op.Files.Save(&db.File{ArchiveDate: "2020-01-01", Name: filepath.Base(p), FullPath: p,
+			PublicPath: p, PublicID: p, Checksum: "abc", Filesize: 10})
+	}
+	err = op.Operation.Err()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+	return dbh
+}
+
+// repath runs a repather with the given path format, committing its changes
+// unless it finds problems, as the command does with --apply
+func repath(t *testing.T, dbh *db.Database, format ...config.PathToken) *repather {
+	t.Helper()
+	var r *repather
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		r = newRepather(op, &config.Config{PathFormat: format})
+		var err = r.run()
+		if err == nil && len(r.problems) > 0 {
+			err = errDryRun
+		}
+		return err
+	})
+	if err != nil && err != errDryRun {
+		t.Fatalf("Unable to repath: %s", err)
+	}
+	return r
+}
+
+// TestRepath moves a catalog from "category/ignore/date" to
+// "ignore/category/date", which swaps two folders' and two files' public
+// ids, and splits a folder in two.  Restrictions, notes, and tags must
+// follow the real folders and files they were on.
+func TestRepath(t *testing.T) {
+	var dbh = newCatalog(t, []string{
+		"p/q/2020-01-01/box/f.tif",
+		"q/p/2020-01-01/box/f.tif",
+		"p/r/2020-01-01/box/g.tif",
+	})
+	var r = repath(t, dbh, config.Category, config.Ignored, config.Date)
+	if len(r.problems) > 0 {
+		t.Fatalf("Unexpected problems setting up the catalog: %q", r.problems)
+	}
+
+	// Before: p:box holds p/q/.../box and p/r/.../box, and q:box holds
+	// q/p/.../box
+	var op = dbh.Operation()
+	var pBox, qBox, rBox = db.FolderPublicID("p", "box"), db.FolderPublicID("q", "box"), db.FolderPublicID("r", "box")
+	var pFile, qFile = db.FilePublicID("p", "2020-01-01", "box/f.tif"), db.FilePublicID("q", "2020-01-01", "box/f.tif")
+	var folder, err = op.FindFolderByPublicID(pBox)
+	if err != nil || folder == nil {
+		t.Fatalf("Unable to find folder %q: %v", pBox, err)
+	}
+	op.WriteRestriction(&db.Restriction{CreatedAt: time.Now(), FolderID: folder.ID})
+	op.AddNote(pBox, "somebody", "folder note")
+	op.AddNote(pFile, "somebody", "file note")
+	op.AddTag(pBox, "shared", "somebody")
+	op.AddTag(qBox, "shared", "somebody")
+	op.AddTag(qBox, "only-q", "somebody")
+	op.AddTag(pFile, "file-tag", "somebody")
+	err = op.Operation.Err()
+	if err != nil {
+		t.Fatalf("Unable to annotate catalog: %s", err)
+	}
+
+	// After: the files trade public ids, as do p:box and q:box, and the old
+	// p:box is split into q:box and r:box
+	r = repath(t, dbh, config.Ignored, config.Category, config.Date)
+	if len(r.problems) > 0 {
+		t.Fatalf("Unexpected problems: %q", r.problems)
+	}
+
+	var restricted []string
+	var list, _ = op.AllRestrictions()
+	for _, rs := range list {
+		var f = &db.Folder{}
+		if op.Folders.Select().Where("id = ?", rs.FolderID).First(f) {
+			restricted = append(restricted, f.PublicID)
+		}
+	}
+	sort.Strings(restricted)
+	var want = []string{qBox, rBox}
+	sort.Strings(want)
+	if !equalStrings(restricted, want) {
+		t.Errorf("Restricted folders: got %q, expected %q", restricted, want)
+	}
+
+	var tests = []struct {
+		pid   string
+		notes []string
+		tags  []string
+	}{
+		{pid: pBox, tags: []string{"only-q", "shared"}},
+		{pid: qBox, notes: []string{"folder note"}, tags: []string{"shared"}},
+		{pid: rBox, notes: []string{"folder note"}, tags: []string{"shared"}},
+		{pid: pFile},
+		{pid: qFile, notes: []string{"file note"}, tags: []string{"file-tag"}},
+	}
+	for _, tc := range tests {
+		var notes, tags []string
+		var nlist, _ = op.GetNotes(tc.pid)
+		for _, n := range nlist {
+			notes = append(notes, n.Body)
+		}
+		var tlist, _ = op.GetTags(tc.pid)
+		for _, tag := range tlist {
+			tags = append(tags, tag.Tag)
+		}
+		sort.Strings(tags)
+		if !equalStrings(notes, tc.notes) || !equalStrings(tags, tc.tags) {
+			t.Errorf("%s: got notes %q and tags %q, expected %q and %q", tc.pid, notes, tags, tc.notes, tc.tags)
+		}
+	}
+	err = op.Operation.Err()
+	if err != nil {
+		t.Fatalf("Unable to read catalog: %s", err)
+	}
+
+	// Ignoring the "box" directory leaves the restricted folders' files in no
+	// folder at all, so the restrictions have nothing to move to
+	r = repath(t, dbh, config.Ignored, config.Category, config.Date, config.Ignored)
+	if len(r.problems) != 2 || !strings.Contains(r.problems[0], "wouldn't be in any folder") {
+		t.Errorf("Expected a problem for each restriction, got %q", r.problems)
+	}
+	list, _ = op.AllRestrictions()
+	if len(list) != 2 {
+		t.Errorf("Expected the repath to be rolled back, but there are %d restrictions", len(list))
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
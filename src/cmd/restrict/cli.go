@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s <settings file> list", os.Args[0])
+	perrf("       %s <settings file> add (--category NAME | --folder CATEGORY/PATH | "+
+		"--inventory PATH) [--until YYYY-MM-DD] [--audience \"login login ...\"] [--note TEXT]", os.Args[0])
+	perrf("       %s <settings file> remove <id>", os.Args[0])
+	perr("")
+	perr(`Lists, adds, or removes access restrictions.  A restriction hides a
+		category, a folder (and everything under it), or the files described by
+		an inventory from everybody except the logins in its audience.  With
+		--until, the restriction is an embargo which lifts on the given date;
+		otherwise it never lifts.`)
+	perr("")
+	perr(`Inventory paths are relative to the dark archive root, exactly as shown
+		on the web server's batch pages.`)
+
+	os.Exit(status)
+}
+
+// command holds everything parsed from the command line
+type command struct {
+	action    string
+	category  string
+	folder    string
+	inventory string
+	until     string
+	audience  string
+	note      string
+	id        int
+}
+
+func getCLI() (*config.Config, *command) {
+	if len(os.Args) < 3 {
+		usage("You must specify a settings file and an action")
+	}
+
+	var cmd = &command{action: os.Args[2]}
+	var args = os.Args[3:]
+	switch cmd.action {
+	case "list":
+		if len(args) > 0 {
+			usage("Too many arguments")
+		}
+
+	case "add":
+		parseAddArgs(cmd, args)
+
+	case "remove":
+		if len(args) != 1 {
+			usage("You must specify exactly one restriction id to remove")
+		}
+		var err error
+		cmd.id, err = strconv.Atoi(args[0])
+		if err != nil || cmd.id < 1 {
+			usage(fmt.Sprintf("Invalid restriction id %q", args[0]))
+		}
+
+	case "-h", "--help":
+		usage("")
+
+	default:
+		usage(fmt.Sprintf("Unknown action %q", cmd.action))
+	}
+
+	var c, err = config.Read(os.Args[1])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	return c, cmd
+}
+
+func parseAddArgs(cmd *command, args []string) {
+	var targets = 0
+	for len(args) > 0 {
+		var flag = args[0]
+		if len(args) < 2 {
+			usage(fmt.Sprintf("Missing value for %q", flag))
+		}
+		var val = args[1]
+		args = args[2:]
+
+		switch flag {
+		case "--category":
+			cmd.category = val
+			targets++
+		case "--folder":
+			cmd.folder = val
+			targets++
+		case "--inventory":
+			cmd.inventory = val
+			targets++
+		case "--until":
+			var _, err = time.Parse("2006-01-02", val)
+			if err != nil {
+				usage(fmt.Sprintf("Invalid date %q: must be YYYY-MM-DD", val))
+			}
+			cmd.until = val
+		case "--audience":
+			cmd.audience = strings.Join(strings.Fields(val), " ")
+		case "--note":
+			cmd.note = val
+		default:
+			usage(fmt.Sprintf("Unknown option %q", flag))
+		}
+	}
+
+	if targets != 1 {
+		usage("You must specify exactly one of --category, --folder, or --inventory")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func main() {
+	var _, cmd = getCLI()
+	var dbh = db.New()
+
+	switch cmd.action {
+	case "list":
+		list(dbh.Operation())
+	case "add":
+		add(dbh, cmd)
+	case "remove":
+		remove(dbh, cmd.id)
+	}
+}
+
+func list(op *db.Operation) {
+	var all, err = op.AllRestrictions()
+	if err != nil {
+		logger.Fatalf("Unable to read restrictions: %s", err)
+	}
+
+	var now = time.Now()
+	for _, rs := range all {
+		var target string
+		target, err = op.RestrictionTarget(rs)
+		if err != nil {
+			logger.Fatalf("Unable to read restriction %d: %s", rs.ID, err)
+		}
+
+		var until = "never lifts"
+		if rs.EmbargoUntil != "" {
+			until = "until " + rs.EmbargoUntil
+		}
+		if !rs.Active(now) {
+			until = "lifted " + rs.EmbargoUntil
+		}
+		var audience = rs.Audience
+		if audience == "" {
+			audience = "(nobody)"
+		}
+
+		var added = "added " + rs.CreatedAt.Format("2006-01-02")
+		if rs.CreatedBy != "" {
+			added += " by " + rs.CreatedBy
+		}
+
+		fmt.Printf("%d\t%s\t%s\taudience: %s\t%s", rs.ID, target, until, audience, added)
+		if rs.Note != "" {
+			fmt.Printf("\t%s", rs.Note)
+		}
+		fmt.Println()
+	}
+}
+
+func add(dbh *db.Database, cmd *command) {
+	var op = dbh.Operation()
+	var rs = &db.Restriction{
+		CreatedAt:    time.Now(),
+		CreatedBy:    os.Getenv("USER"),
+		EmbargoUntil: cmd.until,
+		Audience:     cmd.audience,
+		Note:         cmd.note,
+	}
+
+	switch {
+	case cmd.category != "":
+		var c = findCategory(op, cmd.category)
+		rs.CategoryID = c.ID
+
+	case cmd.folder != "":
+		var parts = strings.SplitN(cmd.folder, "/", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			logger.Errorf("Folder %q must be given as CATEGORY/PATH", cmd.folder)
+			os.Exit(1)
+		}
+		var c = findCategory(op, parts[0])
+		var f, err = op.FindFolderByPath(c, strings.Trim(parts[1], "/"))
+		if err != nil {
+			logger.Fatalf("Unable to look up folder %q: %s", cmd.folder, err)
+		}
+		if f == nil {
+			logger.Errorf("No folder found with path %q", cmd.folder)
+			os.Exit(1)
+		}
+		rs.FolderID = f.ID
+
+	case cmd.inventory != "":
+		var inv, err = op.FindInventoryByPath(cmd.inventory)
+		if err != nil {
+			logger.Fatalf("Unable to look up inventory %q: %s", cmd.inventory, err)
+		}
+		if inv == nil {
+			logger.Errorf("No inventory found with path %q", cmd.inventory)
+			os.Exit(1)
+		}
+		rs.InventoryID = inv.ID
+	}
+
+	var err = dbh.InTransaction(func(op *db.Operation) error { return op.WriteRestriction(rs) })
+	if err != nil {
+		logger.Fatalf("Unable to save restriction: %s", err)
+	}
+	logger.Infof("Added restriction %d", rs.ID)
+}
+
+// findCategory looks up a category by name, exiting if it doesn't exist
+func findCategory(op *db.Operation, name string) *db.Category {
+	var c, err = op.FindCategoryByName(name)
+	if err != nil {
+		logger.Fatalf("Unable to look up category %q: %s", name, err)
+	}
+	if c == nil {
+		logger.Errorf("No category found with name %q", name)
+		os.Exit(1)
+	}
+	return c
+}
+
+func remove(dbh *db.Database, id int) {
+	var ok bool
+	var err = dbh.InTransaction(func(op *db.Operation) error {
+		var err error
+		ok, err = op.DeleteRestriction(id)
+		return err
+	})
+	if err != nil {
+		logger.Fatalf("Unable to remove restriction %d: %s", id, err)
+	}
+	if !ok {
+		logger.Errorf("No restriction found with id %d", id)
+		os.Exit(1)
+	}
+	logger.Infof("Removed restriction %d", id)
+}
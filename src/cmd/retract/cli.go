@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/wordutils"
+	"github.com/uoregon-libraries/headlamp/src/config"
+)
+
+var spaces = regexp.MustCompile(`\s+`)
+
+func perrraw(s string) {
+	fmt.Fprintln(os.Stderr, s)
+}
+
+func perr(s string) {
+	s = strings.TrimSpace(s)
+	s = spaces.ReplaceAllString(s, " ")
+	perrraw(wordutils.Wrap(s, 80))
+}
+func perrf(s string, args ...interface{}) {
+	perr(fmt.Sprintf(s, args...))
+}
+
+func usage(msg string) {
+	var status = 0
+	if msg != "" {
+		perr(msg)
+		perr("")
+		status = 1
+	}
+
+	perrf("Usage: %s <settings file> <inventory path>", os.Args[0])
+	perr("")
+	perr(`Removes an inventory and every file it describes from the catalog, and
+		updates the file totals of the affected folders and categories.  The
+		inventory path is relative to the dark archive root, exactly as shown on
+		the web server's batch pages.`)
+	perr("")
+	perr(`The inventory file itself must be moved out of the dark archive or
+		renamed first, otherwise the indexer will simply index it again.`)
+
+	os.Exit(status)
+}
+
+func getCLI() (*config.Config, string) {
+	if len(os.Args) < 3 {
+		usage("You must specify a settings file and an inventory path")
+	}
+	if len(os.Args) > 3 {
+		usage("Too many arguments")
+	}
+
+	var c, err = config.Read(os.Args[1])
+	if err != nil {
+		perrf("Invalid configuration: %s", err)
+		os.Exit(1)
+	}
+
+	return c, os.Args[2]
+}
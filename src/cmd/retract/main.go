@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/uoregon-libraries/gopkg/fileutil"
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func main() {
+	var conf, invPath = getCLI()
+
+	if fileutil.Exists(filepath.Join(conf.DARoot, invPath)) {
+		logger.Errorf("Inventory file %q still exists; move or rename it before retracting", invPath)
+		os.Exit(1)
+	}
+
+	var dbh = db.New()
+	var inv, err = dbh.Operation().FindInventoryByPath(invPath)
+	if err != nil {
+		logger.Fatalf("Unable to look up inventory %q: %s", invPath, err)
+	}
+	if inv == nil {
+		logger.Errorf("No inventory found with path %q", invPath)
+		os.Exit(1)
+	}
+
+	var removed int64
+	err = dbh.InTransaction(func(op *db.Operation) error {
+		var err error
+		removed, err = op.RetractInventory(inv)
+		if err != nil {
+			return err
+		}
+
+		var ev = db.NewInventoryEvent(db.EventDeaccession, inv, db.SoftwareAgent("retract"), db.AgentSoftware)
+		ev.Detail = fmt.Sprintf("Inventory retracted; removed %d file record(s)", removed)
+		return op.WriteEvents(ev)
+	})
+	if err != nil {
+		logger.Fatalf("Unable to retract inventory %q: %s", invPath, err)
+	}
+	logger.Infof("Retracted inventory %q and its %d file record(s)", invPath, removed)
+}
@@ -0,0 +1,180 @@
+// Package compare checks a set of local files, read from a directory or a
+// checksum manifest, against the catalog to see what a transfer would add
+package compare
+
+import (
+	"encoding/json"
+	"io"
+	"path"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// Entry is one local file: its path, relative to the directory or manifest,
+// and its SHA256 checksum
+type Entry struct {
+	Path     string
+	Checksum string
+}
+
+// How a local file compares to the catalog
+const (
+	StatusArchived  = "archived"  // The same content is archived at the same path
+	StatusChanged   = "changed"   // Something different is archived at the same path
+	StatusElsewhere = "elsewhere" // The same content is archived, but at another path
+	StatusNew       = "new"       // Neither the path nor the content is archived
+)
+
+// Statuses lists every status in the order reports show them
+var Statuses = []string{StatusChanged, StatusNew, StatusElsewhere, StatusArchived}
+
+// Result is how a single local file compares to the catalog
+type Result struct {
+	Entry
+	PublicPath string     // The path the file would have in the catalog
+	Status     string     // One of the Status constants
+	Matches    []*db.File // Archived files with the same content, anywhere
+	Versions   []*db.File // Archived files at the same path
+}
+
+// Report holds the comparison of every local file
+type Report struct {
+	Category *db.Category // The category compared against, or nil for all
+	Folder   string       // The folder the local files' paths are under
+	Results  []*Result
+	Counts   map[string]int
+}
+
+// Compare looks up each entry in the catalog, by checksum and by path.  An
+// entry's path within the catalog is its local path under folder, in
+// category c; if c is nil, paths are compared in every category.  Content
+// is looked for in every category either way.  Files hidden by r are
+// ignored.
+func Compare(op *db.Operation, entries []Entry, c *db.Category, folder string, r *db.Restrictions) (*Report, error) {
+	var rpt = &Report{Category: c, Folder: folder, Counts: make(map[string]int)}
+	var sums, paths []string
+	for _, e := range entries {
+		var res = &Result{Entry: e, PublicPath: path.Join(folder, e.Path)}
+		rpt.Results = append(rpt.Results, res)
+		sums = append(sums, e.Checksum)
+		paths = append(paths, res.PublicPath)
+	}
+
+	var bySum, err = op.GetFilesByChecksums(sums, r)
+	var byPath []*db.File
+	if err == nil {
+		byPath, err = op.GetFilesByPublicPaths(paths, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var matches = make(map[string][]*db.File)
+	for _, f := range bySum {
+		matches[f.Checksum] = append(matches[f.Checksum], f)
+	}
+	var versions = make(map[string][]*db.File)
+	for _, f := range byPath {
+		if c == nil || f.CategoryID == c.ID {
+			versions[f.PublicPath] = append(versions[f.PublicPath], f)
+		}
+	}
+
+	for _, res := range rpt.Results {
+		res.Matches = matches[res.Checksum]
+		res.Versions = versions[res.PublicPath]
+		res.Status = res.status()
+		rpt.Counts[res.Status]++
+	}
+	return rpt, nil
+}
+
+func (res *Result) status() string {
+	for _, f := range res.Versions {
+		if f.Checksum == res.Checksum {
+			return StatusArchived
+		}
+	}
+	if len(res.Versions) > 0 {
+		return StatusChanged
+	}
+	if len(res.Matches) > 0 {
+		return StatusElsewhere
+	}
+	return StatusNew
+}
+
+// WithStatus returns the results with the given status
+func (rpt *Report) WithStatus(status string) []*Result {
+	var list []*Result
+	for _, res := range rpt.Results {
+		if res.Status == status {
+			list = append(list, res)
+		}
+	}
+	return list
+}
+
+// jsonFile describes an archived file in a report's JSON output
+type jsonFile struct {
+	Category    string `json:"category"`
+	PublicPath  string `json:"public_path"`
+	ArchiveDate string `json:"archive_date"`
+	Checksum    string `json:"checksum"`
+	PublicID    string `json:"public_id"`
+}
+
+type jsonResult struct {
+	Path       string     `json:"path"`
+	Checksum   string     `json:"checksum"`
+	PublicPath string     `json:"public_path"`
+	Status     string     `json:"status"`
+	Matches    []jsonFile `json:"matches"`
+	Versions   []jsonFile `json:"versions"`
+}
+
+type jsonReport struct {
+	Category string         `json:"category,omitempty"`
+	Folder   string         `json:"folder,omitempty"`
+	Counts   map[string]int `json:"counts"`
+	Files    []jsonResult   `json:"files"`
+}
+
+func newJSONFiles(files []*db.File) []jsonFile {
+	var list = []jsonFile{}
+	for _, f := range files {
+		list = append(list, jsonFile{
+			Category:    f.Category.Name,
+			PublicPath:  f.PublicPath,
+			ArchiveDate: f.ArchiveDate,
+			Checksum:    f.Checksum,
+			PublicID:    f.PublicID,
+		})
+	}
+	return list
+}
+
+// WriteJSON writes the report to w as a single JSON document
+func (rpt *Report) WriteJSON(w io.Writer) error {
+	var jr = jsonReport{Folder: rpt.Folder, Counts: make(map[string]int), Files: []jsonResult{}}
+	if rpt.Category != nil {
+		jr.Category = rpt.Category.Name
+	}
+	for _, status := range Statuses {
+		jr.Counts[status] = rpt.Counts[status]
+	}
+	for _, res := range rpt.Results {
+		jr.Files = append(jr.Files, jsonResult{
+			Path:       res.Path,
+			Checksum:   res.Checksum,
+			PublicPath: res.PublicPath,
+			Status:     res.Status,
+			Matches:    newJSONFiles(res.Matches),
+			Versions:   newJSONFiles(res.Versions),
+		})
+	}
+
+	var enc = json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jr)
+}
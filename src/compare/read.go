@@ -0,0 +1,124 @@
+package compare
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var sha256RE = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// bagitPayload is the folder a BagIt manifest's paths all start with
+const bagitPayload = "data/"
+
+// Read returns the entries for a directory, by hashing every file in it, or
+// for a manifest file
+func Read(name string) ([]Entry, error) {
+	var info, err = os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return HashDir(name)
+	}
+
+	var f *os.File
+	f, err = os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadManifest(f)
+}
+
+// ReadManifest reads a sha256sum output file or a BagIt manifest
+// (manifest-sha256.txt).  Each line is a checksum, whitespace, and a path; a
+// "*" before the path (sha256sum's binary mode) is ignored.  If every path is
+// under BagIt's "data/" folder, that prefix is removed so paths are relative
+// to the bag's payload.
+func ReadManifest(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var s = bufio.NewScanner(r)
+	var lineNum int
+	var bagit = true
+	for s.Scan() {
+		lineNum++
+		var line = strings.TrimSpace(s.Text())
+		if line == "" {
+			continue
+		}
+
+		var idx = strings.IndexAny(line, " \t")
+		if idx < 0 {
+			return nil, fmt.Errorf("line %d: expected a checksum and a path", lineNum)
+		}
+		var sum = strings.ToLower(line[:idx])
+		if !sha256RE.MatchString(sum) {
+			return nil, fmt.Errorf("line %d: %q is not a SHA256 checksum", lineNum, line[:idx])
+		}
+		var p = strings.TrimPrefix(strings.TrimLeft(line[idx:], " \t"), "*")
+		p = strings.TrimPrefix(filepath.ToSlash(p), "./")
+		if p == "" {
+			return nil, fmt.Errorf("line %d: expected a checksum and a path", lineNum)
+		}
+
+		bagit = bagit && strings.HasPrefix(p, bagitPayload)
+		entries = append(entries, Entry{Path: p, Checksum: sum})
+	}
+	var err = s.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	if bagit {
+		for i := range entries {
+			entries[i].Path = strings.TrimPrefix(entries[i].Path, bagitPayload)
+		}
+	}
+	return entries, nil
+}
+
+// HashDir computes the SHA256 of every regular file under root
+func HashDir(root string) ([]Entry, error) {
+	var entries []Entry
+	var err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		var rel string
+		rel, err = filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		var sum string
+		sum, err = hashFile(p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Path: filepath.ToSlash(rel), Checksum: sum})
+		return nil
+	})
+	return entries, err
+}
+
+func hashFile(name string) (string, error) {
+	var f, err = os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	var h = sha256.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
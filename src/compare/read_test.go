@@ -0,0 +1,62 @@
+package compare
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadManifest(t *testing.T) {
+	var a = strings.Repeat("a", 64)
+	var b = strings.Repeat("b", 64)
+	var tests = []struct {
+		name     string
+		manifest string
+		want     []Entry
+		err      string // Text the error must contain; empty means no error
+	}{
+		{name: "empty", manifest: "\n\n", want: nil},
+		{
+			name:     "sha256sum",
+			manifest: a + "  photos/one.tif\n" + b + " *photos/two file.tif\n",
+			want:     []Entry{{Path: "photos/one.tif", Checksum: a}, {Path: "photos/two file.tif", Checksum: b}},
+		},
+		{
+			name:     "uppercase and tabs",
+			manifest: strings.ToUpper(a) + "\t./one.tif\r\n\n  " + b + "\t\ttwo.tif  \n",
+			want:     []Entry{{Path: "one.tif", Checksum: a}, {Path: "two.tif", Checksum: b}},
+		},
+		{
+			name:     "bagit",
+			manifest: a + "  data/one.tif\n" + b + "  data/sub/two.tif\n",
+			want:     []Entry{{Path: "one.tif", Checksum: a}, {Path: "sub/two.tif", Checksum: b}},
+		},
+		{
+			name:     "not all under data",
+			manifest: a + "  data/one.tif\n" + b + "  two.tif\n",
+			want:     []Entry{{Path: "data/one.tif", Checksum: a}, {Path: "two.tif", Checksum: b}},
+		},
+		{name: "no path", manifest: a + "\n", err: "line 1: expected a checksum and a path"},
+		{name: "only a star", manifest: "\n" + a + "  *\n", err: "line 2: expected a checksum and a path"},
+		{name: "bad checksum", manifest: "abc123  one.tif\n", err: `line 1: "abc123" is not a SHA256 checksum`},
+		{name: "md5", manifest: strings.Repeat("a", 32) + "  one.tif\n", err: "is not a SHA256 checksum"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got, err = ReadManifest(strings.NewReader(tc.manifest))
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Got %#v, expected %#v", got, tc.want)
+			}
+		})
+	}
+}
@@ -15,14 +15,21 @@ type Config struct {
 	Approot               string `setting:"APPROOT" type:"path"`
 	DARoot                string `setting:"DARK_ARCHIVE_PATH" type:"path"`
 	PathFormat            []PathToken
-	PathFormatString      string `setting:"ARCHIVE_PATH_FORMAT"`
-	InventoryPattern      string `setting:"INVENTORY_FILE_GLOB"`
-	ArchiveOutputLocation string `setting:"ARCHIVE_OUTPUT_LOCATION" type:"path"`
-	ArchiveLifetimeDays   int    `setting:"ARCHIVE_LIFETIME_DAYS" type:"int"`
-	SMTPUser              string `setting:"SMTP_USER"`
-	SMTPPass              string `setting:"SMTP_PASS"`
-	SMTPHost              string `setting:"SMTP_HOST"`
-	SMTPPort              int    `setting:"SMTP_PORT" type:"int"`
+	PathFormatString      string         `setting:"ARCHIVE_PATH_FORMAT"`
+	InventoryPattern      string         `setting:"INVENTORY_FILE_GLOB"`
+	MetadataSidecarSuffix string         `setting:"METADATA_SIDECAR_SUFFIX"`
+	ArchiveOutputLocation string         `setting:"ARCHIVE_OUTPUT_LOCATION" type:"path"`
+	ArchiveLifetimeDays   int            `setting:"ARCHIVE_LIFETIME_DAYS" type:"int"`
+	AuthUserHeader        string         `setting:"AUTH_USER_HEADER"`
+	ConflictPolicy        ConflictPolicy `setting:"CONFLICT_POLICY"`
+	SMTPUser              string         `setting:"SMTP_USER"`
+	SMTPPass              string         `setting:"SMTP_PASS"`
+	SMTPHost              string         `setting:"SMTP_HOST"`
+	SMTPPort              int            `setting:"SMTP_PORT" type:"int"`
+	Tags                  []string
+	TagsString            string `setting:"TAGS"`
+	SearchRanking         SearchRanking
+	SearchRankingString   string `setting:"SEARCH_RANKING"`
 }
 
 // Read opens the given file and reads its configuration
@@ -43,6 +50,15 @@ func Read(filename string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid ARCHIVE_PATH_FORMAT %q: %s", c.PathFormatString, err)
 	}
+	err = c.parseConflictPolicy()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONFLICT_POLICY %q: %s", c.ConflictPolicy, err)
+	}
+	c.Tags = strings.Fields(c.TagsString)
+	err = c.parseSearchRanking()
+	if err != nil {
+		return nil, fmt.Errorf("invalid SEARCH_RANKING %q: %s", c.SearchRankingString, err)
+	}
 
 	return c, nil
 }
@@ -83,3 +99,13 @@ func (c *Config) parsePathFormat() error {
 
 	return nil
 }
+
+// ValidTag returns true if tag is one of the configured tags
+func (c *Config) ValidTag(tag string) bool {
+	for _, t := range c.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
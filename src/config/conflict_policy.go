@@ -0,0 +1,26 @@
+package config
+
+import "fmt"
+
+// ConflictPolicy tells the indexer what to do when an inventory describes a
+// file (same category, archive date, and public path) which another inventory
+// already described with different contents
+type ConflictPolicy string
+
+// Valid conflict policies
+const (
+	ConflictFirstWins ConflictPolicy = "first"  // keep the file already in the catalog
+	ConflictLastWins  ConflictPolicy = "last"   // replace it with the new inventory's file
+	ConflictReject    ConflictPolicy = "reject" // refuse to index the new inventory at all
+)
+
+func (c *Config) parseConflictPolicy() error {
+	switch c.ConflictPolicy {
+	case "":
+		c.ConflictPolicy = ConflictFirstWins
+	case ConflictFirstWins, ConflictLastWins, ConflictReject:
+	default:
+		return fmt.Errorf(`must be "first", "last", or "reject"`)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SearchRanking holds the weight of each way a file search result can match
+// a search term; see db.Ranking
+type SearchRanking struct {
+	ExactName  int
+	NamePrefix int
+	PathWord   int
+}
+
+// DefaultSearchRanking puts exact name matches first, then name prefix
+// matches, then path word matches, no matter how many lesser matches a file
+// has
+var DefaultSearchRanking = SearchRanking{ExactName: 100, NamePrefix: 10, PathWord: 1}
+
+// parseSearchRanking reads SEARCH_RANKING, a space-separated list of
+// name=weight pairs, e.g., "exact_name=100 path_word=0".  Weights which
+// aren't listed keep their defaults.
+func (c *Config) parseSearchRanking() error {
+	c.SearchRanking = DefaultSearchRanking
+	for _, pair := range strings.Fields(c.SearchRankingString) {
+		var parts = strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("%q must be name=weight", pair)
+		}
+		var weight, err = strconv.Atoi(parts[1])
+		if err != nil || weight < 0 {
+			return fmt.Errorf("%q: the weight must be a whole number, zero or more", pair)
+		}
+
+		switch parts[0] {
+		case "exact_name":
+			c.SearchRanking.ExactName = weight
+		case "name_prefix":
+			c.SearchRanking.NamePrefix = weight
+		case "path_word":
+			c.SearchRanking.PathWord = weight
+		default:
+			return fmt.Errorf(`unknown name %q; names are "exact_name", "name_prefix", and "path_word"`, parts[0])
+		}
+	}
+	return nil
+}
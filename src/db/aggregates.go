@@ -0,0 +1,337 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// aggregate holds the totals for all files within a folder or category
+type aggregate struct {
+	fileCount      int
+	totalBytes     int64
+	minArchiveDate string
+	maxArchiveDate string
+}
+
+func (a *aggregate) add(f *File) {
+	a.fileCount++
+	a.totalBytes += f.Filesize
+	a.addDate(f.ArchiveDate)
+}
+
+// replace adjusts the size by delta without counting a new file.  The
+// archive dates are still included, as they're already part of the stored
+// totals, and an empty date would clobber them.
+func (a *aggregate) replace(f *File, delta int64) {
+	a.totalBytes += delta
+	a.addDate(f.ArchiveDate)
+}
+
+func (a *aggregate) addDate(date string) {
+	if a.minArchiveDate == "" || date < a.minArchiveDate {
+		a.minArchiveDate = date
+	}
+	if date > a.maxArchiveDate {
+		a.maxArchiveDate = date
+	}
+}
+
+// Aggregates gathers up the totals for newly indexed files so that folders'
+// and categories' stored totals can be updated once per inventory rather than
+// once per file
+type Aggregates struct {
+	folders    map[int]*aggregate
+	categories map[int]*aggregate
+}
+
+// NewAggregates returns an empty Aggregates structure
+func NewAggregates() *Aggregates {
+	return &Aggregates{folders: make(map[int]*aggregate), categories: make(map[int]*aggregate)}
+}
+
+// Add counts f toward its category and every folder above it.  f.Folder must
+// be set, as must each folder's parent Folder, all the way to the top.
+func (a *Aggregates) Add(f *File) {
+	a.get(a.categories, f.CategoryID).add(f)
+	for folder := f.Folder; folder != nil; folder = folder.Folder {
+		a.get(a.folders, folder.ID).add(f)
+	}
+}
+
+// Replace adjusts the totals for newFile replacing old in the catalog.  Only
+// the size can change, since both share a category, folder, and archive date.
+// As with Add, newFile.Folder and its ancestors must be set.
+func (a *Aggregates) Replace(old, newFile *File) {
+	var delta = newFile.Filesize - old.Filesize
+	a.get(a.categories, newFile.CategoryID).replace(newFile, delta)
+	for folder := newFile.Folder; folder != nil; folder = folder.Folder {
+		a.get(a.folders, folder.ID).replace(newFile, delta)
+	}
+}
+
+func (a *Aggregates) get(m map[int]*aggregate, id int) *aggregate {
+	if m[id] == nil {
+		m[id] = &aggregate{}
+	}
+	return m[id]
+}
+
+// addAggregateSQL is used to add new totals to an existing folder or category
+const addAggregateSQL = `
+	UPDATE %s SET
+		file_count = file_count + ?1,
+		total_bytes = total_bytes + ?2,
+		min_archive_date = CASE WHEN min_archive_date = '' OR min_archive_date > ?3 THEN ?3 ELSE min_archive_date END,
+		max_archive_date = CASE WHEN max_archive_date < ?4 THEN ?4 ELSE max_archive_date END
+	WHERE id = ?5`
+
+// ApplyAggregates adds the gathered totals to the stored folders and
+// categories
+func (op *Operation) ApplyAggregates(a *Aggregates) error {
+	var apply = func(table string, m map[int]*aggregate) {
+		var sql = fmt.Sprintf(addAggregateSQL, table)
+		for id, agg := range m {
+			op.Operation.Exec(sql, agg.fileCount, agg.totalBytes, agg.minArchiveDate, agg.maxArchiveDate, id)
+		}
+	}
+
+	apply("folders", a.folders)
+	apply("categories", a.categories)
+	return op.Operation.Err()
+}
+
+// folderTotalsSQL computes the totals for every folder from scratch by
+// pairing each file with its folder and all of that folder's ancestors
+const folderTotalsSQL = `
+	WITH RECURSIVE ancestors(folder_id, file_id) AS (
+		SELECT folder_id, id FROM files WHERE folder_id > 0
+		UNION ALL
+		SELECT d.folder_id, a.file_id FROM ancestors a JOIN folders d ON d.id = a.folder_id WHERE d.folder_id > 0
+	)
+	SELECT a.folder_id AS folder_id, COUNT(*) AS file_count, SUM(f.filesize) AS total_bytes,
+		MIN(f.archive_date) AS min_archive_date, MAX(f.archive_date) AS max_archive_date
+	FROM ancestors a JOIN files f ON f.id = a.file_id
+	GROUP BY a.folder_id`
+
+// categoryTotalsSQL computes the totals for every category from scratch
+const categoryTotalsSQL = `
+	SELECT category_id, COUNT(*) AS file_count, SUM(filesize) AS total_bytes,
+		MIN(archive_date) AS min_archive_date, MAX(archive_date) AS max_archive_date
+	FROM files
+	GROUP BY category_id`
+
+// staleAggregatesSQL counts rows in a table whose stored totals don't match
+// the totals query it's joined to
+const staleAggregatesSQL = `
+	SELECT COUNT(*) FROM %s x LEFT JOIN (%s) t ON t.%s = x.id
+	WHERE x.file_count != COALESCE(t.file_count, 0)
+		OR x.total_bytes != COALESCE(t.total_bytes, 0)
+		OR x.min_archive_date != COALESCE(t.min_archive_date, '')
+		OR x.max_archive_date != COALESCE(t.max_archive_date, '')`
+
+// replaceAggregatesSQL overwrites a table's stored totals with those in the
+// temporary "totals" table
+const replaceAggregatesSQL = `
+	UPDATE %[1]s SET
+		file_count = COALESCE((SELECT file_count FROM totals t WHERE t.%[2]s = %[1]s.id), 0),
+		total_bytes = COALESCE((SELECT total_bytes FROM totals t WHERE t.%[2]s = %[1]s.id), 0),
+		min_archive_date = COALESCE((SELECT min_archive_date FROM totals t WHERE t.%[2]s = %[1]s.id), ''),
+		max_archive_date = COALESCE((SELECT max_archive_date FROM totals t WHERE t.%[2]s = %[1]s.id), '')`
+
+// StaleAggregates returns how many folders and categories have stored totals
+// which don't match the files actually in the database
+func (op *Operation) StaleAggregates() (folders, categories int, err error) {
+	var count = func(table, totalsSQL, key string) int {
+		var n int
+		var rows = op.Operation.Query(fmt.Sprintf(staleAggregatesSQL, table, totalsSQL, key))
+		defer rows.Close()
+		if rows.Next() {
+			rows.Scan(&n)
+		}
+		return n
+	}
+
+	folders = count("folders", folderTotalsSQL, "folder_id")
+	categories = count("categories", categoryTotalsSQL, "category_id")
+	return folders, categories, op.Operation.Err()
+}
+
+// RecomputeAggregates throws away all folders' and categories' stored totals
+// and recomputes them from the files table
+func (op *Operation) RecomputeAggregates() error {
+	var replace = func(table, totalsSQL, key string) {
+		op.Operation.Exec("CREATE TEMPORARY TABLE totals AS " + totalsSQL)
+		op.Operation.Exec(fmt.Sprintf("CREATE INDEX totals_%[1]s ON totals (%[1]s)", key))
+		op.Operation.Exec(fmt.Sprintf(replaceAggregatesSQL, table, key))
+		op.Operation.Exec("DROP TABLE totals")
+	}
+
+	replace("folders", folderTotalsSQL, "folder_id")
+	replace("categories", categoryTotalsSQL, "category_id")
+	return op.Operation.Err()
+}
+
+// recomputeFolderSQL recomputes a single folder's totals from the files
+// directly within it and its subfolders' stored totals
+const recomputeFolderSQL = `
+	UPDATE folders SET
+		file_count =
+			(SELECT COUNT(*) FROM files WHERE folder_id = ?1) +
+			(SELECT COALESCE(SUM(file_count), 0) FROM folders WHERE folder_id = ?1),
+		total_bytes =
+			(SELECT COALESCE(SUM(filesize), 0) FROM files WHERE folder_id = ?1) +
+			(SELECT COALESCE(SUM(total_bytes), 0) FROM folders WHERE folder_id = ?1),
+		min_archive_date = COALESCE((SELECT MIN(d) FROM (
+			SELECT MIN(archive_date) AS d FROM files WHERE folder_id = ?1
+			UNION ALL
+			SELECT MIN(NULLIF(min_archive_date, '')) FROM folders WHERE folder_id = ?1
+		)), ''),
+		max_archive_date = COALESCE((SELECT MAX(d) FROM (
+			SELECT MAX(archive_date) AS d FROM files WHERE folder_id = ?1
+			UNION ALL
+			SELECT MAX(max_archive_date) FROM folders WHERE folder_id = ?1
+		)), '')
+	WHERE id = ?1`
+
+// recomputeCategorySQL recomputes a single category's totals
+const recomputeCategorySQL = `
+	UPDATE categories SET
+		file_count = (SELECT COUNT(*) FROM files WHERE category_id = ?1),
+		total_bytes = (SELECT COALESCE(SUM(filesize), 0) FROM files WHERE category_id = ?1),
+		min_archive_date = (SELECT COALESCE(MIN(archive_date), '') FROM files WHERE category_id = ?1),
+		max_archive_date = (SELECT COALESCE(MAX(archive_date), '') FROM files WHERE category_id = ?1)
+	WHERE id = ?1`
+
+// RetractInventory removes an inventory and all files it described, then
+// recomputes the totals of every folder and category those files were in.
+// The number of files removed is returned.
+// Folders which end up empty are kept, since a running indexer may have them
+// cached, but they're no longer shown when browsing or searching.
+func (op *Operation) RetractInventory(inv *Inventory) (int64, error) {
+	// Find all affected folders, deepest first, so each folder's subfolders
+	// are recomputed before it is
+	var folderIDs []int
+	var rows = op.Operation.Query(`
+		WITH RECURSIVE affected(id) AS (
+			SELECT DISTINCT folder_id FROM files WHERE inventory_id = ? AND folder_id > 0
+			UNION
+			SELECT d.folder_id FROM folders d JOIN affected a ON d.id = a.id WHERE d.folder_id > 0
+		)
+		SELECT a.id FROM affected a JOIN folders d ON d.id = a.id ORDER BY d.depth DESC`, inv.ID)
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		folderIDs = append(folderIDs, id)
+	}
+	rows.Close()
+
+	var categoryIDs []int
+	rows = op.Operation.Query(`SELECT DISTINCT category_id FROM files WHERE inventory_id = ?`, inv.ID)
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		categoryIDs = append(categoryIDs, id)
+	}
+	rows.Close()
+
+	var removed = op.Operation.Exec(`DELETE FROM files WHERE inventory_id = ?`, inv.ID).RowsAffected()
+	op.Operation.Exec(`DELETE FROM inventories WHERE id = ?`, inv.ID)
+	op.Operation.Exec(`DELETE FROM restrictions WHERE inventory_id = ?`, inv.ID)
+	op.Operation.Exec(`DELETE FROM metadata WHERE inventory_path = ?`, inv.Path)
+	for _, id := range folderIDs {
+		op.Operation.Exec(recomputeFolderSQL, id)
+	}
+	for _, id := range categoryIDs {
+		op.Operation.Exec(recomputeCategorySQL, id)
+	}
+
+	return removed, op.Operation.Err()
+}
+
+// liveFolderTotalsSQL computes the totals for a list of folders, counting
+// only files which pass a filter
+const liveFolderTotalsSQL = `
+	WITH RECURSIVE tree(root_id, id) AS (
+		SELECT id, id FROM folders WHERE id IN (%s)
+		UNION ALL
+		SELECT t.root_id, d.id FROM tree t JOIN folders d ON d.folder_id = t.id
+	)
+	SELECT t.root_id, COUNT(*), SUM(f.filesize), MIN(f.archive_date), MAX(f.archive_date)
+	FROM tree t JOIN files f ON f.folder_id = t.id
+	WHERE %s
+	GROUP BY t.root_id`
+
+// FolderTotals replaces the stored totals of the given folders with totals
+// computed from only the files which pass ff, so they describe the folders as
+// the viewer sees them.  Folders whose stored totals already match (e.g., no
+// "as of" date or filters are set and no hidden files are within them) are
+// left alone.
+func (op *Operation) FolderTotals(folders []*Folder, ff FileFilter) error {
+	var byID = make(map[int]*Folder, len(folders))
+	var ids []string
+	for _, f := range folders {
+		if !ff.changesTotals() && !ff.Restrictions.affectsFolder(f) {
+			continue
+		}
+		byID[f.ID] = f
+		ids = append(ids, strconv.Itoa(f.ID))
+		f.FileCount, f.TotalBytes, f.MinArchiveDate, f.MaxArchiveDate = 0, 0, "", ""
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var where, args = ff.sql("f.")
+	var rows = op.Operation.Query(fmt.Sprintf(liveFolderTotalsSQL, strings.Join(ids, ","), where), args...)
+	defer rows.Close()
+	for rows.Next() {
+		var id, count int
+		var bytes int64
+		var minDate, maxDate string
+		rows.Scan(&id, &count, &bytes, &minDate, &maxDate)
+		var f = byID[id]
+		f.FileCount, f.TotalBytes, f.MinArchiveDate, f.MaxArchiveDate = count, bytes, minDate, maxDate
+	}
+	return op.Operation.Err()
+}
+
+// CategoryTotals replaces the stored totals of c with totals computed from
+// only the files which pass ff.  As with FolderTotals, c is left alone if its
+// stored totals already match.
+func (op *Operation) CategoryTotals(c *Category, ff FileFilter) error {
+	if !ff.changesTotals() && !ff.Restrictions.affectsCategory(c) {
+		return nil
+	}
+
+	var where, args = ff.sql("")
+	var rows = op.Operation.Query(`
+		SELECT COUNT(*), COALESCE(SUM(filesize), 0), COALESCE(MIN(archive_date), ''), COALESCE(MAX(archive_date), '')
+		FROM files WHERE category_id = ? AND `+where, append([]interface{}{c.ID}, args...)...)
+	defer rows.Close()
+	if rows.Next() {
+		rows.Scan(&c.FileCount, &c.TotalBytes, &c.MinArchiveDate, &c.MaxArchiveDate)
+	}
+	return op.Operation.Err()
+}
+
+// ArchiveDates returns every distinct archive date in the given category, or
+// in the whole catalog if c is nil, oldest first.  Dates which only hidden
+// files have are skipped.
+func (op *Operation) ArchiveDates(c *Category, r *Restrictions) ([]string, error) {
+	var where, args = FileFilter{Restrictions: r}.sql("")
+	if c != nil {
+		where += " AND category_id = ?"
+		args = append(args, c.ID)
+	}
+	var rows = op.Operation.Query("SELECT DISTINCT archive_date FROM files WHERE "+where+" ORDER BY archive_date", args...)
+	defer rows.Close()
+
+	var dates []string
+	for rows.Next() {
+		var d string
+		rows.Scan(&d)
+		dates = append(dates, d)
+	}
+	return dates, op.Operation.Err()
+}
@@ -0,0 +1,95 @@
+package db
+
+import "time"
+
+// GetNotes returns the notes attached to the file or folder with the given
+// public id, oldest first
+func (op *Operation) GetNotes(pid string) ([]*Note, error) {
+	var notes []*Note
+	op.Notes.Select().Where("public_id = ?", pid).Order("created_at, id").AllObjects(&notes)
+	return notes, op.Operation.Err()
+}
+
+// FindNoteByID returns the note with the given id, or nil if there isn't one
+func (op *Operation) FindNoteByID(id int) (*Note, error) {
+	var n = &Note{}
+	var ok = op.Notes.Select().Where("id = ?", id).First(n)
+	if !ok {
+		n = nil
+	}
+	return n, op.Operation.Err()
+}
+
+// AddNote attaches a new note to the file or folder with the given public id
+func (op *Operation) AddNote(pid, author, body string) (*Note, error) {
+	var now = time.Now()
+	var n = &Note{PublicID: pid, CreatedAt: now, Author: author, UpdatedAt: now, UpdatedBy: author, Body: body}
+	op.Notes.Save(n)
+	return n, op.Operation.Err()
+}
+
+// UpdateNote replaces a note's text, recording who changed it and when
+func (op *Operation) UpdateNote(n *Note, user, body string) error {
+	n.Body = body
+	n.UpdatedAt = time.Now()
+	n.UpdatedBy = user
+	op.Notes.Save(n)
+	return op.Operation.Err()
+}
+
+// DeleteNote removes a note
+func (op *Operation) DeleteNote(n *Note) error {
+	op.Operation.Exec("DELETE FROM notes WHERE id = ?", n.ID)
+	return op.Operation.Err()
+}
+
+// GetTags returns the tags attached to the file or folder with the given
+// public id, in alphabetical order
+func (op *Operation) GetTags(pid string) ([]*Tag, error) {
+	var tags []*Tag
+	op.Tags.Select().Where("public_id = ?", pid).Order("tag").AllObjects(&tags)
+	return tags, op.Operation.Err()
+}
+
+// AddTag attaches a tag to the file or folder with the given public id.  If
+// the tag is already there, nothing changes.
+func (op *Operation) AddTag(pid, tag, author string) error {
+	var n = op.Tags.Select().Where("public_id = ? AND tag = ?", pid, tag).Count().RowCount()
+	if n == 0 && op.Operation.Err() == nil {
+		op.Tags.Save(&Tag{PublicID: pid, Tag: tag, CreatedAt: time.Now(), Author: author})
+	}
+	return op.Operation.Err()
+}
+
+// RemoveTag removes a tag from the file or folder with the given public id,
+// returning false if it wasn't there
+func (op *Operation) RemoveTag(pid, tag string) (bool, error) {
+	var n = op.Operation.Exec("DELETE FROM tags WHERE public_id = ? AND tag = ?", pid, tag).RowsAffected()
+	return n > 0, op.Operation.Err()
+}
+
+// TagNames returns a map of public ids to the names of the tags attached to
+// each, for showing tags alongside a list of files or folders
+func (op *Operation) TagNames(pids []string) (map[string][]string, error) {
+	var args = make([]interface{}, len(pids))
+	for i, pid := range pids {
+		args[i] = pid
+	}
+
+	var names = make(map[string][]string)
+	eachChunk(args, func(chunk []interface{}) {
+		var tags []*Tag
+		op.Tags.Select().Where("public_id IN "+placeholders(len(chunk)), chunk...).Order("tag").AllObjects(&tags)
+		for _, t := range tags {
+			names[t.PublicID] = append(names[t.PublicID], t.Tag)
+		}
+	})
+	return names, op.Operation.Err()
+}
+
+// annotationSQL matches files or folders with a note containing a term or a
+// tag equal to it.  It takes the term twice: once wrapped in wildcards for
+// the notes, once as-is for the tags.
+const annotationSQL = `public_id IN (
+	SELECT public_id FROM notes WHERE body LIKE ?
+	UNION SELECT public_id FROM tags WHERE tag = ?)`
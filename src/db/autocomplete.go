@@ -0,0 +1,66 @@
+package db
+
+import "strings"
+
+// CompleteFiles returns up to limit files under category c and folder f
+// (either may be nil) whose names are LIKE prefix followed by anything,
+// ordered by name.  LIKE ignores case, and treats "_" and "%" in the prefix
+// as wildcards, so callers wanting an exact prefix have to check for it.
+// Every version of a file is returned.  Files hidden by r are left out, so
+// they can't take the place of files the viewer may see.
+func (op *Operation) CompleteFiles(c *Category, f *Folder, prefix string, r *Restrictions, limit uint64) ([]*File, error) {
+	var where, args = completeScope(c, f)
+	where = append(where, "name LIKE ?")
+	args = append(args, prefix+"%")
+	if !r.Empty() {
+		var rWhere, rArgs = r.fileSQL("")
+		where = append(where, rWhere)
+		args = append(args, rArgs...)
+	}
+
+	var files []*File
+	op.Files.Select().Where(strings.Join(where, " AND "), args...).
+		Order("name COLLATE NOCASE, public_path, archive_date DESC").Limit(limit).AllObjects(&files)
+	return files, op.Operation.Err()
+}
+
+// CompleteFolders is CompleteFiles for folders: it returns folders whose names
+// start with prefix, or whose paths do relative to f, ordered by path.
+// Folders with no files, and folders hidden by r, are skipped.
+func (op *Operation) CompleteFolders(c *Category, f *Folder, prefix string, r *Restrictions, limit uint64) ([]*Folder, error) {
+	var where, args = completeScope(c, f)
+	var pathPrefix = prefix
+	if f != nil {
+		pathPrefix = f.PublicPath + "/" + prefix
+	}
+	where = append(where, "(name LIKE ? OR public_path LIKE ?)", "file_count > 0")
+	args = append(args, prefix+"%", pathPrefix+"%")
+	if !r.Empty() {
+		var rWhere, rArgs = r.folderSQL()
+		where = append(where, rWhere)
+		args = append(args, rArgs...)
+	}
+
+	var folders []*Folder
+	op.Folders.Select().Where(strings.Join(where, " AND "), args...).
+		Order("public_path COLLATE NOCASE, category_id").Limit(limit).AllObjects(&folders)
+	return folders, op.Operation.Err()
+}
+
+// completeScope returns the conditions limiting autocompletion to a category
+// and folder.  The "+" keeps SQLite from using the category index, which
+// could mean reading every row in a huge category, rather than the name
+// index, which finds only rows with the right prefix.
+func completeScope(c *Category, f *Folder) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if c != nil {
+		where = append(where, "+category_id = ?")
+		args = append(args, c.ID)
+	}
+	if f != nil {
+		where = append(where, "public_path LIKE ?")
+		args = append(args, f.PublicPath+"/%")
+	}
+	return where, args
+}
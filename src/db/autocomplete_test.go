@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestCompleteSkipsHidden makes sure hidden files and folders don't use up
+// the candidates autocompletion reads, leaving none the viewer can see
+func TestCompleteSkipsHidden(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("reports")
+	var hidden, _ = op.FindOrCreateFolder(c, nil, "report-hidden")
+	var public, _ = op.FindOrCreateFolder(c, nil, "report-public")
+	var paths = map[*Folder][]string{
+		hidden: {"report-1.pdf", "report-2.pdf", "report-3.pdf"},
+		public: {"report-4.pdf"},
+	}
+	for folder, names := range paths {
+		for _, name := range names {
+			var p = folder.PublicPath + "/" + name
+			op.Files.Save(&File{CategoryID: c.ID, FolderID: folder.ID, ArchiveDate: "2020-01-01", Name: name,
+				PublicPath: p, PublicID: FilePublicID(c.Name, "2020-01-01", p)})
+		}
+	}
+	op.WriteRestriction(&Restriction{CreatedAt: time.Now(), FolderID: hidden.ID})
+	var err = op.RecomputeAggregates()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var r *Restrictions
+	r, err = op.RestrictionsFor("somebody", time.Now())
+	if err != nil {
+		t.Fatalf("Unable to read restrictions: %s", err)
+	}
+	if r.Key() == "" || (*Restrictions)(nil).Key() != "" {
+		t.Errorf("Expected only restrictions which hide something to have a key; got %q", r.Key())
+	}
+
+	var files []*File
+	files, err = op.CompleteFiles(c, nil, "report", r, 2)
+	if err != nil {
+		t.Fatalf("Unable to complete files: %s", err)
+	}
+	if len(files) != 1 || files[0].Name != "report-4.pdf" {
+		t.Errorf("Expected only the visible file, got %d files", len(files))
+		for _, f := range files {
+			t.Logf("- %s", f.PublicPath)
+		}
+	}
+
+	var folders []*Folder
+	folders, err = op.CompleteFolders(c, nil, "report", r, 1)
+	if err != nil {
+		t.Fatalf("Unable to complete folders: %s", err)
+	}
+	if len(folders) != 1 || folders[0].ID != public.ID {
+		t.Errorf("Expected only the visible folder, got %d folders", len(folders))
+	}
+
+	files, err = op.CompleteFiles(c, nil, "report", nil, 10)
+	if err != nil || len(files) != 4 {
+		t.Errorf("Expected every file without restrictions, got %d (err: %v)", len(files), err)
+	}
+}
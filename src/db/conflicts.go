@@ -0,0 +1,131 @@
+package db
+
+import (
+	"time"
+)
+
+// NewConflict returns a Conflict describing newFile (from newInv) colliding
+// with existing.  The caller must set the outcome.
+func (op *Operation) NewConflict(existing, newFile *File, newInv *Inventory) (*Conflict, error) {
+	var existingInv, err = op.FindInventoryByID(existing.InventoryID)
+	if err != nil {
+		return nil, err
+	}
+	var existingPath = ""
+	if existingInv != nil {
+		existingPath = existingInv.Path
+	}
+
+	return &Conflict{
+		CreatedAt:         time.Now(),
+		CategoryID:        newFile.CategoryID,
+		Category:          newFile.Category,
+		ArchiveDate:       newFile.ArchiveDate,
+		PublicPath:        newFile.PublicPath,
+		ExistingInventory: existingPath,
+		ExistingChecksum:  existing.Checksum,
+		ExistingFilesize:  existing.Filesize,
+		NewInventory:      newInv.Path,
+		NewChecksum:       newFile.Checksum,
+		NewFilesize:       newFile.Filesize,
+	}, nil
+}
+
+// WriteConflict stores a conflict.  Identical-content conflicts are marked
+// resolved, since there's nothing for anybody to review.
+func (op *Operation) WriteConflict(c *Conflict) error {
+	if c.Outcome == ConflictIdentical {
+		c.ResolvedAt = c.CreatedAt
+		c.ResolvedBy = ConflictAutoResolver
+	}
+	op.Conflicts.Save(c)
+	return op.Operation.Err()
+}
+
+// WriteRejectedConflicts stores conflicts from an inventory which was rejected
+// because of them.  A rejected inventory is tried again every time the
+// indexer runs, so conflicts which are already recorded and unresolved are
+// skipped rather than stored again.
+//
+// The conflicts were found in the rejected inventory's transaction, which has
+// since been rolled back, so each one's category is looked up again by name,
+// and its existing file is read again.  Conflicts whose existing file was
+// never committed (e.g., the inventory listed a file twice) are skipped.
+func (op *Operation) WriteRejectedConflicts(list []*Conflict) error {
+	for _, c := range list {
+		var cat, err = op.FindCategoryByName(c.Category.Name)
+		if err != nil {
+			return err
+		}
+		if cat == nil {
+			continue
+		}
+		var existing *File
+		existing, err = op.FindFile(cat, c.ArchiveDate, c.PublicPath)
+		if err != nil {
+			return err
+		}
+		if existing == nil || (existing.Checksum == c.NewChecksum && existing.Filesize == c.NewFilesize) {
+			continue
+		}
+
+		var inv *Inventory
+		inv, err = op.FindInventoryByID(existing.InventoryID)
+		if err != nil {
+			return err
+		}
+		c.CategoryID, c.Category = cat.ID, cat
+		c.ExistingInventory, c.ExistingChecksum, c.ExistingFilesize = "", existing.Checksum, existing.Filesize
+		if inv != nil {
+			c.ExistingInventory = inv.Path
+		}
+
+		var where = "new_inventory = ? AND category_id = ? AND archive_date = ? AND public_path = ? AND " +
+			"new_checksum = ? AND resolved_by = ''"
+		var n = op.Conflicts.Select().Where(where, c.NewInventory, c.CategoryID, c.ArchiveDate,
+			c.PublicPath, c.NewChecksum).Count().RowCount()
+		if n == 0 {
+			op.WriteConflict(c)
+		}
+	}
+	return op.Operation.Err()
+}
+
+// UnresolvedConflicts returns conflicts nobody has reviewed yet, oldest first
+func (op *Operation) UnresolvedConflicts() ([]*Conflict, error) {
+	var list []*Conflict
+	op.Conflicts.Select().Where("resolved_by = ''").Order("created_at, id").AllObjects(&list)
+	op.populateConflictCategories(list)
+	return list, op.Operation.Err()
+}
+
+// FindConflictByID returns the conflict with the given id, or nil if none
+// exists
+func (op *Operation) FindConflictByID(id int) (*Conflict, error) {
+	var c = &Conflict{}
+	var ok = op.Conflicts.Select().Where("id = ?", id).First(c)
+	if !ok {
+		return nil, op.Operation.Err()
+	}
+	op.populateConflictCategories([]*Conflict{c})
+	return c, op.Operation.Err()
+}
+
+// ResolveConflict marks a conflict as reviewed by the given person
+func (op *Operation) ResolveConflict(c *Conflict, resolvedBy string) error {
+	c.ResolvedAt = time.Now()
+	c.ResolvedBy = resolvedBy
+	op.Conflicts.Save(c)
+	return op.Operation.Err()
+}
+
+func (op *Operation) populateConflictCategories(list []*Conflict) {
+	var categories, _ = op.AllCategories()
+	var byID = make(map[int]*Category)
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	for _, c := range list {
+		c.Category = byID[c.CategoryID]
+	}
+}
@@ -0,0 +1,59 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+// TestWriteRejectedConflicts makes sure conflicts from a rolled-back
+// inventory are stored against what was actually committed: categories are
+// found again by name, and conflicts with files which were never committed
+// are dropped
+func TestWriteRejectedConflicts(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("photos")
+	var inv = &Inventory{Path: "/inventories/one.csv"}
+	op.Inventories.Save(inv)
+	var folder, _ = op.FindOrCreateFolder(c, nil, "box")
+	op.Files.Save(&File{CategoryID: c.ID, FolderID: folder.ID, InventoryID: inv.ID, ArchiveDate: "2020-01-01",
+		Name: "a.tif", PublicPath: "box/a.tif", PublicID: FilePublicID(c.Name, "2020-01-01", "box/a.tif"),
+		Checksum: "aaa", Filesize: 10})
+	var err = op.Operation.Err()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var rejected = func(category, path, checksum string, size int64) *Conflict {
+		return &Conflict{CreatedAt: time.Now(), CategoryID: 999, Category: &Category{ID: 999, Name: category},
+			ArchiveDate: "2020-01-01", PublicPath: path, ExistingInventory: "/inventories/two.csv",
+			ExistingChecksum: "bbb", NewInventory: "/inventories/two.csv", NewChecksum: checksum,
+			NewFilesize: size, Outcome: ConflictRejected}
+	}
+	for i := 0; i < 2; i++ {
+		var list = []*Conflict{
+			rejected("photos", "box/a.tif", "ccc", 10),
+			rejected("photos", "box/b.tif", "ccc", 10),
+			rejected("maps", "box/a.tif", "ccc", 10),
+			rejected("photos", "box/a.tif", "aaa", 10),
+		}
+		err = op.WriteRejectedConflicts(list)
+		if err != nil {
+			t.Fatalf("Unable to write conflicts: %s", err)
+		}
+	}
+
+	var list []*Conflict
+	list, err = op.UnresolvedConflicts()
+	if err != nil {
+		t.Fatalf("Unable to read conflicts: %s", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("Expected one conflict, got %d", len(list))
+	}
+	var got = list[0]
+	if got.CategoryID != c.ID || got.PublicPath != "box/a.tif" || got.ExistingInventory != inv.Path ||
+		got.ExistingChecksum != "aaa" || got.ExistingFilesize != 10 {
+		t.Errorf("Conflict doesn't describe the committed file: %#v", got)
+	}
+}
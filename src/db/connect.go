@@ -0,0 +1,108 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// dbPath is the database all binaries share.  It may be a symlink to the
+// real database file, which lets a rebuilt catalog be swapped in; see Swap.
+const dbPath = "db/da.db"
+
+// busyTimeout is how long SQLite waits on another process's lock before
+// giving up with SQLITE_BUSY; busyRetries is how many times InTransaction
+// will rerun a transaction which failed that way anyway
+const (
+	busyTimeout = 10 * time.Second
+	busyRetries = 5
+)
+
+// We register our own drivers so every new connection in a pool gets the
+// same per-connection settings
+const (
+	driverReadWrite = "sqlite3_headlamp"
+	driverReadOnly  = "sqlite3_headlamp_ro"
+)
+
+func init() {
+	sql.Register(driverReadWrite, &sqlite3.SQLiteDriver{ConnectHook: connectHook(false)})
+	sql.Register(driverReadOnly, &sqlite3.SQLiteDriver{ConnectHook: connectHook(true)})
+}
+
+// connectHook returns a function which sets up a new connection.  Read-only
+// connections refuse any writes, which lets us hand them out to code that
+// should never need to change data.
+func connectHook(readOnly bool) func(*sqlite3.SQLiteConn) error {
+	var pragmas = []string{"PRAGMA synchronous = NORMAL"}
+	if readOnly {
+		pragmas = append(pragmas, "PRAGMA query_only = ON")
+	}
+
+	return func(conn *sqlite3.SQLiteConn) error {
+		for _, pragma := range pragmas {
+			var _, err = conn.Exec(pragma, nil)
+			if err != nil {
+				return fmt.Errorf("%s: %s", pragma, err)
+			}
+		}
+		return nil
+	}
+}
+
+// open connects to the database at path.  Write connections take their lock
+// at the start of a transaction (BEGIN IMMEDIATE) so two writers can't
+// deadlock trying to upgrade read locks; readers never block writers or each
+// other thanks to WAL mode.
+func open(path string, readOnly bool) (*sql.DB, error) {
+	var driver = driverReadWrite
+	var dsn = fmt.Sprintf("file:%s?_busy_timeout=%d", path, busyTimeout/time.Millisecond)
+	if readOnly {
+		driver = driverReadOnly
+	} else {
+		dsn += "&_txlock=immediate"
+	}
+
+	var _db, err = sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %s", err)
+	}
+
+	// WAL mode is stored in the database file, so we only need to set it from
+	// the read-write side, and only once.  Switching modes needs exclusive
+	// access, so we don't try it unless it's necessary.  Doing this here also
+	// verifies we can connect at all.
+	if !readOnly {
+		var mode string
+		err = _db.QueryRow("PRAGMA journal_mode").Scan(&mode)
+		if err == nil && mode != "wal" {
+			_, err = _db.Exec("PRAGMA journal_mode = WAL")
+		}
+		if err != nil {
+			_db.Close()
+			return nil, fmt.Errorf("unable to enable WAL mode: %s", err)
+		}
+	}
+
+	return _db, nil
+}
+
+// resolve returns the file path is a symlink to, or path itself if it isn't
+// a symlink or doesn't exist yet.  SQLite does the same when it opens a
+// database, so this is the file a connection to path actually uses.
+func resolve(path string) string {
+	var target, err = filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+	return target
+}
+
+// isBusy returns true if err means SQLite couldn't get a lock in time
+func isBusy(err error) bool {
+	var sqliteErr, ok = err.(sqlite3.Error)
+	return ok && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
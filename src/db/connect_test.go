@@ -0,0 +1,114 @@
+package db
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// migrationsDir is found before any test changes directories
+var migrationsDir, _ = filepath.Abs("../../db/migrations")
+
+// newTestDB creates a catalog in a temporary directory with every migration
+// applied, returning read-write and read-only handles to it, just as the web
+// server has dbh and rdbh
+func newTestDB(t *testing.T) (rw, ro *Database) {
+	t.Helper()
+	var path = filepath.Join(t.TempDir(), "da.db")
+	rw = migrate(t, path)
+	ro = mustOpen(path, true)
+	return rw, ro
+}
+
+// migrate creates a database at path with every migration applied, and
+// returns a read-write handle to it
+func migrate(t *testing.T, path string) *Database {
+	t.Helper()
+	var rw = NewAt(path)
+	var migrations, err = filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("Unable to find migrations: %v", err)
+	}
+	for _, m := range migrations {
+		var data, err = ioutil.ReadFile(m)
+		if err != nil {
+			t.Fatalf("Unable to read %s: %s", m, err)
+		}
+		var up = strings.SplitN(string(data), "-- +goose Down", 2)[0]
+		_, err = rw.dbh.DataSource().Exec(up)
+		if err != nil {
+			t.Fatalf("Unable to apply %s: %s", m, err)
+		}
+	}
+	return rw
+}
+
+// TestReadsDuringWrite holds a write transaction open, as the indexer does
+// while it stores an inventory, and makes sure page loads on the read-only
+// handle neither wait for it nor see its uncommitted rows
+func TestReadsDuringWrite(t *testing.T) {
+	var dbh, rdbh = newTestDB(t)
+	var err = dbh.InTransaction(func(op *Operation) error {
+		var _, err = op.FindOrCreateCategory("existing")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unable to create category: %s", err)
+	}
+
+	var started = make(chan struct{})
+	var release = make(chan struct{})
+	var done = make(chan error)
+	go func() {
+		done <- dbh.InTransaction(func(op *Operation) error {
+			var c, err = op.FindOrCreateCategory("indexing")
+			if err != nil {
+				return err
+			}
+			_, err = op.FindOrCreateFolder(c, nil, "folder")
+			close(started)
+			<-release
+			return err
+		})
+	}()
+	<-started
+
+	var start = time.Now()
+	var op = rdbh.Operation()
+	var categories, cerr = op.AllCategories()
+	var folders []*Folder
+	var _, ferr = op.FolderSelect(nil, nil).TreeMode(true).AllObjects(&folders)
+	var elapsed = time.Since(start)
+	close(release)
+
+	if cerr != nil || ferr != nil {
+		t.Fatalf("Reads failed during a write: %v, %v", cerr, ferr)
+	}
+	if elapsed >= busyTimeout {
+		t.Errorf("Reads took %s, which means they waited on the writer", elapsed)
+	}
+	if len(categories) != 1 || categories[0].Name != "existing" {
+		t.Errorf("Expected only the committed category, got %d categories", len(categories))
+	}
+
+	err = <-done
+	if err != nil {
+		t.Fatalf("Write transaction failed: %s", err)
+	}
+	categories, err = rdbh.Operation().AllCategories()
+	if err != nil || len(categories) != 2 {
+		t.Errorf("Expected both categories after the write committed, got %d (err: %v)", len(categories), err)
+	}
+}
+
+// TestReadOnlyRefusesWrites makes sure the read-only handle can't be used to
+// change data by mistake
+func TestReadOnlyRefusesWrites(t *testing.T) {
+	var _, rdbh = newTestDB(t)
+	var _, err = rdbh.Operation().FindOrCreateCategory("nope")
+	if err == nil {
+		t.Errorf("Expected an error writing through the read-only handle")
+	}
+}
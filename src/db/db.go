@@ -3,108 +3,275 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"net/mail"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Nerdmaster/magicsql"
-	_ "github.com/mattn/go-sqlite3" // database/sql requires "side-effect" packages be loaded
 	"github.com/uoregon-libraries/gopkg/logger"
 )
 
 // Database encapsulates the database handle and magicsql table definitions
 type Database struct {
-	dbh           *magicsql.DB
-	mtFiles       *magicsql.MagicTable
-	mtFolders     *magicsql.MagicTable
-	mtRealFolders *magicsql.MagicTable
-	mtCategories  *magicsql.MagicTable
-	mtInventories *magicsql.MagicTable
-	mtArchiveJobs *magicsql.MagicTable
+	// path is what we were asked to open, and file is what it pointed to when
+	// the handle was opened; see Refresh
+	path     string
+	file     string
+	readOnly bool
+	lock     sync.RWMutex
+
+	dbh            *magicsql.DB
+	mtFiles        *magicsql.MagicTable
+	mtFolders      *magicsql.MagicTable
+	mtRealFolders  *magicsql.MagicTable
+	mtCategories   *magicsql.MagicTable
+	mtInventories  *magicsql.MagicTable
+	mtArchiveJobs  *magicsql.MagicTable
+	mtJobFiles     *magicsql.MagicTable
+	mtJobAttempts  *magicsql.MagicTable
+	mtConflicts    *magicsql.MagicTable
+	mtEvents       *magicsql.MagicTable
+	mtRestrictions *magicsql.MagicTable
+	mtNotes        *magicsql.MagicTable
+	mtTags         *magicsql.MagicTable
+	mtMetadata     *magicsql.MagicTable
 }
 
 // Operation wraps a magicsql Operation with preloaded OperationTable
 // definitions for easy querying
 type Operation struct {
-	Operation   *magicsql.Operation
-	Files       *magicsql.OperationTable
-	Folders     *magicsql.OperationTable
-	RealFolders *magicsql.OperationTable
-	Inventories *magicsql.OperationTable
-	Categories  *magicsql.OperationTable
-	ArchiveJobs *magicsql.OperationTable
+	Operation    *magicsql.Operation
+	Files        *magicsql.OperationTable
+	Folders      *magicsql.OperationTable
+	RealFolders  *magicsql.OperationTable
+	Inventories  *magicsql.OperationTable
+	Categories   *magicsql.OperationTable
+	ArchiveJobs  *magicsql.OperationTable
+	JobFiles     *magicsql.OperationTable
+	JobAttempts  *magicsql.OperationTable
+	Conflicts    *magicsql.OperationTable
+	Events       *magicsql.OperationTable
+	Restrictions *magicsql.OperationTable
+	Notes        *magicsql.OperationTable
+	Tags         *magicsql.OperationTable
+	Metadata     *magicsql.OperationTable
 }
 
-// New sets up a database connection and returns a usable Database
+// New sets up a read-write database connection pool and returns a usable
+// Database.  Files and folders indexed before public ids existed are given
+// their ids first, since links and events depend on them.
 func New() *Database {
-	var _db, err = sql.Open("sqlite3", "db/da.db")
+	var db = mustOpen(dbPath, false)
+	var missing, err = db.Operation().MissingPublicIDs()
+	if err == nil && missing {
+		err = db.InTransaction(func(op *Operation) error {
+			var n, err = op.AssignPublicIDs()
+			logger.Infof("Assigned public ids to %d files and folders", n)
+			return err
+		})
+	}
 	if err != nil {
-		logger.Fatalf("Unable to open database: %s", err)
+		logger.Fatalf("Unable to assign public ids: %s", err)
 	}
+	return db
+}
 
+// NewReadOnly sets up a database connection pool which refuses writes.  It's
+// meant for code which only reads, such as web page loads, so those never
+// wait in line behind the indexer or archiver.  It can't assign missing
+// public ids the way New does, so it refuses to use a catalog which has any.
+func NewReadOnly() *Database {
+	var db = mustOpen(dbPath, true)
+	var missing, err = db.Operation().MissingPublicIDs()
+	if err != nil {
+		logger.Fatalf("Unable to check public ids: %s", err)
+	}
+	if missing {
+		logger.Fatalf("Some files or folders have no public id; run the indexer (or any " +
+			"other command which writes to the catalog) to assign them")
+	}
+	return db
+}
+
+// NewAt sets up a read-write connection pool for the database file at path
+// rather than the shared database, such as a catalog being rebuilt
+func NewAt(path string) *Database {
+	return mustOpen(path, false)
+}
+
+func mustOpen(path string, readOnly bool) *Database {
+	var file = resolve(path)
+	var _db, err = open(file, readOnly)
+	if err != nil {
+		logger.Fatalf("Unable to use database %q: %s", path, err)
+	}
+	var db = wrap(_db)
+	db.path, db.file, db.readOnly = path, file, readOnly
+	return db
+}
+
+func wrap(_db *sql.DB) *Database {
 	return &Database{
-		dbh:           magicsql.Wrap(_db),
-		mtFiles:       magicsql.Table("files", &File{}),
-		mtFolders:     magicsql.Table("folders", &Folder{}),
-		mtRealFolders: magicsql.Table("real_folders", &RealFolder{}),
-		mtCategories:  magicsql.Table("categories", &Category{}),
-		mtInventories: magicsql.Table("inventories", &Inventory{}),
-		mtArchiveJobs: magicsql.Table("archive_jobs", &ArchiveJob{}),
+		dbh:            magicsql.Wrap(_db),
+		mtFiles:        magicsql.Table("files", &File{}),
+		mtFolders:      magicsql.Table("folders", &Folder{}),
+		mtRealFolders:  magicsql.Table("real_folders", &RealFolder{}),
+		mtCategories:   magicsql.Table("categories", &Category{}),
+		mtInventories:  magicsql.Table("inventories", &Inventory{}),
+		mtArchiveJobs:  magicsql.Table("archive_jobs", &ArchiveJob{}),
+		mtJobFiles:     magicsql.Table("job_files", &JobFile{}),
+		mtJobAttempts:  magicsql.Table("job_attempts", &JobAttempt{}),
+		mtConflicts:    magicsql.Table("conflicts", &Conflict{}),
+		mtEvents:       magicsql.Table("events", &Event{}),
+		mtRestrictions: magicsql.Table("restrictions", &Restriction{}),
+		mtNotes:        magicsql.Table("notes", &Note{}),
+		mtTags:         magicsql.Table("tags", &Tag{}),
+		mtMetadata:     magicsql.Table("metadata", &Metadata{}),
 	}
 }
 
 // Operation returns a pre-set Operation for quick tasks that don't warrant a transaction
 func (db *Database) Operation() *Operation {
+	db.lock.RLock()
 	var magicOp = db.dbh.Operation()
+	db.lock.RUnlock()
 	return &Operation{
-		Operation:   magicOp,
-		Files:       magicOp.OperationTable(db.mtFiles),
-		Folders:     magicOp.OperationTable(db.mtFolders),
-		RealFolders: magicOp.OperationTable(db.mtRealFolders),
-		Inventories: magicOp.OperationTable(db.mtInventories),
-		Categories:  magicOp.OperationTable(db.mtCategories),
-		ArchiveJobs: magicOp.OperationTable(db.mtArchiveJobs),
+		Operation:    magicOp,
+		Files:        magicOp.OperationTable(db.mtFiles),
+		Folders:      magicOp.OperationTable(db.mtFolders),
+		RealFolders:  magicOp.OperationTable(db.mtRealFolders),
+		Inventories:  magicOp.OperationTable(db.mtInventories),
+		Categories:   magicOp.OperationTable(db.mtCategories),
+		ArchiveJobs:  magicOp.OperationTable(db.mtArchiveJobs),
+		JobFiles:     magicOp.OperationTable(db.mtJobFiles),
+		JobAttempts:  magicOp.OperationTable(db.mtJobAttempts),
+		Conflicts:    magicOp.OperationTable(db.mtConflicts),
+		Events:       magicOp.OperationTable(db.mtEvents),
+		Restrictions: magicOp.OperationTable(db.mtRestrictions),
+		Notes:        magicOp.OperationTable(db.mtNotes),
+		Tags:         magicOp.OperationTable(db.mtTags),
+		Metadata:     magicOp.OperationTable(db.mtMetadata),
 	}
 }
 
 // InTransaction connects to the database and starts a transaction, used by all
 // other Database calls, runs the callback function, then ends the transaction,
-// returning the error (if any occurs)
+// returning the error (if any occurs).
+//
+// If the transaction can't start because the database stayed locked by another
+// process, or because a rebuilt catalog is being swapped in, it's retried a
+// few times.  Once a rebuilt catalog has been swapped in, transactions fail
+// until the handle is switched to it with Refresh.  A lock failure partway
+// through is rare, but does mean rerunning the whole callback, so it
+// shouldn't have side effects outside the database which can't safely be
+// repeated.
 func (db *Database) InTransaction(cb func(*Operation) error) error {
+	var err error
+	for attempt := 0; attempt <= busyRetries; attempt++ {
+		if attempt > 0 {
+			logger.Warnf("Database busy; retrying transaction (attempt %d of %d)", attempt, busyRetries)
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+
+		var busy bool
+		busy, err = db.runTransaction(cb)
+		if !busy {
+			return err
+		}
+	}
+
+	return err
+}
+
+// runTransaction does the work for InTransaction, returning whether a failure
+// was due to the database being locked
+func (db *Database) runTransaction(cb func(*Operation) error) (busy bool, err error) {
 	var op = db.Operation()
 	op.Operation.BeginTransaction()
-	var err = cb(op)
+
+	// Write transactions take their lock immediately, so this is almost always
+	// where we find out the database is busy.  The callback doesn't get called
+	// in that case, since it might not be safe to call twice.
+	err = op.Operation.Err()
+	if err != nil {
+		return isBusy(err), fmt.Errorf("database error: %s", err)
+	}
+
+	// Now that nobody else can write, make sure what we write won't be lost
+	// to a rebuilt catalog being swapped in
+	busy, err = db.checkSwap()
+	if err != nil {
+		op.Operation.Rollback()
+		return busy, err
+	}
+
+	err = cb(op)
 
 	// Make sure we absolutely rollback if an error is returned
 	if err != nil {
 		op.Operation.Rollback()
-		return err
+		return isBusy(op.Operation.Err()), err
 	}
 
 	op.Operation.EndTransaction()
 	err = op.Operation.Err()
 	if err != nil {
-		return fmt.Errorf("database error: %s", err)
+		return isBusy(err), fmt.Errorf("database error: %s", err)
 	}
-	return nil
+	return false, nil
 }
 
 // AllInventories returns all the inventory files which have been indexed
 func (op *Operation) AllInventories() ([]*Inventory, error) {
 	var inventories []*Inventory
-	op.Inventories.Select().AllObjects(&inventories)
+	op.Inventories.Select().Order("path").AllObjects(&inventories)
 	return inventories, op.Operation.Err()
 }
 
+// FindInventoryByID returns the inventory with the given id, or nil if none
+// is found
+func (op *Operation) FindInventoryByID(id int) (*Inventory, error) {
+	var inventory = &Inventory{}
+	var ok = op.Inventories.Select().Where("id = ?", id).First(inventory)
+	if !ok {
+		inventory = nil
+	}
+	return inventory, op.Operation.Err()
+}
+
+// GetInventoryFiles returns files described by the given inventory which
+// aren't hidden by r.  If term is non-empty, only files whose public path
+// matches it are returned.
+func (op *Operation) GetInventoryFiles(i *Inventory, term string, r *Restrictions, limit uint64) ([]*File, uint64, error) {
+	var sel = op.FileSelect(nil, nil).TreeMode(true).Inventory(i).Restrict(r).Limit(limit)
+	if term != "" {
+		sel = sel.Search("public_path LIKE ?", term)
+	}
+	var files []*File
+	var count, err = sel.AllObjects(&files)
+	return files, count, err
+}
+
 // WriteInventory stores the given inventory object in the database
 func (op *Operation) WriteInventory(i *Inventory) error {
 	op.Inventories.Save(i)
 	return op.Operation.Err()
 }
 
+// FindInventoryByPath returns the inventory with the given path (relative to
+// the dark archive root), or nil if it hasn't been indexed
+func (op *Operation) FindInventoryByPath(path string) (*Inventory, error) {
+	var inventory = &Inventory{}
+	var ok = op.Inventories.Select().Where("path = ?", path).First(inventory)
+	if !ok {
+		inventory = nil
+	}
+	return inventory, op.Operation.Err()
+}
+
 // AllCategories returns all categories which have been seen
 func (op *Operation) AllCategories() ([]*Category, error) {
 	var categories []*Category
@@ -112,6 +279,17 @@ func (op *Operation) AllCategories() ([]*Category, error) {
 	return categories, op.Operation.Err()
 }
 
+// FindCategoryByID returns the category with the given id, or nil if none
+// exists, and the database error if any occurred
+func (op *Operation) FindCategoryByID(id int) (*Category, error) {
+	var category = &Category{}
+	var ok = op.Categories.Select().Where("id = ?", id).First(category)
+	if !ok {
+		category = nil
+	}
+	return category, op.Operation.Err()
+}
+
 // FindCategoryByName returns a category if one exists with the given name, and
 // the database error if any occurred
 func (op *Operation) FindCategoryByName(name string) (*Category, error) {
@@ -172,6 +350,7 @@ func (op *Operation) FindOrCreateFolder(c *Category, f *Folder, path string) (*F
 		CategoryID: c.ID,
 		Depth:      strings.Count(path, string(os.PathSeparator)),
 		PublicPath: path,
+		PublicID:   FolderPublicID(c.Name, path),
 		Name:       filename,
 	}
 	op.Folders.Save(&newFolder)
@@ -216,46 +395,100 @@ func (op *Operation) FindOrCreateRealFolder(f *Folder, path string) (*RealFolder
 }
 
 // GetFolders returns all folders with the given category and parent folder.  A
-// parent folder of nil can be used to pull all top-level folders.
-func (op *Operation) GetFolders(category *Category, folder *Folder) ([]*Folder, error) {
-	var sel = op.FolderSelect(category, folder)
+// parent folder of nil can be used to pull all top-level folders.  Folders
+// are shown as ff's viewer would see them (see FSelect.Filter).
+func (op *Operation) GetFolders(category *Category, folder *Folder, ff FileFilter) ([]*Folder, error) {
+	var sel = op.FolderSelect(category, folder).Filter(ff)
 	var folders []*Folder
 	var _, err = sel.AllObjects(&folders)
 	return folders, err
 }
 
 // GetFiles returns all files with the given category and parent folder.  A
-// parent folder of nil can be used to pull all top-level files.
-func (op *Operation) GetFiles(category *Category, folder *Folder, limit uint64) ([]*File, uint64, error) {
-	var sel = op.FileSelect(category, folder).Limit(limit)
+// parent folder of nil can be used to pull all top-level files.  If latest is
+// true, only the most recent version of each file is returned.  Files which
+// don't pass ff are skipped.
+func (op *Operation) GetFiles(category *Category, folder *Folder, latest bool, ff FileFilter, limit uint64) ([]*File, uint64, error) {
+	var sel = op.FileSelect(category, folder).LatestOnly(latest).Filter(ff).Limit(limit)
 	var files []*File
 	var count, err = sel.AllObjects(&files)
 	return files, count, err
 }
 
-// SearchFiles finds all files which are *descendents* of the given
-// category/folder and match the term
-//
-// Note that folder data is *not* filled in on the returns files.  Pulling
-// folders from the database is unnecessary since all folder lookups are via
-// path, so this reduces the amount of information we pull from the database
-// and simplifies the code quite a bit.
-func (op *Operation) SearchFiles(category *Category, folder *Folder, term string, limit uint64) ([]*File, uint64, error) {
-	var sel = op.FileSelect(category, folder).TreeMode(true).Search("public_path LIKE ?", term).Limit(limit)
+// GetAllFiles returns every file which is a descendent of the given
+// category/folder and isn't hidden by r, with no limit
+func (op *Operation) GetAllFiles(category *Category, folder *Folder, r *Restrictions) ([]*File, error) {
 	var files []*File
-	var count, err = sel.AllObjects(&files)
-	return files, count, err
+	var _, err = op.FileSelect(category, folder).TreeMode(true).Restrict(r).AllObjects(&files)
+	return files, err
+}
+
+// FilesAfterID returns up to limit files with ids greater than afterID, in id
+// order, optionally restricted to a category and everything under a folder.
+// This allows walking through large parts of the catalog without loading it
+// all at once.
+func (op *Operation) FilesAfterID(category *Category, folder *Folder, afterID uint64, limit uint64) ([]*File, error) {
+	var where = []string{"id > ?"}
+	var args = []interface{}{afterID}
+	if category != nil {
+		where = append(where, "category_id = ?")
+		args = append(args, category.ID)
+	}
+	if folder != nil {
+		where = append(where, "public_path LIKE ?")
+		args = append(args, folder.PublicPath+"/%")
+	}
+
+	var files []*File
+	op.Files.Select().Where(strings.Join(where, " AND "), args...).Order("id").Limit(limit).AllObjects(&files)
+	return files, op.Operation.Err()
 }
 
 // SearchFolders finds all folders which are *descendents* of the given
-// category/folder and match the term
+// category/folder and match the term, as ff's viewer would see them
 //
 // Note that parent folder data is *not* filled in on the returns files.
 // Pulling folders from the database is unnecessary since all folder lookups
 // are via path, so this reduces the amount of information we pull from the
 // database and simplifies the code quite a bit.
-func (op *Operation) SearchFolders(category *Category, folder *Folder, term string, limit uint64) ([]*Folder, uint64, error) {
-	var sel = op.FolderSelect(category, folder).TreeMode(true).Search("name LIKE ?", term).Limit(limit)
+func (op *Operation) SearchFolders(category *Category, folder *Folder, term string, ff FileFilter, limit uint64) ([]*Folder, uint64, error) {
+	var sel = op.FolderSelect(category, folder).TreeMode(true).Search("name LIKE ?", term).Filter(ff).Limit(limit)
+	var folders []*Folder
+	var count, err = sel.AllObjects(&folders)
+	return folders, count, err
+}
+
+// SearchAnnotatedFiles finds all files which are *descendents* of the given
+// category/folder and have a note containing term or a tag equal to it, as
+// ff's viewer would see them
+func (op *Operation) SearchAnnotatedFiles(category *Category, folder *Folder, term string, ff FileFilter, limit uint64) ([]*File, uint64, error) {
+	var sel = op.FileSelect(category, folder).TreeMode(true).Annotated(term).Filter(ff).Limit(limit)
+	var files []*File
+	var count, err = sel.AllObjects(&files)
+	return files, count, err
+}
+
+// SearchDescribedFiles finds all files which are *descendents* of the given
+// category/folder and have a descriptive metadata value containing term, as
+// ff's viewer would see them
+func (op *Operation) SearchDescribedFiles(category *Category, folder *Folder, term string, ff FileFilter, limit uint64) ([]*File, uint64, error) {
+	var sel = op.FileSelect(category, folder).TreeMode(true).Described(term).Filter(ff).Limit(limit)
+	var files []*File
+	var count, err = sel.AllObjects(&files)
+	return files, count, err
+}
+
+// SearchDescribedFolders is SearchDescribedFiles for folders
+func (op *Operation) SearchDescribedFolders(category *Category, folder *Folder, term string, ff FileFilter, limit uint64) ([]*Folder, uint64, error) {
+	var sel = op.FolderSelect(category, folder).TreeMode(true).Described(term).Filter(ff).Limit(limit)
+	var folders []*Folder
+	var count, err = sel.AllObjects(&folders)
+	return folders, count, err
+}
+
+// SearchAnnotatedFolders is SearchAnnotatedFiles for folders
+func (op *Operation) SearchAnnotatedFolders(category *Category, folder *Folder, term string, ff FileFilter, limit uint64) ([]*Folder, uint64, error) {
+	var sel = op.FolderSelect(category, folder).TreeMode(true).Annotated(term).Filter(ff).Limit(limit)
 	var folders []*Folder
 	var count, err = sel.AllObjects(&folders)
 	return folders, count, err
@@ -272,6 +505,64 @@ func (op *Operation) FindFileByID(id uint64) (*File, error) {
 	return file, op.Operation.Err()
 }
 
+// GetFileVersions returns every version of the file at the given public path,
+// newest first
+func (op *Operation) GetFileVersions(c *Category, publicPath string) ([]*File, error) {
+	var files []*File
+	var where = "category_id = ? AND public_path = ?"
+	op.Files.Select().Where(where, c.ID, publicPath).Order("archive_date DESC").AllObjects(&files)
+	for _, f := range files {
+		f.Category = c
+	}
+	return files, op.Operation.Err()
+}
+
+// FindFileByPublicID returns the file with the given public id, or nil if
+// none is found.  If pid is an old id (see AddPublicIDAliases), the file it
+// now refers to is returned, so callers wanting to redirect to the current
+// id should compare it to pid.
+func (op *Operation) FindFileByPublicID(pid string) (*File, error) {
+	var file = &File{}
+	var ok = op.Files.Select().Where("public_id = ?", pid).First(file)
+	if !ok {
+		var current = op.resolveAlias(pid)
+		ok = current != "" && op.Files.Select().Where("public_id = ?", current).First(file)
+	}
+	if !ok {
+		file = nil
+	}
+	return file, op.Operation.Err()
+}
+
+// FindFolderByPublicID returns the folder with the given public id, or nil if
+// none is found.  The folder's Category is populated.  As with
+// FindFileByPublicID, an old id finds the folder it now refers to.
+func (op *Operation) FindFolderByPublicID(pid string) (*Folder, error) {
+	var folder = &Folder{}
+	var ok = op.Folders.Select().Where("public_id = ?", pid).First(folder)
+	if !ok {
+		var current = op.resolveAlias(pid)
+		ok = current != "" && op.Folders.Select().Where("public_id = ?", current).First(folder)
+	}
+	if !ok {
+		return nil, op.Operation.Err()
+	}
+	op.PopulateCategories(nil, []*Folder{folder})
+	return folder, op.Operation.Err()
+}
+
+// FindFile returns the file in the given category with the given archive date
+// and public path, or nil if there is no such file
+func (op *Operation) FindFile(c *Category, archiveDate, publicPath string) (*File, error) {
+	var file = &File{}
+	var where = "category_id = ? AND archive_date = ? AND public_path = ?"
+	var ok = op.Files.Select().Where(where, c.ID, archiveDate, publicPath).First(file)
+	if !ok {
+		file = nil
+	}
+	return file, op.Operation.Err()
+}
+
 // PopulateCategories fills in the category data for all passed-in files and folders
 func (op *Operation) PopulateCategories(files []*File, folders []*Folder) error {
 	var categoryLookup = make(map[int]*Category)
@@ -291,30 +582,99 @@ func (op *Operation) PopulateCategories(files []*File, folders []*Folder) error
 	return nil
 }
 
-func (op *Operation) appendFiles(files []*File, ids []uint64) []*File {
-	var where = "id IN (" + strings.Repeat("?, ", len(ids)-1) + "?)"
-	var args []interface{}
-	for _, id := range ids {
-		args = append(args, id)
-	}
+func (op *Operation) appendFiles(files []*File, field string, ids []interface{}) []*File {
+	var where = field + " IN (" + strings.Repeat("?, ", len(ids)-1) + "?)"
 	var tempFiles []*File
-	op.Files.Select().Where(where, args...).AllObjects(&tempFiles)
+	op.Files.Select().Where(where, ids...).AllObjects(&tempFiles)
 	return append(files, tempFiles...)
 }
 
 // GetFilesByIDs returns a list of File instances for the given ids
 func (op *Operation) GetFilesByIDs(ids []uint64) ([]*File, error) {
+	var args []interface{}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	return op.getFilesBy("id", args)
+}
+
+// GetFilesByPublicIDs returns a list of File instances for the given public
+// ids.  Old ids (see AddPublicIDAliases) find the files they now refer to.
+func (op *Operation) GetFilesByPublicIDs(pids []string) ([]*File, error) {
+	var args []interface{}
+	for _, pid := range pids {
+		args = append(args, pid)
+	}
+	var files, err = op.getFilesBy("public_id", args)
+	if err != nil || len(files) == len(pids) {
+		return files, err
+	}
+
+	var found = make(map[string]bool)
+	for _, f := range files {
+		found[f.PublicID] = true
+	}
+	var missing []interface{}
+	for _, pid := range pids {
+		if !found[pid] {
+			missing = append(missing, pid)
+		}
+	}
+	var current []interface{}
+	eachChunk(missing, func(chunk []interface{}) {
+		var rows = op.Operation.Query("SELECT public_id FROM public_id_aliases WHERE old_public_id IN "+
+			placeholders(len(chunk)), chunk...)
+		for rows.Next() {
+			var pid string
+			rows.Scan(&pid)
+			if !found[pid] {
+				found[pid] = true
+				current = append(current, pid)
+			}
+		}
+		rows.Close()
+	})
+	if len(current) == 0 {
+		return files, op.Operation.Err()
+	}
+	return op.getFilesBy("public_id", append(args, current...))
+}
+
+// GetFilesByChecksums returns every file whose checksum is one of sums,
+// skipping files hidden by r.  Case doesn't matter; checksums are stored
+// lowercased.
+func (op *Operation) GetFilesByChecksums(sums []string, r *Restrictions) ([]*File, error) {
+	var args []interface{}
+	for _, sum := range sums {
+		args = append(args, strings.ToLower(sum))
+	}
+	var files, err = op.getFilesBy("checksum", args)
+	return r.FilterFiles(files), err
+}
+
+// GetFilesByPublicPaths returns every version of every file whose public
+// path is one of paths, in any category, skipping files hidden by r
+func (op *Operation) GetFilesByPublicPaths(paths []string, r *Restrictions) ([]*File, error) {
+	var args []interface{}
+	for _, p := range paths {
+		args = append(args, p)
+	}
+	var files, err = op.getFilesBy("public_path", args)
+	return r.FilterFiles(files), err
+}
+
+func (op *Operation) getFilesBy(field string, ids []interface{}) ([]*File, error) {
 	var files []*File
 
 	// split ids into chunks that can work in an IN query - I can't find any
 	// details on what a real limit might be, so we just split at 1000 and hope
 	// for the best
 	for len(ids) > 1000 {
-		files = op.appendFiles(files, ids[:1000])
+		files = op.appendFiles(files, field, ids[:1000])
 		ids = ids[1000:]
 	}
 	if len(ids) > 0 {
-		files = op.appendFiles(files, ids)
+		files = op.appendFiles(files, field, ids)
 	}
 
 	// We have to sort after the fact since we don't know how many passes it took
@@ -330,58 +690,6 @@ func (op *Operation) GetFilesByIDs(ids []uint64) ([]*File, error) {
 	return files, op.Operation.Err()
 }
 
-// QueueArchiveJob creates a new archive job in the database for async processing
-func (op *Operation) QueueArchiveJob(addrs []*mail.Address, files []*File) error {
-	if len(files) == 0 {
-		return fmt.Errorf("no files to archive")
-	}
-
-	if len(addrs) == 0 {
-		return fmt.Errorf("no notification addresses for archive job")
-	}
-
-	var filePaths []string
-	for _, f := range files {
-		filePaths = append(filePaths, f.FullPath)
-	}
-
-	var emails []string
-	for _, addr := range addrs {
-		emails = append(emails, addr.String())
-	}
-
-	op.ArchiveJobs.Save(&ArchiveJob{
-		CreatedAt:          time.Now(),
-		NotificationEmails: strings.Join(emails, ","),
-		Files:              strings.Join(filePaths, "\x1E"),
-	})
-	return op.Operation.Err()
-}
-
-// ProcessArchiveJob pulls the longest-waiting archive job and runs the
-// callback with it.  If the callback returns success, the archive job is
-// removed from the database.  If no job is found, the callback isn't run.
-func (op *Operation) ProcessArchiveJob(cb func(*ArchiveJob) bool) error {
-	var j = &ArchiveJob{}
-	var sel = op.ArchiveJobs.Select().Where("next_attempt_at < ? AND processed = ?", time.Now(), false)
-	var ok = sel.Order("created_at ASC").Limit(1).First(j)
-	if op.Operation.Err() != nil {
-		return op.Operation.Err()
-	}
-	if !ok {
-		return nil
-	}
-
-	if cb(j) {
-		j.Processed = true
-	} else {
-		j.NextAttemptAt = time.Now().Add(time.Hour)
-	}
-
-	op.ArchiveJobs.Save(j)
-	return op.Operation.Err()
-}
-
 // GetRealFolders returns real folders that can get to the given collapsed /
 // public folder
 func (op *Operation) GetRealFolders(f *Folder) ([]*RealFolder, error) {
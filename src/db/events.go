@@ -0,0 +1,142 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uoregon-libraries/headlamp/src/version"
+)
+
+// SoftwareAgent returns the agent name used for events recorded by one of
+// Headlamp's own commands
+func SoftwareAgent(command string) string {
+	return fmt.Sprintf("Headlamp %s v%s", command, version.Version)
+}
+
+// NewFileEvent returns a successful event of the given type for f, occurring
+// now.  The caller may change the outcome or set details before writing it.
+func NewFileEvent(eventType string, f *File, agent, agentType string) *Event {
+	return &Event{
+		EventType:    eventType,
+		OccurredAt:   time.Now(),
+		FilePublicID: f.PublicID,
+		Agent:        agent,
+		AgentType:    agentType,
+		Outcome:      EventSuccess,
+	}
+}
+
+// NewInventoryEvent returns a successful event of the given type for inv,
+// occurring now
+func NewInventoryEvent(eventType string, inv *Inventory, agent, agentType string) *Event {
+	return &Event{
+		EventType:     eventType,
+		OccurredAt:    time.Now(),
+		InventoryPath: inv.Path,
+		Agent:         agent,
+		AgentType:     agentType,
+		Outcome:       EventSuccess,
+	}
+}
+
+// WriteEvents stores all the given events
+func (op *Operation) WriteEvents(events ...*Event) error {
+	for _, e := range events {
+		op.Events.Save(e)
+	}
+	return op.Operation.Err()
+}
+
+// LatestFileEvent returns the most recent event of the given type recorded
+// for f, or nil if there are none
+func (op *Operation) LatestFileEvent(f *File, eventType string) (*Event, error) {
+	var e = &Event{}
+	var sel = op.Events.Select().Where("file_public_id = ? AND event_type = ?", f.PublicID, eventType)
+	var ok = sel.Order("occurred_at DESC, id DESC").Limit(1).First(e)
+	if !ok {
+		return nil, op.Operation.Err()
+	}
+	return e, op.Operation.Err()
+}
+
+// InventoryPaths returns a map of inventory ids to paths for the inventories
+// which described the given files
+func (op *Operation) InventoryPaths(files []*File) (map[int]string, error) {
+	var ids []interface{}
+	var paths = make(map[int]string)
+	for _, f := range files {
+		if _, ok := paths[f.InventoryID]; !ok {
+			paths[f.InventoryID] = ""
+			ids = append(ids, f.InventoryID)
+		}
+	}
+
+	eachChunk(ids, func(chunk []interface{}) {
+		var invs []*Inventory
+		op.Inventories.Select().Where("id IN "+placeholders(len(chunk)), chunk...).AllObjects(&invs)
+		for _, inv := range invs {
+			paths[inv.ID] = inv.Path
+		}
+	})
+	return paths, op.Operation.Err()
+}
+
+// FileEvents returns the events recorded for the given files, along with
+// those recorded for the inventories which described them, oldest first
+func (op *Operation) FileEvents(files []*File) ([]*Event, error) {
+	var invPaths, err = op.InventoryPaths(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var pids, paths []interface{}
+	for _, f := range files {
+		pids = append(pids, f.PublicID)
+	}
+	for _, p := range invPaths {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+
+	var events []*Event
+	var appendEvents = func(where string, args []interface{}) {
+		var list []*Event
+		op.Events.Select().Where(where, args...).AllObjects(&list)
+		events = append(events, list...)
+	}
+	eachChunk(pids, func(chunk []interface{}) {
+		appendEvents("file_public_id IN "+placeholders(len(chunk)), chunk)
+	})
+	eachChunk(paths, func(chunk []interface{}) {
+		appendEvents("file_public_id = '' AND inventory_path IN "+placeholders(len(chunk)), chunk)
+	})
+
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].OccurredAt.Equal(events[j].OccurredAt) {
+			return events[i].ID < events[j].ID
+		}
+		return events[i].OccurredAt.Before(events[j].OccurredAt)
+	})
+	return events, op.Operation.Err()
+}
+
+// eachChunk splits args into chunks small enough to use in an IN query and
+// runs fn on each one
+func eachChunk(args []interface{}, fn func([]interface{})) {
+	for len(args) > 500 {
+		fn(args[:500])
+		args = args[500:]
+	}
+	if len(args) > 0 {
+		fn(args)
+	}
+}
+
+// placeholders returns a parenthesized list of n "?" placeholders for an IN
+// query
+func placeholders(n int) string {
+	return "(?" + strings.Repeat(",?", n-1) + ")"
+}
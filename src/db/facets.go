@@ -0,0 +1,190 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Facet names
+const (
+	FacetCategory  = "category"
+	FacetYear      = "year"
+	FacetExtension = "ext"
+	FacetFormat    = "format"
+	FacetSize      = "size"
+)
+
+// maxFacetValues is how many values a facet shows, most common first.  Years
+// and sizes have few enough values to show them all.
+const maxFacetValues = 10
+
+// Facet counts the files a search or browse would show by one of their
+// properties
+type Facet struct {
+	Name   string // One of the Facet constants
+	Values []*FacetValue
+}
+
+// FacetValue is one value of a facet and how many files have it.  Narrowing
+// results to those files means searching Category, for the category facet,
+// or adding Filters for every other facet.
+type FacetValue struct {
+	Label    string
+	Count    uint64
+	Category *Category
+	Filters  Filters
+}
+
+// sizeBuckets are the size facet's values
+var sizeBuckets = []struct {
+	label    string
+	min, max int64
+}{
+	{"under 1 MiB", 0, 1<<20 - 1},
+	{"1 MiB to 10 MiB", 1 << 20, 10<<20 - 1},
+	{"10 MiB to 100 MiB", 10 << 20, 100<<20 - 1},
+	{"100 MiB to 1 GiB", 100 << 20, 1<<30 - 1},
+	{"1 GiB or more", 1 << 30, 0},
+}
+
+// extensionSQL extracts a file's lowercased extension from its name: RTRIM
+// strips every trailing character which isn't a dot, leaving the name up to
+// its last dot, which REPLACE then removes
+const extensionSQL = `CASE WHEN INSTR(name, '.') = 0 THEN ''
+	ELSE LOWER(REPLACE(name, RTRIM(name, REPLACE(name, '.', '')), '')) END`
+
+// Facets counts the files the select would return by category (only when it
+// isn't limited to one category), archive year, extension, identified format,
+// and size.  Facets with no values, e.g., formats when nothing has been
+// identified, are left out.
+func (s *FSelect) Facets() ([]*Facet, error) {
+	s.build(false)
+	var where = strings.Join(s.whereFields, " AND ")
+
+	var facets []*Facet
+	if s.category == nil {
+		facets = append(facets, s.categoryFacet(where))
+	}
+	facets = append(facets, s.yearFacet(where), s.extensionFacet(where), s.formatFacet(where), s.sizeFacet(where))
+
+	var list []*Facet
+	for _, f := range facets {
+		if len(f.Values) > 0 {
+			list = append(list, f)
+		}
+	}
+	return list, s.op.Operation.Err()
+}
+
+// facetCounts runs a grouped query, returning each value and its count in
+// the order the query returns them.  sql must select a value and a count.
+func (s *FSelect) facetCounts(sql string, args ...interface{}) (values []string, counts []uint64) {
+	var rows = s.op.Operation.Query(sql, args...)
+	for rows.Next() {
+		var val string
+		var n uint64
+		rows.Scan(&val, &n)
+		values = append(values, val)
+		counts = append(counts, n)
+	}
+	rows.Close()
+	return values, counts
+}
+
+// groupFiles counts the selected files by expr
+func (s *FSelect) groupFiles(expr, where, order string, limit int) ([]string, []uint64) {
+	var sql = fmt.Sprintf("SELECT %s AS value, COUNT(*) FROM files WHERE %s GROUP BY value ORDER BY %s",
+		expr, where, order)
+	if limit > 0 {
+		sql += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	return s.facetCounts(sql, s.whereArgs...)
+}
+
+func (s *FSelect) categoryFacet(where string) *Facet {
+	var f = &Facet{Name: FacetCategory}
+	var categories, _ = s.op.AllCategories()
+	var byID = make(map[string]*Category)
+	for _, c := range categories {
+		byID[fmt.Sprint(c.ID)] = c
+	}
+
+	var values, counts = s.groupFiles("CAST(category_id AS TEXT)", where, "COUNT(*) DESC, value", maxFacetValues)
+	for i, val := range values {
+		var c = byID[val]
+		if c != nil {
+			f.Values = append(f.Values, &FacetValue{Label: c.Name, Count: counts[i], Category: c})
+		}
+	}
+	return f
+}
+
+func (s *FSelect) yearFacet(where string) *Facet {
+	var f = &Facet{Name: FacetYear}
+	var values, counts = s.groupFiles("SUBSTR(archive_date, 1, 4)", where, "value", 0)
+	for i, year := range values {
+		f.Values = append(f.Values, &FacetValue{
+			Label:   year,
+			Count:   counts[i],
+			Filters: Filters{FromDate: year + "-01-01", ToDate: year + "-12-31"},
+		})
+	}
+	return f
+}
+
+// extensionFacet counts files by extension.  Files without one aren't
+// counted, since there's no filter for them.
+func (s *FSelect) extensionFacet(where string) *Facet {
+	var f = &Facet{Name: FacetExtension}
+	var values, counts = s.groupFiles(extensionSQL, where+" AND name LIKE '%.%'", "COUNT(*) DESC, value", maxFacetValues+1)
+	for i, ext := range values {
+		if ext != "" && len(f.Values) < maxFacetValues {
+			f.Values = append(f.Values, &FacetValue{Label: ext, Count: counts[i], Filters: Filters{Extension: ext}})
+		}
+	}
+	return f
+}
+
+// formatFacet counts files by their most recently identified format.  Files
+// which haven't been identified aren't counted.
+func (s *FSelect) formatFacet(where string) *Facet {
+	var f = &Facet{Name: FacetFormat}
+	var sql = `SELECT e.detail AS value, COUNT(*) FROM events e
+		WHERE e.event_type = ? AND e.outcome = ? AND e.id = (
+			SELECT MAX(l.id) FROM events l
+			WHERE l.file_public_id = e.file_public_id AND l.event_type = e.event_type AND l.outcome = e.outcome)
+		AND e.file_public_id IN (SELECT public_id FROM files WHERE ` + where + `)
+		GROUP BY value ORDER BY COUNT(*) DESC, value LIMIT ` + fmt.Sprint(maxFacetValues)
+	var args = append([]interface{}{EventFormatIdentification, EventSuccess}, s.whereArgs...)
+	var values, counts = s.facetCounts(sql, args...)
+	for i, format := range values {
+		f.Values = append(f.Values, &FacetValue{Label: format, Count: counts[i], Filters: Filters{Format: format}})
+	}
+	return f
+}
+
+func (s *FSelect) sizeFacet(where string) *Facet {
+	var f = &Facet{Name: FacetSize}
+	var cases []string
+	for i, b := range sizeBuckets {
+		if b.max > 0 {
+			cases = append(cases, fmt.Sprintf("WHEN filesize <= %d THEN %d", b.max, i))
+		} else {
+			cases = append(cases, fmt.Sprintf("ELSE %d", i))
+		}
+	}
+	var expr = "CASE " + strings.Join(cases, " ") + " END"
+
+	var values, counts = s.groupFiles(expr, where, "CAST(value AS INTEGER)", 0)
+	for i, val := range values {
+		var idx int
+		fmt.Sscan(val, &idx)
+		var b = sizeBuckets[idx]
+		f.Values = append(f.Values, &FacetValue{
+			Label:   b.label,
+			Count:   counts[i],
+			Filters: Filters{MinSize: b.min, MaxSize: b.max},
+		})
+	}
+	return f
+}
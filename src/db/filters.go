@@ -0,0 +1,207 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Filters narrows a file query by the files' own properties.  Each field
+// which is set must match; the zero value matches every file.
+type Filters struct {
+	FromDate  string // Earliest archive date, YYYY-MM-DD
+	ToDate    string // Latest archive date, YYYY-MM-DD
+	MinSize   int64  // Smallest file size in bytes
+	MaxSize   int64  // Largest file size in bytes; zero means no limit
+	Extension string // File extension without the dot, e.g., "tif"
+	Format    string // Identified format (MIME type); "%" matches anything
+	Checksum  string // Exact checksum; checksums are stored lowercased
+	Inventory string // An inventory's path, or its id (the batch number)
+}
+
+// FilterNames lists the name of each filter, as used in URLs and on the
+// command line, in the order they're usually shown
+var FilterNames = []string{"from", "to", "minsize", "maxsize", "ext", "format", "checksum", "inventory"}
+
+// Empty returns true if no filters are set
+func (f Filters) Empty() bool {
+	return f == Filters{}
+}
+
+// Set parses value and stores it as the named filter (see FilterNames).  An
+// empty value clears the filter.
+func (f *Filters) Set(name, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch name {
+	case "from", "to":
+		if value != "" {
+			_, err = time.Parse("2006-01-02", value)
+			if err != nil {
+				return fmt.Errorf("invalid date %q; dates must be formatted as YYYY-MM-DD", value)
+			}
+		}
+		if name == "from" {
+			f.FromDate = value
+		} else {
+			f.ToDate = value
+		}
+	case "minsize":
+		f.MinSize, err = ParseSize(value)
+	case "maxsize":
+		f.MaxSize, err = ParseSize(value)
+	case "ext":
+		f.Extension = strings.ToLower(strings.TrimPrefix(value, "."))
+	case "format":
+		f.Format = strings.ToLower(value)
+	case "checksum":
+		f.Checksum = strings.ToLower(value)
+	case "inventory":
+		f.Inventory = value
+	default:
+		return fmt.Errorf("unknown filter %q", name)
+	}
+	return err
+}
+
+// Get returns the named filter's value as Set would read it, or an empty
+// string if the filter isn't set
+func (f Filters) Get(name string) string {
+	switch name {
+	case "from":
+		return f.FromDate
+	case "to":
+		return f.ToDate
+	case "minsize":
+		if f.MinSize > 0 {
+			return strconv.FormatInt(f.MinSize, 10)
+		}
+	case "maxsize":
+		if f.MaxSize > 0 {
+			return strconv.FormatInt(f.MaxSize, 10)
+		}
+	case "ext":
+		return f.Extension
+	case "format":
+		return f.Format
+	case "checksum":
+		return f.Checksum
+	case "inventory":
+		return f.Inventory
+	}
+	return ""
+}
+
+// sizeUnits are the suffixes ParseSize understands
+var sizeUnits = map[string]int64{
+	"":  1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+	"t": 1 << 40,
+}
+
+// ParseSize reads a file size in bytes, optionally followed by K, M, G, or T
+// (with or without a trailing "B") for kibibytes, mebibytes, and so on, e.g.
+// "1500", "10M", or "2.5 GB".  An empty string is zero.
+func ParseSize(s string) (int64, error) {
+	var lower = strings.ToLower(strings.TrimSpace(s))
+	if lower == "" {
+		return 0, nil
+	}
+	lower = strings.TrimSuffix(lower, "b")
+	var num = strings.TrimRight(lower, "kmgt")
+	var mult, ok = sizeUnits[strings.TrimSpace(lower[len(num):])]
+	var n, err = strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if !ok || err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// formatSQL matches files whose most recent successful format identification
+// is LIKE a term
+const formatSQL = `public_id IN (SELECT e.file_public_id FROM events e
+	WHERE e.event_type = ? AND e.outcome = ? AND e.detail LIKE ? AND e.id = (
+		SELECT MAX(l.id) FROM events l
+		WHERE l.file_public_id = e.file_public_id AND l.event_type = e.event_type AND l.outcome = e.outcome))`
+
+// sql returns a WHERE clause matching files which pass the filters.  prefix
+// is prepended to each column name, for queries using a table alias.
+func (f Filters) sql(prefix string) (string, []interface{}) {
+	var where = []string{"1 = 1"}
+	var args []interface{}
+	var add = func(clause string, vals ...interface{}) {
+		where = append(where, clause)
+		args = append(args, vals...)
+	}
+
+	if f.FromDate != "" {
+		add(prefix+"archive_date >= ?", f.FromDate)
+	}
+	if f.ToDate != "" {
+		add(prefix+"archive_date <= ?", f.ToDate)
+	}
+	if f.MinSize > 0 {
+		add(prefix+"filesize >= ?", f.MinSize)
+	}
+	if f.MaxSize > 0 {
+		add(prefix+"filesize <= ?", f.MaxSize)
+	}
+	if f.Extension != "" {
+		var suffix = "." + f.Extension
+		add("LOWER(SUBSTR("+prefix+"name, -?)) = ?", utf8.RuneCountInString(suffix), suffix)
+	}
+	if f.Format != "" {
+		add(prefix+formatSQL, EventFormatIdentification, EventSuccess, f.Format)
+	}
+	if f.Checksum != "" {
+		add(prefix+"checksum = ?", f.Checksum)
+	}
+	if f.Inventory != "" {
+		var id, err = strconv.Atoi(f.Inventory)
+		if err == nil {
+			add(prefix+"inventory_id = ?", id)
+		} else {
+			add(prefix+"inventory_id IN (SELECT id FROM inventories WHERE path = ?)", f.Inventory)
+		}
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// Combine returns filters which pass only the files which pass both f and o.
+// Ranges are narrowed to their overlap; an error is returned if f and o want
+// different values for a filter which can hold only one, such as two
+// different extensions.
+func (f Filters) Combine(o Filters) (Filters, error) {
+	if o.FromDate > f.FromDate {
+		f.FromDate = o.FromDate
+	}
+	if o.ToDate != "" && (f.ToDate == "" || o.ToDate < f.ToDate) {
+		f.ToDate = o.ToDate
+	}
+	if o.MinSize > f.MinSize {
+		f.MinSize = o.MinSize
+	}
+	if o.MaxSize > 0 && (f.MaxSize == 0 || o.MaxSize < f.MaxSize) {
+		f.MaxSize = o.MaxSize
+	}
+
+	var err error
+	var pick = func(name, a, b string) string {
+		if a != "" && b != "" && a != b && err == nil {
+			err = fmt.Errorf("conflicting %s filters %q and %q", name, a, b)
+		}
+		if a == "" {
+			return b
+		}
+		return a
+	}
+	f.Extension = pick("extension", f.Extension, o.Extension)
+	f.Format = pick("format", f.Format, o.Format)
+	f.Checksum = pick("checksum", f.Checksum, o.Checksum)
+	f.Inventory = pick("inventory", f.Inventory, o.Inventory)
+	return f, err
+}
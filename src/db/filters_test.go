@@ -0,0 +1,166 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	var tests = []struct {
+		in   string
+		want int64
+		err  bool
+	}{
+		{in: "", want: 0},
+		{in: "  ", want: 0},
+		{in: "1500", want: 1500},
+		{in: "1500b", want: 1500},
+		{in: "10K", want: 10 << 10},
+		{in: "10kb", want: 10 << 10},
+		{in: "10M", want: 10 << 20},
+		{in: "2.5 GB", want: 5 << 29},
+		{in: "1T", want: 1 << 40},
+		{in: " 3 m ", want: 3 << 20},
+		{in: "0.5K", want: 512},
+		{in: "lots", err: true},
+		{in: "10X", err: true},
+		{in: "10MK", err: true},
+		{in: "-1", err: true},
+		{in: "M", err: true},
+	}
+
+	for _, tc := range tests {
+		var got, err = ParseSize(tc.in)
+		if tc.err {
+			if err == nil {
+				t.Errorf("ParseSize(%q): expected an error, got %d", tc.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSize(%q): unexpected error: %s", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("ParseSize(%q): got %d, expected %d", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestFiltersCombine(t *testing.T) {
+	var tests = []struct {
+		name string
+		a, b Filters
+		want Filters
+		err  string // Text the error must contain; empty means no error
+	}{
+		{name: "empty", want: Filters{}},
+		{
+			name: "one side",
+			a:    Filters{FromDate: "2017-01-01", MaxSize: 10, Extension: "tif"},
+			want: Filters{FromDate: "2017-01-01", MaxSize: 10, Extension: "tif"},
+		},
+		{
+			name: "other side",
+			b:    Filters{ToDate: "2017-12-31", MinSize: 10, Checksum: "abc"},
+			want: Filters{ToDate: "2017-12-31", MinSize: 10, Checksum: "abc"},
+		},
+		{
+			name: "overlapping ranges",
+			a:    Filters{FromDate: "2017-01-01", ToDate: "2017-06-30", MinSize: 10, MaxSize: 100},
+			b:    Filters{FromDate: "2017-03-01", ToDate: "2017-12-31", MinSize: 5, MaxSize: 50},
+			want: Filters{FromDate: "2017-03-01", ToDate: "2017-06-30", MinSize: 10, MaxSize: 50},
+		},
+		{
+			name: "same values",
+			a:    Filters{Extension: "tif", Format: "image/tiff", Inventory: "3"},
+			b:    Filters{Extension: "tif", Format: "image/tiff", Inventory: "3"},
+			want: Filters{Extension: "tif", Format: "image/tiff", Inventory: "3"},
+		},
+		{name: "conflicting extensions", a: Filters{Extension: "tif"}, b: Filters{Extension: "pdf"}, err: "extension"},
+		{name: "conflicting formats", a: Filters{Format: "image/tiff"}, b: Filters{Format: "%pdf%"}, err: "format"},
+		{name: "conflicting checksums", a: Filters{Checksum: "abc"}, b: Filters{Checksum: "def"}, err: "checksum"},
+		{name: "conflicting inventories", a: Filters{Inventory: "1"}, b: Filters{Inventory: "2"}, err: "inventory"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got, err = tc.a.Combine(tc.b)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if got != tc.want {
+				t.Errorf("Got %#v, expected %#v", got, tc.want)
+			}
+
+			// Combining is symmetric
+			got, err = tc.b.Combine(tc.a)
+			if err != nil || got != tc.want {
+				t.Errorf("Reversed: got %#v (err: %v), expected %#v", got, err, tc.want)
+			}
+		})
+	}
+}
+
+// TestFiltersMatchLiterally makes sure folders are only matched by files
+// really inside them, and extensions only by files really ending in them.  A
+// LIKE pattern would treat "_" as a wildcard and ignore case.
+func TestFiltersMatchLiterally(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("photos")
+	for _, p := range []string{"a_b/one.TIF", "aXb/two.jpg", "A_B/three.jpg", "a_bc/four.tif"} {
+		var parts = strings.SplitN(p, "/", 2)
+		var folder, err = op.FindOrCreateFolder(c, nil, parts[0])
+		if err != nil {
+			t.Fatalf("Unable to create folder %q: %s", parts[0], err)
+		}
+		op.Files.Save(&File{CategoryID: c.ID, FolderID: folder.ID, ArchiveDate: "2020-01-01", Name: parts[1],
+			PublicPath: p, PublicID: FilePublicID(c.Name, "2020-01-01", p)})
+	}
+	var err = op.RecomputeAggregates()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var tests = []struct {
+		ext     string
+		files   []string
+		folders []string
+	}{
+		{ext: "tif", files: []string{"a_b/one.TIF", "a_bc/four.tif"}, folders: []string{"a_b", "a_bc"}},
+		{ext: "jpg", files: []string{"A_B/three.jpg", "aXb/two.jpg"}, folders: []string{"A_B", "aXb"}},
+		{ext: "_if", files: nil, folders: nil},
+	}
+	for _, tc := range tests {
+		var files []*File
+		var folders []*Folder
+		op.FileSelect(c, nil).TreeMode(true).Filters(Filters{Extension: tc.ext}).AllObjects(&files)
+		op.FolderSelect(c, nil).TreeMode(true).Filters(Filters{Extension: tc.ext}).AllObjects(&folders)
+		err = op.Operation.Err()
+		if err != nil {
+			t.Fatalf("Unable to filter by %q: %s", tc.ext, err)
+		}
+
+		var gotFiles, gotFolders []string
+		for _, f := range files {
+			gotFiles = append(gotFiles, f.PublicPath)
+		}
+		for _, f := range folders {
+			gotFolders = append(gotFolders, f.PublicPath)
+		}
+		sort.Strings(gotFiles)
+		sort.Strings(gotFolders)
+		if !equalStrings(gotFiles, tc.files) || !equalStrings(gotFolders, tc.folders) {
+			t.Errorf("Extension %q: got files %q and folders %q; expected %q and %q",
+				tc.ext, gotFiles, gotFolders, tc.files, tc.folders)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package db
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MaxJobAttempts is how many times we try to build an archive before giving
+// up and marking the job as failed
+const MaxJobAttempts = 5
+
+// QueueArchiveJob creates a new archive job in the database for async
+// processing and returns it.  requestedBy should identify the user asking
+// for the job.  The job and its files are separate rows, so this must be run
+// in a transaction (see Database.InTransaction); otherwise the archiver could
+// pick the job up before all its files are saved and build a partial archive.
+func (op *Operation) QueueArchiveJob(requestedBy string, addrs []*mail.Address, files []*File) (*ArchiveJob, error) {
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to archive")
+	}
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no notification addresses for archive job")
+	}
+
+	var emails []string
+	for _, addr := range addrs {
+		emails = append(emails, addr.String())
+	}
+
+	var now = time.Now()
+	var j = &ArchiveJob{
+		CreatedAt:          now,
+		NextAttemptAt:      now,
+		RequestedBy:        requestedBy,
+		NotificationEmails: strings.Join(emails, ","),
+		Status:             JobPending,
+	}
+	op.ArchiveJobs.Save(j)
+	for _, f := range files {
+		op.JobFiles.Save(&JobFile{JobID: j.ID, FileID: f.ID})
+	}
+	return j, op.Operation.Err()
+}
+
+// NextArchiveJob returns the longest-waiting pending archive job which is
+// due to be attempted, or nil if there isn't one
+func (op *Operation) NextArchiveJob() (*ArchiveJob, error) {
+	var j = &ArchiveJob{}
+	var sel = op.ArchiveJobs.Select().Where("next_attempt_at < ? AND status = ?", time.Now(), JobPending)
+	var ok = sel.Order("created_at ASC").Limit(1).First(j)
+	if !ok {
+		j = nil
+	}
+	return j, op.Operation.Err()
+}
+
+// FinishArchiveJob records an attempt at building the job's archive, which
+// started at the given time and returned err.  If err is nil, the job is
+// marked complete; otherwise the error is stored and the job is retried
+// later, up to MaxJobAttempts times.
+//
+// Building an archive can take a while, so a rebuilt catalog may have been
+// swapped in since the job was read.  Jobs keep their ids in a rebuilt
+// catalog, so j can be finished there.
+func (op *Operation) FinishArchiveJob(j *ArchiveJob, started time.Time, err error) error {
+	var attempt = &JobAttempt{JobID: j.ID, StartedAt: started, FinishedAt: time.Now()}
+	j.Attempts++
+
+	switch {
+	case err == nil:
+		j.Status = JobComplete
+		j.CompletedAt = attempt.FinishedAt
+		j.LastError = ""
+		op.writeDeliveryEvents(j)
+	case j.Attempts >= MaxJobAttempts:
+		j.Status = JobFailed
+		j.LastError = err.Error()
+	default:
+		j.NextAttemptAt = time.Now().Add(time.Hour)
+		j.LastError = err.Error()
+	}
+	attempt.Error = j.LastError
+
+	op.JobAttempts.Save(attempt)
+	op.ArchiveJobs.Save(j)
+	return op.Operation.Err()
+}
+
+// writeDeliveryEvents records the delivery of every file in a completed job
+func (op *Operation) writeDeliveryEvents(j *ArchiveJob) {
+	var files, err = op.GetDeliverableJobFiles(j, time.Now())
+	if err != nil {
+		return
+	}
+	for _, f := range files {
+		var ev = NewFileEvent(EventDissemination, f, j.RequestedBy, AgentPerson)
+		ev.Detail = fmt.Sprintf("Delivered in bulk archive job %d", j.ID)
+		op.WriteEvents(ev)
+	}
+}
+
+// GetJobFiles returns the catalog files which were requested for the given job
+func (op *Operation) GetJobFiles(j *ArchiveJob) ([]*File, error) {
+	var jobFiles []*JobFile
+	op.JobFiles.Select().Where("job_id = ?", j.ID).AllObjects(&jobFiles)
+	if op.Operation.Err() != nil {
+		return nil, op.Operation.Err()
+	}
+
+	var ids = make([]uint64, len(jobFiles))
+	for i, jf := range jobFiles {
+		ids[i] = jf.FileID
+	}
+	return op.GetFilesByIDs(ids)
+}
+
+// GetDeliverableJobFiles returns the job's files which its requester may
+// access at time t
+func (op *Operation) GetDeliverableJobFiles(j *ArchiveJob, t time.Time) ([]*File, error) {
+	var files, err = op.GetJobFiles(j)
+	if err != nil {
+		return nil, err
+	}
+	var r *Restrictions
+	r, err = op.RestrictionsFor(j.RequestedBy, t)
+	if err != nil {
+		return nil, err
+	}
+	return r.FilterFiles(files), nil
+}
+
+// GetJobAttempts returns all attempts made to build the given job, oldest first
+func (op *Operation) GetJobAttempts(j *ArchiveJob) ([]*JobAttempt, error) {
+	var attempts []*JobAttempt
+	op.JobAttempts.Select().Where("job_id = ?", j.ID).Order("started_at ASC").AllObjects(&attempts)
+	return attempts, op.Operation.Err()
+}
+
+// RecentArchiveJobs returns up to limit archive jobs, newest first
+func (op *Operation) RecentArchiveJobs(limit uint64) ([]*ArchiveJob, error) {
+	var jobs []*ArchiveJob
+	op.ArchiveJobs.Select().Order("created_at DESC").Limit(limit).AllObjects(&jobs)
+	return jobs, op.Operation.Err()
+}
+
+// FindArchiveJobByID returns the archive job with the given id, or nil if
+// none is found
+func (op *Operation) FindArchiveJobByID(id int) (*ArchiveJob, error) {
+	var j = &ArchiveJob{}
+	var ok = op.ArchiveJobs.Select().Where("id = ?", id).First(j)
+	if !ok {
+		j = nil
+	}
+	return j, op.Operation.Err()
+}
@@ -0,0 +1,43 @@
+package db
+
+// metadataSQL matches files or folders with a metadata value LIKE a term
+const metadataSQL = `public_id IN (SELECT public_id FROM metadata WHERE value LIKE ?)`
+
+// WriteMetadata stores descriptive metadata values
+func (op *Operation) WriteMetadata(list []*Metadata) error {
+	for _, m := range list {
+		op.Metadata.Save(m)
+	}
+	return op.Operation.Err()
+}
+
+// GetMetadata returns the descriptive metadata for the file or folder with
+// the given public id, in the order it was read
+func (op *Operation) GetMetadata(pid string) ([]*Metadata, error) {
+	var list []*Metadata
+	op.Metadata.Select().Where("public_id = ?", pid).Order("id").AllObjects(&list)
+	return list, op.Operation.Err()
+}
+
+// MetadataValues returns a map of public ids to the first value of the given
+// field for each, for showing a field such as the title alongside a list of
+// files or folders
+func (op *Operation) MetadataValues(pids []string, field string) (map[string]string, error) {
+	var args = make([]interface{}, len(pids))
+	for i, pid := range pids {
+		args[i] = pid
+	}
+
+	var values = make(map[string]string)
+	eachChunk(args, func(chunk []interface{}) {
+		var list []*Metadata
+		var where = "field = ? AND public_id IN " + placeholders(len(chunk))
+		op.Metadata.Select().Where(where, append([]interface{}{field}, chunk...)...).Order("id").AllObjects(&list)
+		for _, m := range list {
+			if _, ok := values[m.PublicID]; !ok {
+				values[m.PublicID] = m.Value
+			}
+		}
+	})
+	return values, op.Operation.Err()
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+)
+
+// Public ids are used in URLs, bookmarks, and citations instead of database
+// ids, which change if the catalog is ever rebuilt.  They're derived from the
+// same values which make a file or folder unique, so indexing the same
+// inventories into a new catalog produces the same ids.  Once assigned, an id
+// is stored and only recomputed when paths are (see the repath command), in
+// which case the old id becomes an alias for the new one.
+
+// FilePublicID returns the public id for a file with the given category name,
+// archive date, and public path
+func FilePublicID(category, archiveDate, publicPath string) string {
+	return publicID("f", category, archiveDate, publicPath)
+}
+
+// FolderPublicID returns the public id for a folder with the given category
+// name and public path
+func FolderPublicID(category, publicPath string) string {
+	return publicID("d", category, publicPath)
+}
+
+// publicID hashes the parts and returns the prefix followed by the first 80
+// bits of the hash, base32-encoded, e.g., "f3xk7q2mzv4b6nhda"
+func publicID(prefix string, parts ...string) string {
+	var sum = sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return prefix + strings.ToLower(base32.StdEncoding.EncodeToString(sum[:10]))
+}
+
+// MissingPublicIDs returns true if any file or folder has no public id yet
+func (op *Operation) MissingPublicIDs() (bool, error) {
+	var rows = op.Operation.Query(`SELECT 1 FROM files WHERE public_id = ''
+		UNION ALL SELECT 1 FROM folders WHERE public_id = '' LIMIT 1`)
+	var found = rows.Next()
+	rows.Close()
+	return found, op.Operation.Err()
+}
+
+// AssignPublicIDs gives every file and folder which doesn't have a public id
+// its derived id, returning how many rows were updated.  Rows whose category
+// doesn't exist are skipped, since there's nothing to derive an id from.
+func (op *Operation) AssignPublicIDs() (int, error) {
+	var n = op.assignPublicIDs(`
+		SELECT f.id, c.name, f.archive_date, f.public_path FROM files f
+		JOIN categories c ON c.id = f.category_id
+		WHERE f.public_id = '' LIMIT 1000`, "files", FilePublicID)
+	n += op.assignPublicIDs(`
+		SELECT d.id, c.name, '', d.public_path FROM folders d
+		JOIN categories c ON c.id = d.category_id
+		WHERE d.public_id = '' LIMIT 1000`, "folders", func(category, _, publicPath string) string {
+		return FolderPublicID(category, publicPath)
+	})
+	return n, op.Operation.Err()
+}
+
+// assignPublicIDs runs the given query, which must return rows needing an id,
+// over and over until no rows are returned, updating rows in the table with
+// the ids returned by derive
+func (op *Operation) assignPublicIDs(query, table string, derive func(category, archiveDate, publicPath string) string) int {
+	type row struct {
+		id                             uint64
+		category, archiveDate, pubPath string
+	}
+
+	var total int
+	for op.Operation.Err() == nil {
+		var rowList []row
+		var rows = op.Operation.Query(query)
+		for rows.Next() {
+			var r row
+			rows.Scan(&r.id, &r.category, &r.archiveDate, &r.pubPath)
+			rowList = append(rowList, r)
+		}
+		rows.Close()
+
+		if len(rowList) == 0 {
+			break
+		}
+		for _, r := range rowList {
+			var pid = derive(r.category, r.archiveDate, r.pubPath)
+			op.Operation.Exec("UPDATE "+table+" SET public_id = ? WHERE id = ?", pid, r.id)
+		}
+		total += len(rowList)
+	}
+
+	return total
+}
+
+// resolveAlias returns the public id which pid is an alias for, or an empty
+// string if it isn't an alias
+func (op *Operation) resolveAlias(pid string) string {
+	var current string
+	var rows = op.Operation.Query("SELECT public_id FROM public_id_aliases WHERE old_public_id = ?", pid)
+	if rows.Next() {
+		rows.Scan(&current)
+	}
+	rows.Close()
+	return current
+}
+
+// AddPublicIDAliases records that each key in aliases, an old public id,
+// now refers to the file or folder with the value's public id.  Aliases
+// already pointing to an old id are pointed at its new one, so links survive
+// more than one change.  Any alias whose old id belongs to a file or folder
+// again is removed.
+func (op *Operation) AddPublicIDAliases(aliases map[string]string) error {
+	for old, pid := range aliases {
+		op.Operation.Exec("UPDATE public_id_aliases SET public_id = ? WHERE public_id = ?", pid, old)
+		op.Operation.Exec("INSERT OR REPLACE INTO public_id_aliases (old_public_id, public_id) VALUES (?, ?)", old, pid)
+	}
+	op.Operation.Exec(`DELETE FROM public_id_aliases WHERE old_public_id = public_id
+		OR old_public_id IN (SELECT public_id FROM files)
+		OR old_public_id IN (SELECT public_id FROM folders)`)
+	return op.Operation.Err()
+}
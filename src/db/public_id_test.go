@@ -0,0 +1,50 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestPublicIDAliases makes sure a file can still be found by any id it has
+// had, even after its path is recomputed more than once
+func TestPublicIDAliases(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("photos")
+	var folder, _ = op.FindOrCreateFolder(c, nil, "box")
+	var file = &File{CategoryID: c.ID, FolderID: folder.ID, ArchiveDate: "2020-01-01", Name: "a.tif",
+		PublicPath: "box/a.tif", PublicID: "third"}
+	op.Files.Save(file)
+
+	var err = op.AddPublicIDAliases(map[string]string{"first": "second"})
+	if err == nil {
+		err = op.AddPublicIDAliases(map[string]string{"second": "third"})
+	}
+	if err != nil {
+		t.Fatalf("Unable to add aliases: %s", err)
+	}
+
+	for _, pid := range []string{"first", "second", "third"} {
+		var f, err = op.FindFileByPublicID(pid)
+		if err != nil {
+			t.Fatalf("Unable to look up %q: %s", pid, err)
+		}
+		if f == nil || f.ID != file.ID || f.PublicID != "third" {
+			t.Errorf("Looking up %q: expected file %d with id %q, got %#v", pid, file.ID, "third", f)
+		}
+	}
+
+	var f *File
+	f, err = op.FindFileByPublicID("unknown")
+	if err != nil || f != nil {
+		t.Errorf("Looking up an unknown id: expected nothing, got %#v (err: %v)", f, err)
+	}
+
+	// An alias whose old id is a real file's id again must not shadow it
+	err = op.AddPublicIDAliases(map[string]string{"third": "fourth"})
+	if err != nil {
+		t.Fatalf("Unable to add aliases: %s", err)
+	}
+	if op.resolveAlias("third") != "" {
+		t.Errorf("Expected the alias from a live file's id to be dropped")
+	}
+}
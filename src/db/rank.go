@@ -0,0 +1,134 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Ranking weighs the ways a file can match a search term, for ordering search
+// results by relevance.  A file's score is the sum of the weights of every
+// rule it meets, for every term; files with the same score are ordered by
+// depth, then path, as unranked results are.  A weight of zero turns its rule
+// off.
+type Ranking struct {
+	ExactName  int // The file's name is the term, e.g., "minutes.pdf"
+	NamePrefix int // The file's name starts with the term
+	PathWord   int // A word in the path is the term, e.g., "minutes" in "board/minutes-jan.pdf"
+}
+
+// rankRule is a single way to match a term.  sql is true for matching rows
+// when given arg(term); match does the same test in Go so rankings can be
+// explained.  Terms are matched literally, not as LIKE patterns, so "_" in a
+// term is just an underscore.
+type rankRule struct {
+	reason string
+	weight int
+	sql    string
+	arg    func(term string) string
+	match  func(f *File, term string) bool
+}
+
+// pathDelimiters separate the words in a path
+var pathDelimiters = []string{"/", ".", "_", "-"}
+
+// pathWordsSQL turns a path into its lowercased words, separated and
+// surrounded by spaces, so a word can be found by searching for " word "
+var pathWordsSQL = func() string {
+	var expr = "LOWER(public_path)"
+	for _, d := range pathDelimiters {
+		expr = fmt.Sprintf("REPLACE(%s, '%s', ' ')", expr, d)
+	}
+	return "(' ' || " + expr + " || ' ')"
+}()
+
+// pathWords is the Go version of pathWordsSQL
+func pathWords(p string) string {
+	p = lower(p)
+	for _, d := range pathDelimiters {
+		p = strings.Replace(p, d, " ", -1)
+	}
+	return " " + p + " "
+}
+
+// lower is the Go version of SQLite's LOWER, which only lowercases ASCII
+// letters
+func lower(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + 'a' - 'A'
+		}
+		return r
+	}, s)
+}
+
+func (rk Ranking) rules() []rankRule {
+	return []rankRule{
+		{
+			reason: "exact name match",
+			weight: rk.ExactName,
+			sql:    "LOWER(name) = ?",
+			arg:    lower,
+			match:  func(f *File, term string) bool { return lower(f.Name) == lower(term) },
+		},
+		{
+			reason: "name starts with",
+			weight: rk.NamePrefix,
+			sql:    "instr(LOWER(name), ?) = 1",
+			arg:    lower,
+			match: func(f *File, term string) bool {
+				return strings.HasPrefix(lower(f.Name), lower(term))
+			},
+		},
+		{
+			reason: "word in path",
+			weight: rk.PathWord,
+			sql:    "instr(" + pathWordsSQL + ", ?) > 0",
+			arg:    func(term string) string { return " " + lower(term) + " " },
+			match: func(f *File, term string) bool {
+				return strings.Contains(pathWords(f.PublicPath), " "+lower(term)+" ")
+			},
+		},
+	}
+}
+
+// rankable returns the terms which can be ranked: wildcard patterns can't
+func rankable(terms []string) []string {
+	var list []string
+	for _, t := range terms {
+		if t != "" && !strings.ContainsRune(t, '%') {
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// sql returns an expression computing each row's score for the terms, or an
+// empty string if nothing can be scored
+func (rk Ranking) sql(terms []string) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	for _, term := range rankable(terms) {
+		for _, rule := range rk.rules() {
+			if rule.weight == 0 {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("(CASE WHEN %s THEN %d ELSE 0 END)", rule.sql, rule.weight))
+			args = append(args, rule.arg(term))
+		}
+	}
+	return strings.Join(parts, " + "), args
+}
+
+// Explain describes why f ranked where it did for the given terms, e.g.,
+// `exact name match "minutes.pdf"`.  Nothing is returned if f scored zero.
+func (rk Ranking) Explain(f *File, terms []string) []string {
+	var reasons []string
+	for _, term := range rankable(terms) {
+		for _, rule := range rk.rules() {
+			if rule.weight != 0 && rule.match(f, term) {
+				reasons = append(reasons, fmt.Sprintf("%s %q (+%d)", rule.reason, term, rule.weight))
+			}
+		}
+	}
+	return reasons
+}
@@ -0,0 +1,69 @@
+package db
+
+import (
+	"testing"
+)
+
+// TestRankingMatchesExplain makes sure the SQL used to order search results
+// scores each file the same as Explain does.  Terms are literal, so "_" only
+// matches an underscore, and only ASCII letters ignore case, as in SQLite.
+func TestRankingMatchesExplain(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("photos")
+	var folder, _ = op.FindOrCreateFolder(c, nil, "box")
+	var names = []string{"photo_1.tif", "PHOTO_1.TIF", "photoX1.tif", "photo_10.tif", "Éclair.tif", "éclair.tif", "a-photo_1.tif"}
+	for _, name := range names {
+		op.Files.Save(&File{CategoryID: c.ID, FolderID: folder.ID, ArchiveDate: "2020-01-01", Name: name,
+			PublicPath: "box/" + name, PublicID: FilePublicID(c.Name, "2020-01-01", "box/"+name)})
+	}
+	var err = op.Operation.Err()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var rk = Ranking{ExactName: 100, NamePrefix: 10, PathWord: 1}
+	var tests = []struct {
+		term  string
+		score map[string]int
+	}{
+		{term: "photo_1", score: map[string]int{"photo_1.tif": 10, "PHOTO_1.TIF": 10, "photo_10.tif": 10, "photoX1.tif": 0, "a-photo_1.tif": 0}},
+		{term: "Photo_1.tif", score: map[string]int{"photo_1.tif": 110, "PHOTO_1.TIF": 110, "photoX1.tif": 0}},
+		{term: "BOX", score: map[string]int{"photo_1.tif": 1, "photoX1.tif": 1}},
+		{term: "1", score: map[string]int{"photo_1.tif": 1, "photoX1.tif": 0, "photo_10.tif": 0}},
+		{term: "éclair", score: map[string]int{"éclair.tif": 11, "Éclair.tif": 0}},
+	}
+
+	for _, tc := range tests {
+		var expr, args = rk.sql([]string{tc.term})
+		var rows = op.Operation.Query("SELECT name, public_path, "+expr+" FROM files", args...)
+		var scores = make(map[string]int)
+		for rows.Next() {
+			var f File
+			var score int
+			rows.Scan(&f.Name, &f.PublicPath, &score)
+			scores[f.Name] = score
+
+			var explained int
+			for _, rule := range rk.rules() {
+				if rule.match(&f, tc.term) {
+					explained += rule.weight
+				}
+			}
+			if explained != score {
+				t.Errorf("Term %q, file %q: SQL scored %d, Explain's rules score %d", tc.term, f.Name, score, explained)
+			}
+		}
+		rows.Close()
+		err = op.Operation.Err()
+		if err != nil {
+			t.Fatalf("Unable to rank files: %s", err)
+		}
+
+		for name, want := range tc.score {
+			if scores[name] != want {
+				t.Errorf("Term %q, file %q: expected a score of %d, got %d", tc.term, name, want, scores[name])
+			}
+		}
+	}
+}
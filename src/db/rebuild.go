@@ -0,0 +1,321 @@
+package db
+
+import "strings"
+
+// CatalogCounts summarizes a catalog so a rebuilt one can be compared to the
+// catalog it replaces
+type CatalogCounts struct {
+	Categories  uint64
+	Inventories uint64
+	Folders     uint64
+	Files       uint64
+	Bytes       int64
+}
+
+// CatalogCounts counts the catalog's categories, inventories, folders, and
+// files, and adds up the files' sizes
+func (op *Operation) CatalogCounts() (*CatalogCounts, error) {
+	var c = &CatalogCounts{
+		Categories:  op.Categories.Select().Count().RowCount(),
+		Inventories: op.Inventories.Select().Count().RowCount(),
+		Folders:     op.Folders.Select().Count().RowCount(),
+		Files:       op.Files.Select().Count().RowCount(),
+	}
+	var rows = op.Operation.Query("SELECT COALESCE(SUM(filesize), 0) FROM files")
+	if rows.Next() {
+		rows.Scan(&c.Bytes)
+	}
+	rows.Close()
+	return c, op.Operation.Err()
+}
+
+// CarryOverStats reports what CarryOver copied into a rebuilt catalog, and
+// what it left behind because the file, folder, category, or inventory it
+// belonged to isn't in the new catalog.  Both are keyed by a description of
+// the kind of data, e.g., "notes".
+type CarryOverStats struct {
+	Copied  map[string]int
+	Skipped map[string]int
+}
+
+// carrier holds what CarryOver needs while copying data from one catalog to
+// another
+type carrier struct {
+	from  *Operation
+	to    *Operation
+	stats *CarryOverStats
+
+	// Categories are few enough to keep in memory: old ids to names, and
+	// names to new ids
+	oldCategories map[int]string
+	newCategories map[string]int
+
+	// publicIDs caches whether a public id exists in the new catalog
+	publicIDs map[string]bool
+}
+
+// CarryOver copies everything from the live catalog which indexing can't
+// recreate into a freshly indexed one: preservation events, inventories'
+// indexing dates, restrictions, conflict resolutions, notes, tags, archive
+// jobs, and aliases for public ids changed by recomputing paths.  Metadata
+// sidecars are read again by the indexer, so their fields aren't copied.
+//
+// Files and folders are matched by public id, categories by name, folders by
+// category and path, and inventories by path.  Anything whose match is gone,
+// e.g. because the archive path format changed, is counted as skipped.
+// Events are the exception: they're history, so they're all kept.
+//
+// Restrictions, notes, and archive jobs keep their ids, since people see
+// those in URLs and command output.  The new catalog doesn't have any of
+// these yet, so the ids can't collide.
+func CarryOver(from, to *Database) (*CarryOverStats, error) {
+	var stats = &CarryOverStats{Copied: make(map[string]int), Skipped: make(map[string]int)}
+	var err = to.InTransaction(func(op *Operation) error {
+		var c = &carrier{from: from.Operation(), to: op, stats: stats, publicIDs: make(map[string]bool)}
+		c.loadCategories()
+		c.events()
+		c.inventoryDates()
+		c.restrictions()
+		c.conflicts()
+		c.notes()
+		c.tags()
+		c.jobs()
+		c.aliases()
+
+		if c.from.Operation.Err() != nil {
+			return c.from.Operation.Err()
+		}
+		return op.Operation.Err()
+	})
+	return stats, err
+}
+
+func (c *carrier) loadCategories() {
+	c.oldCategories = make(map[int]string)
+	c.newCategories = make(map[string]int)
+	var list, _ = c.from.AllCategories()
+	for _, cat := range list {
+		c.oldCategories[cat.ID] = cat.Name
+	}
+	list, _ = c.to.AllCategories()
+	for _, cat := range list {
+		c.newCategories[cat.Name] = cat.ID
+	}
+}
+
+// newCategoryID returns the new catalog's id for the category with the given
+// id in the old catalog, or zero if it's gone
+func (c *carrier) newCategoryID(oldID int) int {
+	var name, ok = c.oldCategories[oldID]
+	if !ok {
+		return 0
+	}
+	return c.newCategories[name]
+}
+
+// hasPublicID returns true if the new catalog has a file or folder with the
+// given public id
+func (c *carrier) hasPublicID(pid string) bool {
+	var found, ok = c.publicIDs[pid]
+	if ok {
+		return found
+	}
+
+	switch {
+	case strings.HasPrefix(pid, "f"):
+		found = c.to.Files.Select().Where("public_id = ?", pid).Count().RowCount() > 0
+	case strings.HasPrefix(pid, "d"):
+		found = c.to.Folders.Select().Where("public_id = ?", pid).Count().RowCount() > 0
+	}
+	c.publicIDs[pid] = found
+	return found
+}
+
+// events copies every event.  The ingestion events the rebuild itself wrote
+// are removed for inventories the old catalog already has events for, so
+// each inventory's ingestion is recorded once, when it really happened.
+func (c *carrier) events() {
+	var maxID int
+	var rows = c.to.Operation.Query("SELECT COALESCE(MAX(id), 0) FROM events")
+	if rows.Next() {
+		rows.Scan(&maxID)
+	}
+	rows.Close()
+
+	var seen = make(map[string]bool)
+	var ev = &Event{}
+	c.from.Events.Select().Order("id").EachObject(ev, func() {
+		seen[ev.InventoryPath] = true
+		ev.ID = 0
+		c.to.Events.Save(ev)
+		c.stats.Copied["events"]++
+	})
+
+	var paths []interface{}
+	for p := range seen {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	eachChunk(paths, func(chunk []interface{}) {
+		var args = append([]interface{}{EventIngestion, maxID}, chunk...)
+		c.to.Operation.Exec("DELETE FROM events WHERE event_type = ? AND id <= ? AND inventory_path IN "+
+			placeholders(len(chunk)), args...)
+	})
+}
+
+// inventoryDates keeps the date each inventory was first indexed
+func (c *carrier) inventoryDates() {
+	var inv = &Inventory{}
+	c.from.Inventories.Select().Order("id").EachObject(inv, func() {
+		// Inventories indexed before we recorded dates have nothing to keep
+		if inv.IndexedAt.IsZero() {
+			return
+		}
+		var sql = "UPDATE inventories SET indexed_at = ? WHERE path = ?"
+		var n = c.to.Operation.Exec(sql, inv.IndexedAt, inv.Path).RowsAffected()
+		if n > 0 {
+			c.stats.Copied["inventory dates"]++
+		} else {
+			c.stats.Skipped["inventory dates"]++
+		}
+	})
+}
+
+func (c *carrier) restrictions() {
+	var list, _ = c.from.AllRestrictions()
+	for _, rs := range list {
+		var ok bool
+		switch {
+		case rs.CategoryID != 0:
+			rs.CategoryID = c.newCategoryID(rs.CategoryID)
+			ok = rs.CategoryID != 0
+		case rs.FolderID != 0:
+			var f = &Folder{}
+			if c.from.Folders.Select().Where("id = ?", rs.FolderID).First(f) {
+				var catID = c.newCategoryID(f.CategoryID)
+				ok = c.to.Folders.Select().Where("category_id = ? AND public_path = ?", catID, f.PublicPath).First(f)
+				rs.FolderID = f.ID
+			}
+		case rs.InventoryID != 0:
+			var i = &Inventory{}
+			if c.from.Inventories.Select().Where("id = ?", rs.InventoryID).First(i) {
+				ok = c.to.Inventories.Select().Where("path = ?", i.Path).First(i)
+				rs.InventoryID = i.ID
+			}
+		}
+
+		if !ok {
+			c.stats.Skipped["restrictions"]++
+			continue
+		}
+		c.to.Restrictions.Insert(rs)
+		c.stats.Copied["restrictions"]++
+	}
+}
+
+// conflicts copies resolutions onto the conflicts the rebuild found again.
+// Resolved conflicts which didn't come up again are kept for the record;
+// unresolved ones which didn't come up again no longer exist.
+func (c *carrier) conflicts() {
+	var list []*Conflict
+	c.from.Conflicts.Select().Where("resolved_by <> ''").Order("id").AllObjects(&list)
+	for _, old := range list {
+		var catID = c.newCategoryID(old.CategoryID)
+		if catID == 0 {
+			c.stats.Skipped["conflict resolutions"]++
+			continue
+		}
+
+		var where = "category_id = ? AND archive_date = ? AND public_path = ? AND existing_inventory = ? AND " +
+			"new_inventory = ? AND new_checksum = ?"
+		var found = &Conflict{}
+		if c.to.Conflicts.Select().Where(where, catID, old.ArchiveDate, old.PublicPath, old.ExistingInventory,
+			old.NewInventory, old.NewChecksum).First(found) {
+			if found.ResolvedBy == "" {
+				found.ResolvedAt, found.ResolvedBy = old.ResolvedAt, old.ResolvedBy
+				c.to.Conflicts.Save(found)
+			}
+		} else {
+			old.ID, old.CategoryID = 0, catID
+			c.to.Conflicts.Save(old)
+		}
+		c.stats.Copied["conflict resolutions"]++
+	}
+}
+
+func (c *carrier) notes() {
+	var n = &Note{}
+	c.from.Notes.Select().Order("id").EachObject(n, func() {
+		if !c.hasPublicID(n.PublicID) {
+			c.stats.Skipped["notes"]++
+			return
+		}
+		c.to.Notes.Insert(n)
+		c.stats.Copied["notes"]++
+	})
+}
+
+func (c *carrier) tags() {
+	var t = &Tag{}
+	c.from.Tags.Select().Order("id").EachObject(t, func() {
+		if !c.hasPublicID(t.PublicID) {
+			c.stats.Skipped["tags"]++
+			return
+		}
+		t.ID = 0
+		c.to.Tags.Save(t)
+		c.stats.Copied["tags"]++
+	})
+}
+
+// jobs copies archive jobs, their attempts, and whichever of their files are
+// still in the catalog
+func (c *carrier) jobs() {
+	var list []*ArchiveJob
+	c.from.ArchiveJobs.Select().Order("id").AllObjects(&list)
+	for _, j := range list {
+		var files, _ = c.from.GetJobFiles(j)
+		var attempts, _ = c.from.GetJobAttempts(j)
+
+		c.to.ArchiveJobs.Insert(j)
+		c.stats.Copied["archive jobs"]++
+
+		for _, f := range files {
+			var nf, _ = c.to.FindFileByPublicID(f.PublicID)
+			if nf == nil {
+				c.stats.Skipped["archive job files"]++
+				continue
+			}
+			c.to.JobFiles.Save(&JobFile{JobID: j.ID, FileID: nf.ID})
+			c.stats.Copied["archive job files"]++
+		}
+		for _, a := range attempts {
+			a.ID, a.JobID = 0, j.ID
+			c.to.JobAttempts.Save(a)
+		}
+	}
+}
+
+// aliases copies public id aliases which still lead somewhere.  An alias is
+// skipped if the file or folder it leads to is gone, or if its old id belongs
+// to a file or folder again.
+func (c *carrier) aliases() {
+	var aliases [][2]string
+	var rows = c.from.Operation.Query("SELECT old_public_id, public_id FROM public_id_aliases ORDER BY old_public_id")
+	for rows.Next() {
+		var a [2]string
+		rows.Scan(&a[0], &a[1])
+		aliases = append(aliases, a)
+	}
+	rows.Close()
+
+	for _, a := range aliases {
+		if !c.hasPublicID(a[1]) || c.hasPublicID(a[0]) {
+			c.stats.Skipped["public id aliases"]++
+			continue
+		}
+		c.to.Operation.Exec("INSERT INTO public_id_aliases (old_public_id, public_id) VALUES (?, ?)", a[0], a[1])
+		c.stats.Copied["public id aliases"]++
+	}
+}
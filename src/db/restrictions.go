@@ -0,0 +1,293 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Restrictions holds everything hidden from one particular person at one
+// particular time.  A nil *Restrictions hides nothing.
+type Restrictions struct {
+	categories  map[int]bool
+	inventories map[int]bool
+	folders     []*Folder
+
+	// Folders and categories whose stored totals include hidden files, and
+	// therefore have to be computed on the fly
+	affectedFolders    map[int]bool
+	affectedCategories map[int]bool
+}
+
+// AllRestrictions returns every restriction, including those whose embargo
+// has ended, oldest first
+func (op *Operation) AllRestrictions() ([]*Restriction, error) {
+	var list []*Restriction
+	op.Restrictions.Select().Order("id").AllObjects(&list)
+	return list, op.Operation.Err()
+}
+
+// WriteRestriction stores a restriction
+func (op *Operation) WriteRestriction(r *Restriction) error {
+	op.Restrictions.Save(r)
+	return op.Operation.Err()
+}
+
+// DeleteRestriction removes the restriction with the given id, returning
+// false if there was no such restriction
+func (op *Operation) DeleteRestriction(id int) (bool, error) {
+	var n = op.Operation.Exec("DELETE FROM restrictions WHERE id = ?", id).RowsAffected()
+	return n > 0, op.Operation.Err()
+}
+
+// RestrictionTarget describes what the restriction is attached to, e.g.,
+// "folder srs/FILES/foo"
+func (op *Operation) RestrictionTarget(rs *Restriction) (string, error) {
+	switch {
+	case rs.CategoryID != 0:
+		var c = &Category{}
+		if op.Categories.Select().Where("id = ?", rs.CategoryID).First(c) {
+			return "category " + c.Name, nil
+		}
+	case rs.FolderID != 0:
+		var f = &Folder{}
+		var c = &Category{}
+		if op.Folders.Select().Where("id = ?", rs.FolderID).First(f) &&
+			op.Categories.Select().Where("id = ?", f.CategoryID).First(c) {
+			return "folder " + c.Name + "/" + f.PublicPath, nil
+		}
+	case rs.InventoryID != 0:
+		var i = &Inventory{}
+		if op.Inventories.Select().Where("id = ?", rs.InventoryID).First(i) {
+			return "inventory " + i.Path, nil
+		}
+	}
+	return "(missing)", op.Operation.Err()
+}
+
+// RestrictionsFor returns what's hidden from user at time t.  If nothing is,
+// nil is returned.
+func (op *Operation) RestrictionsFor(user string, t time.Time) (*Restrictions, error) {
+	var all, err = op.AllRestrictions()
+	if err != nil {
+		return nil, err
+	}
+
+	var r = &Restrictions{
+		categories:         make(map[int]bool),
+		inventories:        make(map[int]bool),
+		affectedFolders:    make(map[int]bool),
+		affectedCategories: make(map[int]bool),
+	}
+	var folderIDs, invIDs []string
+	for _, rs := range all {
+		if !rs.Active(t) || rs.Allows(user) {
+			continue
+		}
+		switch {
+		case rs.CategoryID != 0:
+			r.categories[rs.CategoryID] = true
+		case rs.FolderID != 0:
+			folderIDs = append(folderIDs, strconv.Itoa(rs.FolderID))
+		case rs.InventoryID != 0:
+			r.inventories[rs.InventoryID] = true
+			invIDs = append(invIDs, strconv.Itoa(rs.InventoryID))
+		}
+	}
+	if len(r.categories) == 0 && len(folderIDs) == 0 && len(invIDs) == 0 {
+		return nil, nil
+	}
+
+	if len(folderIDs) > 0 {
+		op.Folders.Select().Where("id IN (" + strings.Join(folderIDs, ",") + ")").AllObjects(&r.folders)
+	}
+
+	// Hidden folders' parents and all folders holding a hidden inventory's
+	// files, plus all of those folders' ancestors, have totals which include
+	// hidden files
+	if len(folderIDs) > 0 || len(invIDs) > 0 {
+		var rows = op.Operation.Query(`
+			WITH RECURSIVE affected(id) AS (
+				SELECT folder_id FROM folders WHERE id IN (` + strings.Join(append(folderIDs, "0"), ",") + `)
+				UNION
+				SELECT folder_id FROM files WHERE inventory_id IN (` + strings.Join(append(invIDs, "0"), ",") + `)
+				UNION
+				SELECT d.folder_id FROM folders d JOIN affected a ON d.id = a.id
+			)
+			SELECT id FROM affected WHERE id > 0`)
+		for rows.Next() {
+			var id int
+			rows.Scan(&id)
+			r.affectedFolders[id] = true
+		}
+		rows.Close()
+
+		rows = op.Operation.Query(`SELECT DISTINCT category_id FROM files WHERE inventory_id IN (` +
+			strings.Join(append(invIDs, "0"), ",") + `)`)
+		for rows.Next() {
+			var id int
+			rows.Scan(&id)
+			r.affectedCategories[id] = true
+		}
+		rows.Close()
+	}
+	for _, f := range r.folders {
+		r.affectedCategories[f.CategoryID] = true
+	}
+
+	return r, op.Operation.Err()
+}
+
+// Empty returns true if r doesn't hide anything
+func (r *Restrictions) Empty() bool {
+	return r == nil || len(r.categories) == 0 && len(r.inventories) == 0 && len(r.folders) == 0
+}
+
+// HidesCategory returns true if the category is hidden
+func (r *Restrictions) HidesCategory(c *Category) bool {
+	return r != nil && r.categories[c.ID]
+}
+
+// HidesInventory returns true if the inventory is hidden
+func (r *Restrictions) HidesInventory(i *Inventory) bool {
+	return r != nil && r.inventories[i.ID]
+}
+
+// HidesFolder returns true if the folder is hidden, either directly or because
+// its category or a folder above it is hidden
+func (r *Restrictions) HidesFolder(f *Folder) bool {
+	if r == nil {
+		return false
+	}
+	if r.categories[f.CategoryID] {
+		return true
+	}
+	for _, hidden := range r.folders {
+		if hidden.CategoryID == f.CategoryID &&
+			(f.PublicPath == hidden.PublicPath || strings.HasPrefix(f.PublicPath, hidden.PublicPath+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// HidesFile returns true if the file's category, inventory, or any folder
+// above it is hidden
+func (r *Restrictions) HidesFile(f *File) bool {
+	if r == nil {
+		return false
+	}
+	if r.categories[f.CategoryID] || r.inventories[f.InventoryID] {
+		return true
+	}
+	for _, hidden := range r.folders {
+		if hidden.CategoryID == f.CategoryID && strings.HasPrefix(f.PublicPath, hidden.PublicPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterFiles returns the files which aren't hidden
+func (r *Restrictions) FilterFiles(files []*File) []*File {
+	if r.Empty() {
+		return files
+	}
+	var visible []*File
+	for _, f := range files {
+		if !r.HidesFile(f) {
+			visible = append(visible, f)
+		}
+	}
+	return visible
+}
+
+// Key identifies what r hides, so results which depend on it can be cached
+// and shared by everybody it applies to.  Restrictions hiding nothing have an
+// empty key.
+func (r *Restrictions) Key() string {
+	if r.Empty() {
+		return ""
+	}
+	var parts []string
+	for id := range r.categories {
+		parts = append(parts, "c"+strconv.Itoa(id))
+	}
+	for id := range r.inventories {
+		parts = append(parts, "i"+strconv.Itoa(id))
+	}
+	for _, f := range r.folders {
+		parts = append(parts, "f"+strconv.Itoa(f.ID))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// affectsFolder returns true if f's stored totals include hidden files
+func (r *Restrictions) affectsFolder(f *Folder) bool {
+	return r != nil && r.affectedFolders[f.ID]
+}
+
+// affectsCategory returns true if c's stored totals include hidden files
+func (r *Restrictions) affectsCategory(c *Category) bool {
+	return r != nil && r.affectedCategories[c.ID]
+}
+
+// pathUnderSQL matches a public path inside a hidden folder the same way
+// HidesFile and HidesFolder do: case matters, and nothing in the folder's
+// path is a wildcard, which wouldn't be true with LIKE.  SUBSTR counts
+// characters, so the argument for the prefix length must too; see pathUnder.
+const pathUnderSQL = "SUBSTR(%[1]spublic_path, 1, ?) = ?"
+
+// pathUnder returns the arguments for pathUnderSQL to match paths inside f
+func pathUnder(f *Folder) []interface{} {
+	var prefix = f.PublicPath + "/"
+	return []interface{}{utf8.RuneCountInString(prefix), prefix}
+}
+
+// fileSQL returns a WHERE clause which excludes hidden files.  prefix is
+// prepended to each column name, for queries using a table alias.
+func (r *Restrictions) fileSQL(prefix string) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if len(r.categories) > 0 {
+		where = append(where, prefix+"category_id NOT IN "+idList(r.categories))
+	}
+	if len(r.inventories) > 0 {
+		where = append(where, prefix+"inventory_id NOT IN "+idList(r.inventories))
+	}
+	for _, f := range r.folders {
+		where = append(where, "NOT ("+prefix+"category_id = ? AND "+fmt.Sprintf(pathUnderSQL, prefix)+")")
+		args = append(append(args, f.CategoryID), pathUnder(f)...)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// folderSQL returns a WHERE clause which excludes hidden folders
+func (r *Restrictions) folderSQL() (string, []interface{}) {
+	var where []string
+	var args []interface{}
+	if len(r.categories) > 0 {
+		where = append(where, "category_id NOT IN "+idList(r.categories))
+	}
+	for _, f := range r.folders {
+		where = append(where, "NOT (category_id = ? AND (public_path = ? OR "+fmt.Sprintf(pathUnderSQL, "")+"))")
+		args = append(append(args, f.CategoryID, f.PublicPath), pathUnder(f)...)
+	}
+	if len(where) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// idList returns a parenthesized, comma-separated list of the map's keys
+func idList(ids map[int]bool) string {
+	var list []string
+	for id := range ids {
+		list = append(list, strconv.Itoa(id))
+	}
+	return "(" + strings.Join(list, ",") + ")"
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// TestRestrictionsMatchQueries makes sure the SQL used to hide files from
+// lists agrees with HidesFile and HidesFolder, which are used when a single
+// file or folder is requested.  Paths which differ only by case, or which a
+// LIKE pattern would match because of a "_", must not be hidden.
+func TestRestrictionsMatchQueries(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("photos")
+
+	var folders = make(map[string]*Folder)
+	for _, path := range []string{"Photo_1", "Photo_1/sub", "photo_1", "Photo-1", "Photo_10"} {
+		var parent = folders[filepath.Dir(path)]
+		var f, err = op.FindOrCreateFolder(c, parent, path)
+		if err != nil {
+			t.Fatalf("Unable to create folder %q: %s", path, err)
+		}
+		folders[path] = f
+		var name = "image.tif"
+		var file = &File{CategoryID: c.ID, FolderID: f.ID, ArchiveDate: "2020-01-01", Name: name,
+			PublicPath: path + "/" + name, PublicID: FilePublicID(c.Name, "2020-01-01", path+"/"+name)}
+		op.Files.Save(file)
+	}
+	op.WriteRestriction(&Restriction{CreatedAt: time.Now(), FolderID: folders["Photo_1"].ID})
+	var err = op.RecomputeAggregates()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var r *Restrictions
+	r, err = op.RestrictionsFor("somebody", time.Now())
+	if err != nil {
+		t.Fatalf("Unable to read restrictions: %s", err)
+	}
+
+	var all, visible []*File
+	op.FileSelect(c, nil).TreeMode(true).AllObjects(&all)
+	op.FileSelect(c, nil).TreeMode(true).Restrict(r).AllObjects(&visible)
+	var got, want []string
+	for _, f := range visible {
+		got = append(got, f.PublicPath)
+	}
+	for _, f := range all {
+		if !r.HidesFile(f) {
+			want = append(want, f.PublicPath)
+		}
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	var expected = []string{"Photo-1/image.tif", "Photo_10/image.tif", "photo_1/image.tif"}
+	if !equalStrings(got, expected) || !equalStrings(want, expected) {
+		t.Errorf("Visible files: query returned %q, HidesFile allows %q; expected %q", got, want, expected)
+	}
+
+	var allFolders, visibleFolders []*Folder
+	op.FolderSelect(c, nil).TreeMode(true).AllObjects(&allFolders)
+	op.FolderSelect(c, nil).TreeMode(true).Restrict(r).AllObjects(&visibleFolders)
+	got, want = nil, nil
+	for _, f := range visibleFolders {
+		got = append(got, f.PublicPath)
+	}
+	for _, f := range allFolders {
+		if !r.HidesFolder(f) {
+			want = append(want, f.PublicPath)
+		}
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	expected = []string{"Photo-1", "Photo_10", "photo_1"}
+	if !equalStrings(got, expected) || !equalStrings(want, expected) {
+		t.Errorf("Visible folders: query returned %q, HidesFolder allows %q; expected %q", got, want, expected)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -6,16 +6,83 @@ import (
 	"github.com/Nerdmaster/magicsql"
 )
 
+// FileFilter describes which files somebody can see: those archived on or
+// before a given date, those not hidden by restrictions, those matching the
+// search filters they chose, or any combination.  The zero value shows
+// everything.
+type FileFilter struct {
+	AsOf         string
+	Restrictions *Restrictions
+	Filters      Filters
+}
+
+// changesTotals returns true if the filter could hide files which are counted
+// in stored totals, other than files hidden by restrictions (see
+// Restrictions.affectsFolder)
+func (ff FileFilter) changesTotals() bool {
+	return ff.AsOf != "" || !ff.Filters.Empty()
+}
+
+// sql returns a WHERE clause matching files which pass the filter.  prefix is
+// prepended to each column name, for queries using a table alias.
+func (ff FileFilter) sql(prefix string) (string, []interface{}) {
+	var where = []string{"1 = 1"}
+	var args []interface{}
+	if ff.AsOf != "" {
+		where = append(where, prefix+"archive_date <= ?")
+		args = append(args, ff.AsOf)
+	}
+	if !ff.Restrictions.Empty() {
+		var rWhere, rArgs = ff.Restrictions.fileSQL(prefix)
+		where = append(where, rWhere)
+		args = append(args, rArgs...)
+	}
+	if !ff.Filters.Empty() {
+		var fWhere, fArgs = ff.Filters.sql(prefix)
+		where = append(where, fWhere)
+		args = append(args, fArgs...)
+	}
+	return strings.Join(where, " AND "), args
+}
+
+// underFolderSQL matches files, aliased "ff", inside the folder a folders
+// query is looking at, at any depth.  As with pathUnderSQL, case matters and
+// nothing in the folder's path is a wildcard.
+const underFolderSQL = `ff.category_id = folders.category_id AND
+	SUBSTR(ff.public_path, 1, LENGTH(folders.public_path) + 1) = folders.public_path || '/'`
+
+// folderSQL returns a WHERE clause matching folders which hold at least one
+// file, at any depth, which passes the filter
+func (ff FileFilter) folderSQL() (string, []interface{}) {
+	var where, args = ff.sql("ff.")
+	return `EXISTS (SELECT 1 FROM files ff WHERE ` + underFolderSQL + ` AND ` + where + `)`, args
+}
+
+// latestVersionSQL returns a WHERE clause restricting a files query to rows
+// which are the most recent version of their public path that passes ff
+func latestVersionSQL(ff FileFilter) (string, []interface{}) {
+	var where, args = ff.sql("v.")
+	return `archive_date = (SELECT MAX(v.archive_date) FROM files v
+		WHERE v.category_id = files.category_id AND v.public_path = files.public_path AND ` + where + `)`, args
+}
+
 // FSelect wraps common "SELECT" behaviors for both files and folders
 type FSelect struct {
 	op          *Operation
 	sel         magicsql.Select
 	category    *Category
 	folder      *Folder
+	inventory   *Inventory
 	whereFields []string
 	whereArgs   []interface{}
 	limit       uint64
+	offset      uint64
 	tree        bool
+	latest      bool
+	filter      FileFilter
+	ranking     Ranking
+	rankTerms   []string
+	built       bool
 }
 
 // FileSelect creates a new FSelect for querying/searching files
@@ -23,9 +90,12 @@ func (op *Operation) FileSelect(c *Category, f *Folder) *FSelect {
 	return &FSelect{op: op, sel: op.Files.Select(), category: c, folder: f}
 }
 
-// FolderSelect creates a new FSelect for querying/searching folders
+// FolderSelect creates a new FSelect for querying/searching folders.  Folders
+// with no files (e.g., all their files' inventories were retracted) are
+// skipped.
 func (op *Operation) FolderSelect(c *Category, f *Folder) *FSelect {
-	return &FSelect{op: op, sel: op.Folders.Select(), category: c, folder: f}
+	var s = &FSelect{op: op, sel: op.Folders.Select(), category: c, folder: f}
+	return s.Search("file_count > ?", 0)
 }
 
 // TreeMode defaults to false, but if set to true will recurse through all
@@ -43,12 +113,96 @@ func (s *FSelect) Search(field string, term interface{}) *FSelect {
 	return s
 }
 
+// SearchAny requires field to be LIKE at least one of the patterns
+func (s *FSelect) SearchAny(field string, patterns []string) *FSelect {
+	var likes []string
+	for _, p := range patterns {
+		likes = append(likes, field+" LIKE ?")
+		s.whereArgs = append(s.whereArgs, p)
+	}
+	s.whereFields = append(s.whereFields, "("+strings.Join(likes, " OR ")+")")
+	return s
+}
+
+// Annotated restricts the query to files or folders with a note containing
+// term or a tag equal to it
+func (s *FSelect) Annotated(term string) *FSelect {
+	s.whereFields = append(s.whereFields, annotationSQL)
+	s.whereArgs = append(s.whereArgs, "%"+term+"%", term)
+	return s
+}
+
+// Described restricts the query to files or folders with a descriptive
+// metadata value containing term
+func (s *FSelect) Described(term string) *FSelect {
+	return s.Search(metadataSQL, "%"+term+"%")
+}
+
+// Inventory restricts a file query to files described by the given inventory
+func (s *FSelect) Inventory(i *Inventory) *FSelect {
+	s.inventory = i
+	return s
+}
+
+// LatestOnly restricts a file query to each file's most recent version, so a
+// public path archived on several dates only shows up once
+func (s *FSelect) LatestOnly(l bool) *FSelect {
+	s.latest = l
+	return s
+}
+
+// AsOf restricts a query to what the catalog held on the given archive date
+// (YYYY-MM-DD): files archived on or before that date, and folders which had
+// at least one such file.  Folders' totals are recomputed to count only those
+// files.  An empty date means no restriction.
+func (s *FSelect) AsOf(date string) *FSelect {
+	s.filter.AsOf = date
+	return s
+}
+
+// Restrict hides files and folders covered by r.  Folders' totals are
+// recomputed where needed so hidden files aren't counted, and folders with no
+// visible files are skipped.
+func (s *FSelect) Restrict(r *Restrictions) *FSelect {
+	s.filter.Restrictions = r
+	return s
+}
+
+// Filters restricts a query to files which pass f, and folders holding at
+// least one such file.  As with AsOf, folders' totals are recomputed to count
+// only those files.
+func (s *FSelect) Filters(f Filters) *FSelect {
+	s.filter.Filters = f
+	return s
+}
+
+// Filter applies every part of ff; see AsOf, Restrict, and Filters
+func (s *FSelect) Filter(ff FileFilter) *FSelect {
+	s.filter = ff
+	return s
+}
+
+// Rank orders results by relevance to the search terms, as weighed by rk,
+// instead of just by depth and path.  Terms with wildcards aren't ranked.
+func (s *FSelect) Rank(rk Ranking, terms []string) *FSelect {
+	s.ranking = rk
+	s.rankTerms = terms
+	return s
+}
+
 // Limit sets the maximum rows to return
 func (s *FSelect) Limit(l uint64) *FSelect {
 	s.limit = l
 	return s
 }
 
+// Offset skips the given number of rows, for reading results a page at a
+// time.  It only applies if Limit is also set.
+func (s *FSelect) Offset(o uint64) *FSelect {
+	s.offset = o
+	return s
+}
+
 func (s *FSelect) setCategory(data interface{}) {
 	var files []*File
 	var folders []*Folder
@@ -78,10 +232,92 @@ func (s *FSelect) setCategory(data interface{}) {
 // objects found via a COUNT query if Limit was set in order to know if more
 // objects were available.
 func (s *FSelect) AllObjects(data interface{}) (total uint64, err error) {
+	var folders, isFolders = data.(*[]*Folder)
+	var sel = s.build(isFolders)
+
+	var count = sel.Count().RowCount()
+	sel = s.order(sel)
+	if s.limit > 0 {
+		sel = sel.Limit(s.limit).Offset(s.offset)
+	}
+	sel.AllObjects(data)
+	if isFolders {
+		s.op.FolderTotals(*folders, s.filter)
+	}
+
+	s.setCategory(data)
+	return count, s.op.Operation.Err()
+}
+
+// EachFile runs the query for files, calling cb with each one as it's read
+// so huge results needn't be held in memory.  The file passed to cb is reused
+// for every row, and its Category isn't populated.
+func (s *FSelect) EachFile(cb func(*File)) error {
+	var sel = s.order(s.build(false))
+	if s.limit > 0 {
+		sel = sel.Limit(s.limit).Offset(s.offset)
+	}
+	var f = &File{}
+	sel.EachObject(f, func() { cb(f) })
+	return s.op.Operation.Err()
+}
+
+// build returns the underlying Select with every condition applied; see
+// order for sorting it.  The conditions are only added the first time, so a
+// select can be run more than once, e.g., for its results and its facets.
+func (s *FSelect) build(isFolders bool) magicsql.Select {
+	if s.built {
+		return s.sel.Where(strings.Join(s.whereFields, " AND "), s.whereArgs...)
+	}
+	s.built = true
+
 	if s.category != nil {
 		s.whereFields = append(s.whereFields, "category_id = ?")
 		s.whereArgs = append(s.whereArgs, s.category.ID)
 	}
+	if s.inventory != nil {
+		s.whereFields = append(s.whereFields, "inventory_id = ?")
+		s.whereArgs = append(s.whereArgs, s.inventory.ID)
+	}
+	if s.filter.AsOf != "" {
+		if isFolders {
+			s.whereFields = append(s.whereFields, "min_archive_date <= ?")
+		} else {
+			s.whereFields = append(s.whereFields, "archive_date <= ?")
+		}
+		s.whereArgs = append(s.whereArgs, s.filter.AsOf)
+	}
+	if !s.filter.Restrictions.Empty() {
+		var where string
+		var args []interface{}
+		if isFolders {
+			where, args = s.filter.Restrictions.folderSQL()
+		} else {
+			where, args = s.filter.Restrictions.fileSQL("")
+		}
+		s.whereFields = append(s.whereFields, where)
+		s.whereArgs = append(s.whereArgs, args...)
+	}
+	if !s.filter.Filters.Empty() && !isFolders {
+		var where, args = s.filter.Filters.sql("")
+		s.whereFields = append(s.whereFields, where)
+		s.whereArgs = append(s.whereArgs, args...)
+	}
+
+	// The checks above are exact for files, but a folder can pass them while
+	// every file within it is filtered out or hidden, so folders must also
+	// hold at least one visible file.  This keeps the count in line with the
+	// folders returned.
+	if isFolders && (!s.filter.Filters.Empty() || !s.filter.Restrictions.Empty()) {
+		var where, args = s.filter.folderSQL()
+		s.whereFields = append(s.whereFields, where)
+		s.whereArgs = append(s.whereArgs, args...)
+	}
+	if s.latest {
+		var where, args = latestVersionSQL(s.filter)
+		s.whereFields = append(s.whereFields, where)
+		s.whereArgs = append(s.whereArgs, args...)
+	}
 	if s.tree == false {
 		var folderID int
 		if s.folder != nil {
@@ -96,12 +332,21 @@ func (s *FSelect) AllObjects(data interface{}) (total uint64, err error) {
 		}
 	}
 
-	var sel = s.sel.Where(strings.Join(s.whereFields, " AND "), s.whereArgs...)
-	sel = sel.Order("depth, LOWER(public_path)")
+	return s.sel.Where(strings.Join(s.whereFields, " AND "), s.whereArgs...)
+}
 
-	var count = sel.Count().RowCount()
-	sel.AllObjects(data)
+// order sorts a built Select by relevance, if Rank was called, then by depth
+// and path.  This has to come after counting: the relevance expression has
+// arguments, which magicsql passes along with the WHERE clause's, and a count
+// has no ORDER BY to use them.
+func (s *FSelect) order(sel magicsql.Select) magicsql.Select {
+	const byPath = "depth, LOWER(public_path), id"
+	var expr, args = s.ranking.sql(s.rankTerms)
+	if expr == "" {
+		return sel.Order(byPath)
+	}
 
-	s.setCategory(data)
-	return count, s.op.Operation.Err()
+	var allArgs = append(append([]interface{}{}, s.whereArgs...), args...)
+	sel = sel.Where(strings.Join(s.whereFields, " AND "), allArgs...)
+	return sel.Order("(" + expr + ") DESC, " + byPath)
 }
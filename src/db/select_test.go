@@ -0,0 +1,74 @@
+package db
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestFolderCountMatchesResults makes sure a folder query's total counts the
+// same folders it returns, even when every file in a folder is hidden or
+// filtered out without the folder itself being hidden
+func TestFolderCountMatchesResults(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("photos")
+
+	var folders = make(map[string]*Folder)
+	for _, p := range []string{"outer/hidden/one.tif", "outer/hidden/two.pdf", "open/three.tif", "open/sub/four.pdf"} {
+		var dir = filepath.Dir(p)
+		for _, d := range []string{filepath.Dir(dir), dir} {
+			if d == "." || folders[d] != nil {
+				continue
+			}
+			var f, err = op.FindOrCreateFolder(c, folders[filepath.Dir(d)], d)
+			if err != nil {
+				t.Fatalf("Unable to create folder %q: %s", d, err)
+			}
+			folders[d] = f
+		}
+		op.Files.Save(&File{CategoryID: c.ID, FolderID: folders[dir].ID, ArchiveDate: "2020-01-01",
+			Name: filepath.Base(p), PublicPath: p, PublicID: FilePublicID(c.Name, "2020-01-01", p)})
+	}
+	op.WriteRestriction(&Restriction{CreatedAt: time.Now(), FolderID: folders["outer/hidden"].ID})
+	var err = op.RecomputeAggregates()
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var r *Restrictions
+	r, err = op.RestrictionsFor("somebody", time.Now())
+	if err != nil {
+		t.Fatalf("Unable to read restrictions: %s", err)
+	}
+
+	var tests = []struct {
+		name string
+		ff   FileFilter
+		want []string
+	}{
+		{name: "no filter", want: []string{"open", "outer", "open/sub", "outer/hidden"}},
+		{name: "restricted", ff: FileFilter{Restrictions: r}, want: []string{"open", "open/sub"}},
+		{name: "filtered", ff: FileFilter{Filters: Filters{Extension: "pdf"}}, want: []string{"open", "outer", "open/sub", "outer/hidden"}},
+		{name: "both", ff: FileFilter{Restrictions: r, Filters: Filters{Extension: "tif"}}, want: []string{"open"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var list []*Folder
+			var total, err = op.FolderSelect(c, nil).TreeMode(true).Filter(tc.ff).Limit(10).AllObjects(&list)
+			if err != nil {
+				t.Fatalf("Unable to read folders: %s", err)
+			}
+			var got []string
+			for _, f := range list {
+				if f.FileCount == 0 {
+					t.Errorf("Folder %q has no visible files", f.PublicPath)
+				}
+				got = append(got, f.PublicPath)
+			}
+			if !equalStrings(got, tc.want) || total != uint64(len(got)) {
+				t.Errorf("Got %q (total %d), expected %q", got, total, tc.want)
+			}
+		})
+	}
+}
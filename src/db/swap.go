@@ -0,0 +1,201 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Nerdmaster/magicsql"
+)
+
+// closeDelay is how long Refresh leaves the old connection pool open, so
+// operations already underway when the database is swapped can finish
+const closeDelay = time.Minute
+
+// swapLockPath exists while a rebuilt catalog's data is being brought up to
+// date and swapped in.  Writes to the shared database are refused while it
+// exists, since anything written then would be left behind in the old file.
+const swapLockPath = dbPath + ".swapping"
+
+// File returns the database file this handle is currently using
+func (db *Database) File() string {
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	return db.file
+}
+
+// Refresh reopens the database if its path now points to a different file,
+// which is how a rebuilt catalog is swapped in (see Swap).  It returns true
+// if the database was reopened, in which case anything cached from the old
+// database (ids in particular) should be thrown away.
+func (db *Database) Refresh() (bool, error) {
+	var file = resolve(db.path)
+	if file == db.File() {
+		return false, nil
+	}
+
+	var _db, err = open(file, db.readOnly)
+	if err != nil {
+		return false, err
+	}
+
+	db.lock.Lock()
+	var old = db.dbh.DataSource()
+	db.dbh = magicsql.Wrap(_db)
+	db.file = file
+	db.lock.Unlock()
+
+	time.AfterFunc(closeDelay, func() { old.Close() })
+	return true, nil
+}
+
+// LockForSwap keeps every process from writing to the shared database,
+// through live, until the returned function is called.  This is for the last
+// steps of a rebuild: copying what indexing can't recreate and swapping the
+// rebuilt catalog in.  If a rebuild died without unlocking, the lock file has
+// to be removed by hand.
+func LockForSwap(live *Database) (unlock func(), err error) {
+	var f *os.File
+	f, err = os.OpenFile(swapLockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			err = fmt.Errorf("%s exists; another rebuild is being swapped in, or one failed "+
+				"partway through and the file must be removed", swapLockPath)
+		}
+		return nil, err
+	}
+	f.Close()
+	unlock = func() { os.Remove(swapLockPath) }
+
+	// Writers look for the lock file once they hold SQLite's write lock, so
+	// once we've held it ourselves, every write which started before the lock
+	// file existed has finished
+	var op = live.Operation()
+	op.Operation.BeginTransaction()
+	op.Operation.Rollback()
+	err = op.Operation.Err()
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("unable to wait for writes to finish: %s", err)
+	}
+	return unlock, nil
+}
+
+// checkSwap returns an error if the shared database can't be written to
+// because a rebuilt catalog is being swapped in (which is temporary, so busy
+// is true), or because one was swapped in and this handle hasn't switched to
+// it yet.  Databases other than the shared one, such as a catalog being
+// rebuilt, are never swapped.
+func (db *Database) checkSwap() (busy bool, err error) {
+	if db.readOnly || db.path != dbPath {
+		return false, nil
+	}
+	var _, statErr = os.Stat(swapLockPath)
+	if statErr == nil {
+		return true, fmt.Errorf("a rebuilt catalog is being swapped in")
+	}
+	if resolve(db.path) != db.File() {
+		return false, fmt.Errorf("a rebuilt catalog was swapped in; %q is no longer current", db.File())
+	}
+	return false, nil
+}
+
+// CheckSwappable returns an error if the shared database isn't a symlink.  A
+// rebuilt catalog can only be swapped in by pointing the symlink at it; a
+// plain file can't be replaced safely while other processes have it open.
+func CheckSwappable() error {
+	var info, err = os.Lstat(dbPath)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s is not a symlink; stop all Headlamp processes, then run "+
+			"\"mv %s %s && ln -s %s %s\"", dbPath, dbPath, RebuildPath(info.ModTime()),
+			filepath.Base(RebuildPath(info.ModTime())), dbPath)
+	}
+	return nil
+}
+
+// RebuildPath returns the path for a new database file, next to the shared
+// database, named for the time t
+func RebuildPath(t time.Time) string {
+	var dir, name = filepath.Split(dbPath)
+	var ext = filepath.Ext(name)
+	return filepath.Join(dir, strings.TrimSuffix(name, ext)+"-"+t.Format("20060102150405")+ext)
+}
+
+// Swap points the shared database symlink at the database file at path,
+// which must live in the same directory.  The new link is renamed over the
+// old one, so anything opening the database gets either the old file or the
+// new one, never a missing file.  Processes which already have the database
+// open pick up the change when they call Refresh.
+func Swap(path string) error {
+	var err = CheckSwappable()
+	if err != nil {
+		return err
+	}
+	if filepath.Dir(path) != filepath.Dir(dbPath) {
+		return fmt.Errorf("%q must be in the same directory as %q", path, dbPath)
+	}
+
+	var tmp = dbPath + ".swap"
+	os.Remove(tmp)
+	err = os.Symlink(filepath.Base(path), tmp)
+	if err == nil {
+		err = os.Rename(tmp, dbPath)
+	}
+	return err
+}
+
+// CopySchema creates every table and index from src in db, which should be
+// empty.  Goose's version table is copied as well, so migrations can still be
+// applied to the new database as usual.
+func (db *Database) CopySchema(src *Database) error {
+	var sop = src.Operation().Operation
+	var rows = sop.Query("SELECT name, sql FROM sqlite_master " +
+		"WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY rowid")
+	var statements []string
+	var versions bool
+	for rows.Next() {
+		var name, sql string
+		rows.Scan(&name, &sql)
+		statements = append(statements, sql)
+		versions = versions || name == "goose_db_version"
+	}
+	rows.Close()
+	if sop.Err() != nil {
+		return sop.Err()
+	}
+
+	return db.InTransaction(func(op *Operation) error {
+		for _, sql := range statements {
+			op.Operation.Exec(sql)
+		}
+		if versions {
+			copyRows(sop, op.Operation, "goose_db_version")
+		}
+		return op.Operation.Err()
+	})
+}
+
+// copyRows copies every row in the given table from one database to another
+func copyRows(from, to *magicsql.Operation, table string) {
+	var rows = from.Query("SELECT * FROM " + table)
+	var cols = rows.Columns()
+	var insert = fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(cols, ", "), placeholders(len(cols)))
+	for rows.Next() {
+		var vals = make([]interface{}, len(cols))
+		var ptrs = make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		rows.Scan(ptrs...)
+		to.Exec(insert, vals...)
+	}
+	rows.Close()
+	if from.Err() != nil {
+		to.SetErr(from.Err())
+	}
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+// TestSwapBlocksWrites makes sure nothing written while a rebuilt catalog is
+// being swapped in ends up in the old file, where it would be lost
+func TestSwapBlocksWrites(t *testing.T) {
+	// dbPath is relative, so the test works from a scratch directory
+	var wd, err = os.Getwd()
+	if err != nil {
+		t.Fatalf("Unable to read the working directory: %s", err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatalf("Unable to change directories: %s", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	os.Mkdir("db", 0755)
+	migrate(t, "db/da-old.db")
+	var rebuilt = migrate(t, "db/da-new.db")
+	err = os.Symlink("da-old.db", dbPath)
+	if err != nil {
+		t.Fatalf("Unable to link the shared database: %s", err)
+	}
+
+	var live, writer = New(), New()
+	var unlock func()
+	unlock, err = LockForSwap(live)
+	if err != nil {
+		t.Fatalf("Unable to lock for swap: %s", err)
+	}
+	_, err = LockForSwap(live)
+	if err == nil {
+		t.Errorf("Expected a second lock to fail")
+	}
+
+	var done = make(chan error)
+	go func() {
+		done <- writer.InTransaction(func(op *Operation) error {
+			var _, err = op.FindOrCreateCategory("late")
+			return err
+		})
+	}()
+
+	// The writer should be waiting on the lock, not writing to the old file
+	time.Sleep(200 * time.Millisecond)
+	select {
+	case err = <-done:
+		t.Fatalf("Write finished while the catalog was locked (err: %v)", err)
+	default:
+	}
+
+	err = Swap("db/da-new.db")
+	unlock()
+	if err != nil {
+		t.Fatalf("Unable to swap: %s", err)
+	}
+	err = <-done
+	if err == nil {
+		t.Errorf("Expected a write during the swap to fail until the writer refreshed")
+	}
+
+	var swapped bool
+	swapped, err = writer.Refresh()
+	if !swapped || err != nil {
+		t.Fatalf("Expected the writer to switch to the new catalog (err: %v)", err)
+	}
+	err = writer.InTransaction(func(op *Operation) error {
+		var _, err = op.FindOrCreateCategory("late")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Unable to write after refreshing: %s", err)
+	}
+
+	var c *Category
+	c, _ = NewAt("db/da-old.db").Operation().FindCategoryByName("late")
+	if c != nil {
+		t.Errorf("The write went to the old catalog")
+	}
+	c, _ = rebuilt.Operation().FindCategoryByName("late")
+	if c == nil {
+		t.Errorf("The write didn't go to the new catalog")
+	}
+}
@@ -13,13 +13,25 @@ import (
 type Category struct {
 	ID   int `sql:",primary"`
 	Name string
+
+	// Totals for all files in the category; see Aggregates
+	FileCount      int
+	TotalBytes     int64
+	MinArchiveDate string
+	MaxArchiveDate string
 }
 
 // Inventory maps to the inventories database table, which represents a
-// manifest file in an INVENTORY folder
+// manifest file in an INVENTORY folder, along with some basic provenance data
+// gathered when the inventory was indexed
 type Inventory struct {
-	ID   int    `sql:",primary"`
-	Path string // Path is relative to the dark archive root
+	ID          int    `sql:",primary"`
+	Path        string // Path is relative to the dark archive root
+	IndexedAt   time.Time
+	RecordCount int   // Number of file records, including those which failed
+	FailedCount int   // Number of records which couldn't be indexed
+	TotalBytes  int64 // Sum of all records' file sizes
+	Checksum    string
 }
 
 // Folder maps to the folders table, and is effectively a giant list of our
@@ -34,6 +46,13 @@ type Folder struct {
 	Depth      int
 	Name       string
 	PublicPath string
+	PublicID   string // Stable identifier for URLs; see FolderPublicID
+
+	// Totals for all files in this folder and its subfolders; see Aggregates
+	FileCount      int
+	TotalBytes     int64
+	MinArchiveDate string
+	MaxArchiveDate string
 }
 
 // A RealFolder lets us see what path(s) point to a given public folder
@@ -61,6 +80,7 @@ type File struct {
 	Name        string
 	FullPath    string
 	PublicPath  string
+	PublicID    string // Stable identifier for URLs; see FilePublicID
 }
 
 // ContainingFolder returns the path to the file's folder for cases where
@@ -69,16 +89,27 @@ func (f *File) ContainingFolder() string {
 	return filepath.Dir(f.PublicPath)
 }
 
-// The ArchiveJob structure maps to archive_jobs, storing RS-separated files and
-// comma-separated notification email(s).  The record represents a single
-// archive creation request.
+// Archive job statuses
+const (
+	JobPending  = "pending"
+	JobComplete = "complete"
+	JobFailed   = "failed"
+)
+
+// The ArchiveJob structure maps to archive_jobs, storing comma-separated
+// notification email(s), who requested the job, and where it stands.  The
+// record represents a single archive creation request.  The job's files are
+// stored separately in job_files.
 type ArchiveJob struct {
 	ID                 int `sql:",primary"`
 	CreatedAt          time.Time
 	NextAttemptAt      time.Time
+	CompletedAt        time.Time
+	RequestedBy        string
 	NotificationEmails string
-	Files              string
-	Processed          bool
+	Status             string
+	Attempts           int
+	LastError          string
 }
 
 // Emails parses the email addresses as mail.Addr instances and returns them as
@@ -98,7 +129,153 @@ func (j *ArchiveJob) Emails() []string {
 	return sList
 }
 
-// FileList splits the files field and returns them as a list
-func (j *ArchiveJob) FileList() []string {
-	return strings.Split(j.Files, "\x1E")
+// JobFile maps to job_files, tying an archive job to a single file in the
+// catalog
+type JobFile struct {
+	ID     int `sql:",primary"`
+	JobID  int
+	FileID uint64
+}
+
+// JobAttempt maps to job_attempts, recording a single attempt to build an
+// archive job and the error, if any, which stopped it
+type JobAttempt struct {
+	ID         int `sql:",primary"`
+	JobID      int
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Error      string
+}
+
+// Conflict outcomes describe what the indexer did about a conflict
+const (
+	ConflictIdentical    = "identical"
+	ConflictKeptExisting = "kept existing"
+	ConflictReplaced     = "replaced"
+	ConflictRejected     = "rejected inventory"
+)
+
+// ConflictAutoResolver is the ResolvedBy value for conflicts which needed no
+// review because both inventories agreed on the file's contents
+const ConflictAutoResolver = "(automatic)"
+
+// A Conflict maps to the conflicts table, recording an inventory which
+// described a file another inventory had already described
+type Conflict struct {
+	ID                int `sql:",primary"`
+	CreatedAt         time.Time
+	CategoryID        int
+	ArchiveDate       string
+	PublicPath        string
+	ExistingInventory string
+	ExistingChecksum  string
+	ExistingFilesize  int64
+	NewInventory      string
+	NewChecksum       string
+	NewFilesize       int64
+	Outcome           string
+	ResolvedAt        time.Time
+	ResolvedBy        string
+	Category          *Category `sql:"-"`
+}
+
+// Event types, using the PREMIS event type vocabulary
+const (
+	EventIngestion            = "ingestion"
+	EventFixityCheck          = "fixity check"
+	EventFormatIdentification = "format identification"
+	EventDeaccession          = "deaccession"
+	EventDissemination        = "dissemination"
+)
+
+// Event outcomes
+const (
+	EventSuccess = "success"
+	EventFailure = "failure"
+)
+
+// Agent types say whether an event's agent is a person or software
+const (
+	AgentPerson   = "person"
+	AgentSoftware = "software"
+)
+
+// An Event maps to the events table, recording one thing which happened to a
+// file or inventory
+type Event struct {
+	ID            int `sql:",primary"`
+	EventType     string
+	OccurredAt    time.Time
+	FilePublicID  string
+	InventoryPath string
+	Agent         string
+	AgentType     string
+	Outcome       string
+	Detail        string
+}
+
+// A Restriction maps to the restrictions table, hiding a category, folder, or
+// inventory from everybody not in its audience until its embargo ends
+type Restriction struct {
+	ID           int `sql:",primary"`
+	CreatedAt    time.Time
+	CreatedBy    string
+	CategoryID   int
+	FolderID     int
+	InventoryID  int
+	EmbargoUntil string // YYYY-MM-DD; empty means the restriction never lifts
+	Audience     string // Space-separated logins allowed to see restricted material
+	Note         string
+}
+
+// Active returns true if the restriction's embargo hasn't ended as of t
+func (r *Restriction) Active(t time.Time) bool {
+	return r.EmbargoUntil == "" || t.Format("2006-01-02") < r.EmbargoUntil
+}
+
+// Allows returns true if user is part of the restriction's audience
+func (r *Restriction) Allows(user string) bool {
+	for _, login := range strings.Fields(r.Audience) {
+		if login == user {
+			return true
+		}
+	}
+	return false
+}
+
+// A Note maps to the notes table: free text a staff member attached to a
+// file or folder
+type Note struct {
+	ID        int `sql:",primary"`
+	PublicID  string
+	CreatedAt time.Time
+	Author    string
+	UpdatedAt time.Time
+	UpdatedBy string
+	Body      string
+}
+
+// Edited returns true if the note was changed after it was written
+func (n *Note) Edited() bool {
+	return !n.UpdatedAt.Equal(n.CreatedAt)
+}
+
+// A Tag maps to the tags table: one of the configured tags attached to a file
+// or folder
+type Tag struct {
+	ID        int `sql:",primary"`
+	PublicID  string
+	Tag       string
+	CreatedAt time.Time
+	Author    string
+}
+
+// A Metadata maps to the metadata table: one value of a descriptive field,
+// such as a title or creator, read from a sidecar file for a file or folder
+type Metadata struct {
+	ID            int `sql:",primary"`
+	PublicID      string
+	InventoryPath string
+	Field         string
+	Value         string
 }
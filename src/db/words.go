@@ -0,0 +1,269 @@
+package db
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minWordLength is the shortest word indexed for fuzzy searching.  Shorter
+// words have too few trigrams to find misspellings of.
+const minWordLength = 3
+
+// minSimilarity is the fraction of trigrams two words must share to be
+// similar, regardless of how many edits apart they are
+const minSimilarity = 0.5
+
+// maxCandidates caps how many words sharing trigrams with a search word are
+// compared to it, most shared trigrams first
+const maxCandidates = 500
+
+// maxVisibilityChecks caps how many similar words are checked against a
+// viewer's restrictions, since each check may scan every file's path
+const maxVisibilityChecks = 50
+
+// SimilarWord is an indexed word spelled like a search word
+type SimilarWord struct {
+	Word       string
+	Similarity float64 // Shared trigrams over all trigrams in either word, from 0 to 1
+	Distance   int     // Letters added, removed, changed, or swapped to get from one word to the other
+}
+
+// SplitWords returns the distinct lowercased words in s, splitting on
+// anything which isn't a letter or digit, so "Annual-Report_1999.pdf" and
+// "annual report 1999 pdf" have the same words
+func SplitWords(s string) []string {
+	var seen = make(map[string]bool)
+	var words []string
+	var fields = strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, w := range fields {
+		if !seen[w] {
+			seen[w] = true
+			words = append(words, w)
+		}
+	}
+	return words
+}
+
+// trigrams returns a word's distinct three-letter sequences.  The word is
+// padded with two spaces in front and one behind, so its start counts more
+// than its middle, and short words still have a few trigrams.
+func trigrams(word string) []string {
+	var runes = []rune("  " + word + " ")
+	var seen = make(map[string]bool)
+	var list []string
+	for i := 0; i+3 <= len(runes); i++ {
+		var t = string(runes[i : i+3])
+		if !seen[t] {
+			seen[t] = true
+			list = append(list, t)
+		}
+	}
+	return list
+}
+
+// editDistance returns the number of single-letter insertions, deletions,
+// substitutions, or swaps of neighboring letters needed to turn a into b
+func editDistance(a, b string) int {
+	var ra, rb = []rune(a), []rune(b)
+	var d = make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			var cost = 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(n int, rest ...int) int {
+	for _, m := range rest {
+		if m < n {
+			n = m
+		}
+	}
+	return n
+}
+
+// maxEdits is how far apart two words may be, by editDistance, to be similar:
+// one typo in a short word, two in a longer one
+func maxEdits(word string) int {
+	if len([]rune(word)) < 6 {
+		return 1
+	}
+	return 2
+}
+
+// IndexWords adds any of the given words which aren't yet indexed, along with
+// their trigrams, and returns how many were added.  Words shorter than
+// minWordLength are ignored.
+func (op *Operation) IndexWords(words []string) (int, error) {
+	var added int
+	for _, w := range words {
+		if len([]rune(w)) < minWordLength {
+			continue
+		}
+		var res = op.Operation.Exec("INSERT OR IGNORE INTO words (word) VALUES (?)", w)
+		if res.RowsAffected() == 0 {
+			continue
+		}
+		var id = res.LastInsertId()
+		for _, t := range trigrams(w) {
+			op.Operation.Exec("INSERT INTO word_trigrams (trigram, word_id) VALUES (?, ?)", t, id)
+		}
+		added++
+	}
+	return added, op.Operation.Err()
+}
+
+// HasWordIndex returns true if any words have been indexed
+func (op *Operation) HasWordIndex() (bool, error) {
+	var rows = op.Operation.Query("SELECT 1 FROM words LIMIT 1")
+	var found = rows.Next()
+	rows.Close()
+	return found, op.Operation.Err()
+}
+
+// IndexAllWords indexes the words in every file's public path, returning how
+// many new words were added.  This fills in the index for files indexed
+// before it existed, and for paths changed outside the indexer.
+func (op *Operation) IndexAllWords() (int, error) {
+	var seen = make(map[string]bool)
+	var words []string
+	var rows = op.Operation.Query("SELECT public_path FROM files")
+	for rows.Next() {
+		var p string
+		rows.Scan(&p)
+		for _, w := range SplitWords(p) {
+			if !seen[w] {
+				seen[w] = true
+				words = append(words, w)
+			}
+		}
+	}
+	rows.Close()
+	if op.Operation.Err() != nil {
+		return 0, op.Operation.Err()
+	}
+
+	return op.IndexWords(words)
+}
+
+// SimilarWords returns up to limit indexed words spelled like word, most
+// similar first.  word itself is first if it's indexed.  Words are similar if
+// they share at least half their trigrams or are a typo or two apart (see
+// maxEdits).  Only words sharing some trigrams with word are considered, so
+// very short words may have no similar words even when one is a typo away.
+// Words too short to be indexed have no similar words.
+func (op *Operation) SimilarWords(word string, limit int) ([]SimilarWord, error) {
+	var list, err = op.similarWords(word)
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list, err
+}
+
+// SimilarVisibleWords is SimilarWords, but skips words which only appear in
+// the paths of files r hides.  Restricted words would otherwise crowd out
+// words the viewer can find, and suggesting them would hint at what's hidden.
+func (op *Operation) SimilarVisibleWords(word string, limit int, r *Restrictions) ([]SimilarWord, error) {
+	if r.Empty() {
+		return op.SimilarWords(word, limit)
+	}
+
+	var all, err = op.similarWords(word)
+	if err != nil {
+		return nil, err
+	}
+	if len(all) > maxVisibilityChecks {
+		all = all[:maxVisibilityChecks]
+	}
+	var where, args = r.fileSQL("")
+	var list []SimilarWord
+	for _, sw := range all {
+		if len(list) == limit {
+			break
+		}
+
+		// Words have no LIKE wildcards, and this matches the way a fuzzy
+		// search looks for them
+		var rows = op.Operation.Query("SELECT 1 FROM files WHERE public_path LIKE ? AND "+where+" LIMIT 1",
+			append([]interface{}{"%" + sw.Word + "%"}, args...)...)
+		if rows.Next() {
+			list = append(list, sw)
+		}
+		rows.Close()
+	}
+	return list, op.Operation.Err()
+}
+
+// similarWords returns every indexed word spelled like word, most similar
+// first
+func (op *Operation) similarWords(word string) ([]SimilarWord, error) {
+	word = strings.ToLower(word)
+	if len([]rune(word)) < minWordLength {
+		return nil, nil
+	}
+	var tris = trigrams(word)
+	var args []interface{}
+	for _, t := range tris {
+		args = append(args, t)
+	}
+	var minShared = len(tris) / 3
+	if minShared < 1 {
+		minShared = 1
+	}
+	args = append(args, minShared, maxCandidates)
+
+	var sql = `SELECT w.word, COUNT(*) FROM word_trigrams t
+		JOIN words w ON w.id = t.word_id
+		WHERE t.trigram IN ` + placeholders(len(tris)) + `
+		GROUP BY w.id HAVING COUNT(*) >= ?
+		ORDER BY COUNT(*) DESC LIMIT ?`
+
+	var list []SimilarWord
+	var rows = op.Operation.Query(sql, args...)
+	for rows.Next() {
+		var candidate string
+		var shared int
+		rows.Scan(&candidate, &shared)
+
+		var sw = SimilarWord{
+			Word:       candidate,
+			Similarity: float64(shared) / float64(len(tris)+len(trigrams(candidate))-shared),
+			Distance:   editDistance(word, candidate),
+		}
+		if sw.Similarity >= minSimilarity || sw.Distance <= maxEdits(word) {
+			list = append(list, sw)
+		}
+	}
+	rows.Close()
+
+	sort.Slice(list, func(i, j int) bool {
+		var a, b = list[i], list[j]
+		if a.Similarity != b.Similarity {
+			return a.Similarity > b.Similarity
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Word < b.Word
+	})
+	return list, op.Operation.Err()
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEditDistance(t *testing.T) {
+	var tests = []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"annual", "annual", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"anual", "annual", 1},
+		{"annual", "anual", 1},
+		{"annual", "annuel", 1},
+		{"annaul", "annual", 1},
+		{"teh", "the", 1},
+		{"report", "reprot", 1},
+		{"kitten", "sitting", 3},
+		{"abcd", "badc", 2},
+		{"café", "cafe", 1},
+		{"naïve", "naive", 1},
+	}
+
+	for _, tc := range tests {
+		var got = editDistance(tc.a, tc.b)
+		if got != tc.want {
+			t.Errorf("editDistance(%q, %q): got %d, expected %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestTrigrams(t *testing.T) {
+	var tests = []struct {
+		word string
+		want []string
+	}{
+		{"", []string{"   "}},
+		{"a", []string{"  a", " a "}},
+		{"ab", []string{"  a", " ab", "ab "}},
+		{"cat", []string{"  c", " ca", "cat", "at "}},
+		{"aaaa", []string{"  a", " aa", "aaa", "aa "}},
+		{"café", []string{"  c", " ca", "caf", "afé", "fé "}},
+	}
+
+	for _, tc := range tests {
+		var got = trigrams(tc.word)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("trigrams(%q): got %q, expected %q", tc.word, got, tc.want)
+		}
+	}
+}
+
+// TestSimilarVisibleWords makes sure words only found in restricted files
+// don't take the place of words the viewer can find
+func TestSimilarVisibleWords(t *testing.T) {
+	var dbh, _ = newTestDB(t)
+	var op = dbh.Operation()
+	var c, _ = op.FindOrCreateCategory("reports")
+	var folders = make(map[string]*Folder)
+	var paths = []string{"hidden/anuals.pdf", "hidden/manual.pdf", "public/anal.pdf", "public/anul.pdf"}
+	for _, p := range paths {
+		var parts = strings.SplitN(p, "/", 2)
+		var dir, name = parts[0], parts[1]
+		if folders[dir] == nil {
+			folders[dir], _ = op.FindOrCreateFolder(c, nil, dir)
+		}
+		op.Files.Save(&File{CategoryID: c.ID, FolderID: folders[dir].ID, ArchiveDate: "2020-01-01", Name: name,
+			PublicPath: p, PublicID: FilePublicID(c.Name, "2020-01-01", p)})
+		op.IndexWords(SplitWords(p))
+	}
+	op.WriteRestriction(&Restriction{CreatedAt: time.Now(), FolderID: folders["hidden"].ID})
+	var r, err = op.RestrictionsFor("somebody", time.Now())
+	if err != nil {
+		t.Fatalf("Unable to set up catalog: %s", err)
+	}
+
+	var words = func(list []SimilarWord) []string {
+		var ws []string
+		for _, sw := range list {
+			ws = append(ws, sw.Word)
+		}
+		return ws
+	}
+
+	var all []SimilarWord
+	all, err = op.SimilarWords("anual", 2)
+	if err != nil {
+		t.Fatalf("Unable to find similar words: %s", err)
+	}
+	var got = words(all)
+	if !reflect.DeepEqual(got, []string{"anuals", "manual"}) {
+		t.Errorf("Unrestricted: expected the two closest words, got %q", got)
+	}
+
+	var visible []SimilarWord
+	visible, err = op.SimilarVisibleWords("anual", 2, r)
+	if err != nil {
+		t.Fatalf("Unable to find similar visible words: %s", err)
+	}
+	got = words(visible)
+	if !reflect.DeepEqual(got, []string{"anal", "anul"}) {
+		t.Errorf("Restricted: expected only words from visible files, got %q", got)
+	}
+}
@@ -45,6 +45,7 @@ func (c *category) buildFile(i *db.Inventory, f *db.Folder, r *fileRecord) *db.F
 		Filesize:    r.filesize,
 		FullPath:    r.fullPath,
 		PublicPath:  r.publicPath,
+		PublicID:    db.FilePublicID(c.Name, r.archiveDate, r.publicPath),
 		Name:        fname,
 	}
 }
@@ -97,31 +98,81 @@ func (i *Indexer) Index() error {
 	i.setState(iStateRunning)
 	defer i.setState(iStateStopped)
 
-	var files, err = i.findInventoryFiles()
+	// If a rebuilt catalog was swapped in, our cached ids are meaningless
+	var swapped, err = i.dbh.Refresh()
+	if err != nil {
+		return err
+	}
+	if swapped {
+		logger.Infof("Database was swapped; now using %q", i.dbh.File())
+		i.resetCache()
+	}
+
+	var files []string
+	files, err = i.findInventoryFiles()
 	if err != nil {
 		return err
 	}
 
 	err = i.dbh.InTransaction(func(op *db.Operation) error {
-		var iop = &indexerOperation{i, op}
+		var iop = &indexerOperation{Indexer: i, op: op}
 		return iop.findAlreadyIndexedInventoryFiles()
 	})
 	if err != nil {
 		return err
 	}
 
+	// Catalogs from before the fuzzy search index existed need it filled in
+	err = i.dbh.InTransaction(func(op *db.Operation) error {
+		var has, err = op.HasWordIndex()
+		if has || err != nil {
+			return err
+		}
+		var n int
+		n, err = op.IndexAllWords()
+		if n > 0 {
+			logger.Infof("Indexed %d words for fuzzy searching", n)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
 	for _, fname := range files {
 		if i.seenInventoryFile(fname) {
 			logger.Debugf("Skipping %q; already indexed this file", fname)
 			continue
 		}
 
+		// If the database is busy, InTransaction may call us more than once, and
+		// anything cached on a prior attempt could refer to rolled-back rows
+		var attempted = false
+		var rejected []*db.Conflict
 		err = i.dbh.InTransaction(func(op *db.Operation) error {
-			var iop = &indexerOperation{i, op}
-			return iop.indexInventoryFile(fname)
+			if attempted {
+				i.resetCache()
+			}
+			attempted = true
+			var iop = &indexerOperation{Indexer: i, op: op}
+			var err = iop.indexInventoryFile(fname)
+			rejected = iop.rejected
+			return err
 		})
 		if err != nil {
 			logger.Errorf("Error processing %q: %s", fname, err)
+			i.resetCache()
+		}
+
+		// Conflicts which caused an inventory to be rejected have to be stored
+		// after the inventory's transaction is rolled back
+		if len(rejected) > 0 {
+			err = i.dbh.InTransaction(func(op *db.Operation) error {
+				return op.WriteRejectedConflicts(rejected)
+			})
+			if err != nil {
+				logger.Errorf("Unable to record conflicts for %q: %s", fname, err)
+			}
 		}
 
 		if i.getState() == iStateStopping {
@@ -132,6 +183,13 @@ func (i *Indexer) Index() error {
 	return nil
 }
 
+// resetCache throws away cached categories and folders.  This has to happen
+// any time a transaction is rolled back, since the cache may hold records
+// which were never committed.
+func (i *Indexer) resetCache() {
+	i.categories = make(map[string]*category)
+}
+
 // Stop tells the indexer to stop running Index() when it can do so without
 // data loss (in between inventory files)
 func (i *Indexer) Stop() {
@@ -174,6 +232,10 @@ func (i *Indexer) findInventoryFiles() ([]string, error) {
 			logger.Debugf("Skipping manifest file (%q)", fname)
 			continue
 		}
+		if i.isSidecar(fname) {
+			logger.Debugf("Skipping metadata sidecar (%q)", fname)
+			continue
+		}
 		var info, err = os.Stat(fname)
 		if err != nil {
 			logger.Errorf("Skipping %q: could not stat: %s", fname, err)
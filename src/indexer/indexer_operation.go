@@ -2,13 +2,17 @@ package indexer
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/config"
 	"github.com/uoregon-libraries/headlamp/src/db"
 )
 
@@ -18,6 +22,14 @@ import (
 type indexerOperation struct {
 	*Indexer
 	op *db.Operation
+
+	// rejected holds conflicts found under the "reject" policy.  These can't be
+	// stored in the operation's transaction, since it will be rolled back.
+	rejected []*db.Conflict
+
+	// words collects the words in indexed files' paths, for the fuzzy search
+	// index, so each is written once per inventory
+	words map[string]bool
 }
 
 // findAlreadyIndexedInventoryFiles caches the list of inventory files already processed
@@ -47,53 +59,93 @@ func (i *indexerOperation) indexInventoryFile(fname string) error {
 		return fmt.Errorf("unable to read inventory file %q: %s", fname, err)
 	}
 
-	var inventory = &db.Inventory{Path: relativePath}
+	var sum = sha256.Sum256(data)
+	var inventory = &db.Inventory{Path: relativePath, Checksum: hex.EncodeToString(sum[:])}
+	i.words = make(map[string]bool)
 	i.op.WriteInventory(inventory)
+	var totals = db.NewAggregates()
 	var records = bytes.Split(data, []byte("\n"))
 	for index, record := range records {
-		i.index(inventory, index, record)
+		var ir, err = i.index(inventory, totals, index, record)
+		if ir == nil && err == nil {
+			continue
+		}
+
+		inventory.RecordCount++
+		if ir != nil {
+			inventory.TotalBytes += ir.filesize
+		}
+		if err != nil {
+			inventory.FailedCount++
+			logger.Errorf("Skipping record: %s", err)
+		}
+	}
+
+	if len(i.rejected) > 0 {
+		return fmt.Errorf("inventory rejected: %d record(s) conflict with files already indexed", len(i.rejected))
 	}
 
+	err = i.indexSidecars(inventory, fname)
+	if err != nil {
+		return fmt.Errorf("unable to store metadata for inventory %q: %s", fname, err)
+	}
+
+	i.op.ApplyAggregates(totals)
+	var words []string
+	for w := range i.words {
+		words = append(words, w)
+	}
+	_, err = i.op.IndexWords(words)
+	if err != nil {
+		return fmt.Errorf("unable to index words for inventory %q: %s", fname, err)
+	}
+	inventory.IndexedAt = time.Now()
+	i.op.WriteInventory(inventory)
+
+	var ev = db.NewInventoryEvent(db.EventIngestion, inventory, db.SoftwareAgent("indexer"), db.AgentSoftware)
+	ev.Detail = fmt.Sprintf("Indexed %d of %d file record(s)", inventory.RecordCount-inventory.FailedCount, inventory.RecordCount)
+	i.op.WriteEvents(ev)
 	return i.op.Operation.Err()
 }
 
 // index takes the inventory record to create all the folders (real and
 // collapsed) in the database, and then parses the file record data to index
-// the file.  If any database errors occur, the operation halts and the first
-// such error is returned.
-func (i *indexerOperation) index(inventory *db.Inventory, index int, record []byte) (err error) {
+// the file.  The parsed record is returned unless the record was a header,
+// blank, or couldn't be parsed.  If any database errors occur, the operation
+// halts and the first such error is returned.  Indexed files are added to
+// totals so folder and category aggregates can be updated.
+func (i *indexerOperation) index(inventory *db.Inventory, totals *db.Aggregates, index int, record []byte) (ir *inventoryRecord, err error) {
 	// Get the inventory record split up and processed
-	var ir *inventoryRecord
 	ir, err = parseInventoryRecord(record, inventory.Path)
 	if err != nil {
-		return fmt.Errorf("unable to parse record #%d (inventory %q): %s", index, inventory.Path, err)
+		return nil, fmt.Errorf("unable to parse record #%d (inventory %q): %s", index, inventory.Path, err)
 	}
 
 	// Skip headers / empty records
 	if ir == nil {
-		return nil
+		return nil, nil
 	}
 
 	var pp *parsedPath
 	pp, err = parsePath(ir.fullPath, i.c.PathFormat)
 	if err != nil {
-		return fmt.Errorf("unable to parse paths in record #%d (inventory %q): %s", index, inventory.Path, err)
+		return ir, fmt.Errorf("unable to parse paths in record #%d (inventory %q): %s", index, inventory.Path, err)
 	}
 
 	var category *category
 	category, err = i.findOrCreateCategory(pp.categoryName)
 	if err != nil {
-		return err
+		return ir, err
 	}
 
 	var lastFolder *db.Folder
 	lastFolder, err = i.indexPaths(category, ir.fullPath)
 	if err != nil {
-		return err
+		return ir, err
 	}
 
 	var fr = &fileRecord{ir, pp}
-	return i.indexFile(inventory, category, lastFolder, fr)
+	return ir, i.indexFile(inventory, totals, category, lastFolder, fr)
 }
 
 // findOrCreateCategory takes the given category name and indexes it if it
@@ -172,11 +224,66 @@ func (i *indexerOperation) indexPaths(c *category, fullPath string) (lastPublicF
 	return lastPublicFolder, err
 }
 
-func (i *indexerOperation) indexFile(inv *db.Inventory, c *category, folder *db.Folder, fr *fileRecord) error {
+func (i *indexerOperation) indexFile(inv *db.Inventory, totals *db.Aggregates, c *category, folder *db.Folder, fr *fileRecord) error {
 	var f = c.buildFile(inv, folder, fr)
+	var existing, err = i.op.FindFile(c.Category, f.ArchiveDate, f.PublicPath)
+	if err != nil {
+		return fmt.Errorf("couldn't look for existing file %q: %s", f.PublicPath, err)
+	}
+	if existing != nil {
+		return i.handleConflict(inv, totals, existing, f)
+	}
+
 	i.op.Files.Save(f)
 	if i.op.Operation.Err() != nil {
 		return fmt.Errorf("couldn't store file %#v: %s", f, i.op.Operation.Err())
 	}
+	totals.Add(f)
+	for _, w := range db.SplitWords(f.PublicPath) {
+		i.words[w] = true
+	}
 	return nil
 }
+
+// handleConflict applies the configured conflict policy when f describes the
+// same file as one which was already indexed, and records what happened
+func (i *indexerOperation) handleConflict(inv *db.Inventory, totals *db.Aggregates, existing, f *db.File) error {
+	var conflict, err = i.op.NewConflict(existing, f, inv)
+	if err != nil {
+		return fmt.Errorf("couldn't read conflicting file %q: %s", f.PublicPath, err)
+	}
+
+	switch {
+	case existing.Checksum == f.Checksum && existing.Filesize == f.Filesize:
+		conflict.Outcome = db.ConflictIdentical
+
+	case i.c.ConflictPolicy == config.ConflictReject:
+		conflict.Outcome = db.ConflictRejected
+		i.rejected = append(i.rejected, conflict)
+		logger.Warnf("Conflict: %q (%s) differs from the version in %q", f.PublicPath, f.ArchiveDate, conflict.ExistingInventory)
+		return nil
+
+	case i.c.ConflictPolicy == config.ConflictLastWins:
+		conflict.Outcome = db.ConflictReplaced
+		totals.Replace(existing, f)
+		existing.InventoryID = f.InventoryID
+		existing.Checksum = f.Checksum
+		existing.Filesize = f.Filesize
+		existing.FullPath = f.FullPath
+		i.op.Files.Save(existing)
+
+		var ev = db.NewFileEvent(db.EventIngestion, existing, db.SoftwareAgent("indexer"), db.AgentSoftware)
+		ev.Detail = fmt.Sprintf("Record from %q replaced by conflicting record from %q",
+			conflict.ExistingInventory, conflict.NewInventory)
+		i.op.WriteEvents(ev)
+
+	default:
+		conflict.Outcome = db.ConflictKeptExisting
+	}
+
+	if conflict.Outcome != db.ConflictIdentical {
+		logger.Warnf("Conflict: %q (%s) differs from the version in %q; %s",
+			f.PublicPath, f.ArchiveDate, conflict.ExistingInventory, conflict.Outcome)
+	}
+	return i.op.WriteConflict(conflict)
+}
@@ -47,8 +47,9 @@ func parseInventoryRecord(record []byte, inventoryPath string) (*inventoryRecord
 	// always safe, so we just split to 3 elements
 	var recParts = bytes.SplitN(record, []byte(","), 3)
 
-	// Skip headers
-	var checksum = string(recParts[0])
+	// Skip headers.  Checksums are stored lowercased so lookups by checksum
+	// don't have to care how the inventory tool wrote them.
+	var checksum = strings.ToLower(string(recParts[0]))
 	if checksum == "sha256sum" {
 		return nil, nil
 	}
@@ -102,3 +103,16 @@ func parsePath(fullPath string, pf []config.PathToken) (*parsedPath, error) {
 
 	return &parsedPath{categoryName: categoryName, archiveDate: dateDir, publicPath: publicPath}, nil
 }
+
+// ParsePath runs a path (relative to the dark archive root) through the given
+// path format, returning the category name, archive date, and public path it
+// describes.  This is the same parsing the indexer does, exposed for tools
+// which need to re-derive catalog data from stored paths.
+func ParsePath(fullPath string, pf []config.PathToken) (categoryName, archiveDate, publicPath string, err error) {
+	var pp *parsedPath
+	pp, err = parsePath(fullPath, pf)
+	if err != nil {
+		return "", "", "", err
+	}
+	return pp.categoryName, pp.archiveDate, pp.publicPath, nil
+}
@@ -0,0 +1,233 @@
+package indexer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/uoregon-libraries/gopkg/fileutil"
+	"github.com/uoregon-libraries/gopkg/logger"
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// sidecarField is a single field value read from a metadata sidecar
+type sidecarField struct {
+	name  string
+	value string
+}
+
+// sidecarRecord holds the fields a metadata sidecar gives for one file or
+// folder.  The path is relative to the inventory file's parent directory,
+// just like the paths in the inventory itself.
+type sidecarRecord struct {
+	path   string
+	fields []sidecarField
+}
+
+// sidecarBase returns the inventory file's path minus its extension, plus
+// the configured sidecar suffix
+func (i *Indexer) sidecarBase(fname string) string {
+	return strings.TrimSuffix(fname, filepath.Ext(fname)) + i.c.MetadataSidecarSuffix
+}
+
+// isSidecar returns true if fname looks like a metadata sidecar rather than
+// an inventory
+func (i *Indexer) isSidecar(fname string) bool {
+	if i.c.MetadataSidecarSuffix == "" {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimSuffix(fname, filepath.Ext(fname)), i.c.MetadataSidecarSuffix)
+}
+
+// indexSidecars reads any metadata sidecars found alongside the given
+// inventory file and stores their fields for the files and folders they
+// describe.  A sidecar which can't be parsed, or a record which doesn't
+// describe anything in the catalog, is logged and skipped; only database
+// errors are returned.
+func (i *indexerOperation) indexSidecars(inventory *db.Inventory, fname string) error {
+	if i.c.MetadataSidecarSuffix == "" {
+		return nil
+	}
+
+	var parsers = []struct {
+		ext   string
+		parse func(io.Reader) ([]*sidecarRecord, error)
+	}{{".csv", parseSidecarCSV}, {".xml", parseSidecarXML}}
+
+	for _, p := range parsers {
+		var sidecar = i.sidecarBase(fname) + p.ext
+		if !fileutil.Exists(sidecar) {
+			continue
+		}
+
+		var data, err = ioutil.ReadFile(sidecar)
+		if err != nil {
+			logger.Errorf("Skipping metadata sidecar %q: %s", sidecar, err)
+			continue
+		}
+		var records []*sidecarRecord
+		records, err = p.parse(bytes.NewReader(data))
+		if err != nil {
+			logger.Errorf("Skipping metadata sidecar %q: %s", sidecar, err)
+			continue
+		}
+
+		logger.Debugf("Indexing %d record(s) from metadata sidecar %q", len(records), sidecar)
+		for _, rec := range records {
+			err = i.indexSidecarRecord(inventory, rec)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return i.op.Operation.Err()
+}
+
+// indexSidecarRecord finds the file or folder a sidecar record describes and
+// stores its fields
+func (i *indexerOperation) indexSidecarRecord(inventory *db.Inventory, rec *sidecarRecord) error {
+	var fullPath = filepath.Clean(filepath.Join(filepath.Dir(inventory.Path), "..", rec.path))
+	var pp, err = parsePath(fullPath, i.c.PathFormat)
+	if err != nil {
+		logger.Warnf("Skipping metadata for %q (inventory %q): %s", rec.path, inventory.Path, err)
+		return nil
+	}
+
+	var c *db.Category
+	c, err = i.op.FindCategoryByName(pp.categoryName)
+	if err != nil {
+		return err
+	}
+
+	var pid string
+	if c != nil {
+		var f *db.File
+		f, err = i.op.FindFile(c, pp.archiveDate, pp.publicPath)
+		if f != nil {
+			pid = f.PublicID
+		}
+		if err == nil && f == nil {
+			var folder *db.Folder
+			folder, err = i.op.FindFolderByPath(c, pp.publicPath)
+			if folder != nil {
+				pid = folder.PublicID
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if pid == "" {
+		logger.Warnf("Skipping metadata for %q (inventory %q): no such file or folder", rec.path, inventory.Path)
+		return nil
+	}
+
+	var list []*db.Metadata
+	for _, field := range rec.fields {
+		list = append(list, &db.Metadata{PublicID: pid, InventoryPath: inventory.Path, Field: field.name, Value: field.value})
+	}
+	return i.op.WriteMetadata(list)
+}
+
+// parseSidecarCSV reads a CSV sidecar.  The first row is a header naming
+// each column; the "path" column says which file or folder the row
+// describes, and every other column is a metadata field.
+func parseSidecarCSV(r io.Reader) ([]*sidecarRecord, error) {
+	var cr = csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	var rows, err = cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	var header = rows[0]
+	var pathCol = -1
+	for n, name := range header {
+		header[n] = normalizeFieldName(name)
+		if header[n] == "path" {
+			pathCol = n
+		}
+	}
+	if pathCol < 0 {
+		return nil, fmt.Errorf(`no "path" column`)
+	}
+
+	var records []*sidecarRecord
+	for _, row := range rows[1:] {
+		if pathCol >= len(row) || strings.TrimSpace(row[pathCol]) == "" {
+			continue
+		}
+		var rec = &sidecarRecord{path: strings.TrimSpace(row[pathCol])}
+		for n, value := range row {
+			value = strings.TrimSpace(value)
+			if n != pathCol && n < len(header) && header[n] != "" && value != "" {
+				rec.fields = append(rec.fields, sidecarField{header[n], value})
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// xmlSidecar is the structure of an XML sidecar: a list of records, each with
+// a path attribute and any number of Dublin Core elements, e.g.:
+//
+//	<metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+//	  <record path="2017-12-08/FILES/foo.tiff">
+//	    <dc:title>Foo</dc:title>
+//	    <dc:creator>Jane Doe</dc:creator>
+//	  </record>
+//	</metadata>
+type xmlSidecar struct {
+	Records []struct {
+		Path   string `xml:"path,attr"`
+		Fields []struct {
+			XMLName xml.Name
+			Value   string `xml:",chardata"`
+		} `xml:",any"`
+	} `xml:"record"`
+}
+
+// parseSidecarXML reads a Dublin Core XML sidecar.  Element names are used
+// as field names without their namespace, so <dc:title> is "title".
+func parseSidecarXML(r io.Reader) ([]*sidecarRecord, error) {
+	var doc xmlSidecar
+	var err = xml.NewDecoder(r).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*sidecarRecord
+	for _, xr := range doc.Records {
+		if strings.TrimSpace(xr.Path) == "" {
+			continue
+		}
+		var rec = &sidecarRecord{path: strings.TrimSpace(xr.Path)}
+		for _, f := range xr.Fields {
+			var value = strings.TrimSpace(f.Value)
+			if value != "" {
+				rec.fields = append(rec.fields, sidecarField{normalizeFieldName(f.XMLName.Local), value})
+			}
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// normalizeFieldName lowercases a field name and strips any "dc." or "dc:"
+// prefix so CSV headers like "DC.Title" match XML elements like <dc:title>.
+// A byte-order mark (which spreadsheet exports like to add) is removed, too.
+func normalizeFieldName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+	name = strings.TrimPrefix(name, "dc.")
+	return strings.TrimPrefix(name, "dc:")
+}
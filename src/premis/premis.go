@@ -0,0 +1,197 @@
+// Package premis builds PREMIS 3 XML documents describing files in the
+// catalog and the events recorded for them
+package premis
+
+import (
+	"encoding/xml"
+	"io"
+	"mime"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// Identifier types used in our documents
+const (
+	idTypeLocal     = "local"
+	idTypeInventory = "inventory path"
+)
+
+// Document is the top-level PREMIS element
+type Document struct {
+	XMLName  xml.Name `xml:"premis"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	XmlnsXSI string   `xml:"xmlns:xsi,attr"`
+	Version  string   `xml:"version,attr"`
+	Objects  []*Object
+	Events   []*Event
+	Agents   []*Agent
+}
+
+// ObjectIdentifier identifies a file object
+type ObjectIdentifier struct {
+	Type  string `xml:"objectIdentifierType"`
+	Value string `xml:"objectIdentifierValue"`
+}
+
+// Object describes a single file
+type Object struct {
+	XMLName         xml.Name              `xml:"object"`
+	XSIType         string                `xml:"xsi:type,attr"`
+	Identifiers     []ObjectIdentifier    `xml:"objectIdentifier"`
+	Characteristics ObjectCharacteristics `xml:"objectCharacteristics"`
+	OriginalName    string                `xml:"originalName"`
+	ContentLocation ContentLocation       `xml:"storage>contentLocation"`
+}
+
+// ObjectCharacteristics holds a file's fixity, size, and format
+type ObjectCharacteristics struct {
+	CompositionLevel int    `xml:"compositionLevel"`
+	DigestAlgorithm  string `xml:"fixity>messageDigestAlgorithm"`
+	Digest           string `xml:"fixity>messageDigest"`
+	Size             int64  `xml:"size"`
+	FormatName       string `xml:"format>formatDesignation>formatName"`
+	FormatNote       string `xml:"format>formatNote,omitempty"`
+}
+
+// ContentLocation says where a file lives in the dark archive
+type ContentLocation struct {
+	Type  string `xml:"contentLocationType"`
+	Value string `xml:"contentLocationValue"`
+}
+
+// Event describes one event in an object's history
+type Event struct {
+	XMLName        xml.Name `xml:"event"`
+	IDType         string   `xml:"eventIdentifier>eventIdentifierType"`
+	IDValue        string   `xml:"eventIdentifier>eventIdentifierValue"`
+	Type           string   `xml:"eventType"`
+	DateTime       string   `xml:"eventDateTime"`
+	Detail         string   `xml:"eventDetailInformation>eventDetail,omitempty"`
+	Outcome        string   `xml:"eventOutcomeInformation>eventOutcome"`
+	AgentIDType    string   `xml:"linkingAgentIdentifier>linkingAgentIdentifierType"`
+	AgentIDValue   string   `xml:"linkingAgentIdentifier>linkingAgentIdentifierValue"`
+	LinkingObjects []LinkingObject
+}
+
+// LinkingObject ties an event to an object it affected
+type LinkingObject struct {
+	XMLName xml.Name `xml:"linkingObjectIdentifier"`
+	Type    string   `xml:"linkingObjectIdentifierType"`
+	Value   string   `xml:"linkingObjectIdentifierValue"`
+}
+
+// Agent describes a person or piece of software responsible for events
+type Agent struct {
+	XMLName xml.Name `xml:"agent"`
+	IDType  string   `xml:"agentIdentifier>agentIdentifierType"`
+	IDValue string   `xml:"agentIdentifier>agentIdentifierValue"`
+	Name    string   `xml:"agentName"`
+	Type    string   `xml:"agentType"`
+}
+
+// New returns a PREMIS document describing files and events.  Events tied to
+// an inventory rather than a file are linked to every given file which that
+// inventory described.  inventoryPaths maps inventory ids to paths.
+func New(files []*db.File, events []*db.Event, inventoryPaths map[int]string) *Document {
+	var doc = &Document{
+		Xmlns:    "http://www.loc.gov/premis/v3",
+		XmlnsXSI: "http://www.w3.org/2001/XMLSchema-instance",
+		Version:  "3.0",
+	}
+
+	var formats = make(map[string]string)
+	for _, e := range events {
+		if e.EventType == db.EventFormatIdentification && e.Outcome == db.EventSuccess && e.FilePublicID != "" {
+			formats[e.FilePublicID] = e.Detail
+		}
+	}
+
+	var filesByInventory = make(map[string][]string)
+	for _, f := range files {
+		var invPath = inventoryPaths[f.InventoryID]
+		filesByInventory[invPath] = append(filesByInventory[invPath], f.PublicID)
+		doc.Objects = append(doc.Objects, newObject(f, formats[f.PublicID]))
+	}
+
+	var seenAgents = make(map[string]bool)
+	for _, e := range events {
+		doc.Events = append(doc.Events, newEvent(e, filesByInventory))
+		if !seenAgents[e.Agent] {
+			seenAgents[e.Agent] = true
+			doc.Agents = append(doc.Agents, &Agent{IDType: idTypeLocal, IDValue: e.Agent, Name: e.Agent, Type: e.AgentType})
+		}
+	}
+
+	return doc
+}
+
+func newObject(f *db.File, format string) *Object {
+	var o = &Object{
+		XSIType:      "file",
+		Identifiers:  []ObjectIdentifier{{Type: idTypeLocal, Value: f.PublicID}},
+		OriginalName: f.PublicPath,
+		Characteristics: ObjectCharacteristics{
+			DigestAlgorithm: "SHA-256",
+			Digest:          f.Checksum,
+			Size:            f.Filesize,
+			FormatName:      format,
+		},
+		ContentLocation: ContentLocation{Type: "filepath", Value: f.FullPath},
+	}
+
+	if format == "" {
+		o.Characteristics.FormatName = mime.TypeByExtension(filepath.Ext(f.Name))
+		if o.Characteristics.FormatName == "" {
+			o.Characteristics.FormatName = "application/octet-stream"
+		}
+		o.Characteristics.FormatNote = "Not yet identified; guessed from the file extension"
+	}
+
+	return o
+}
+
+func newEvent(e *db.Event, filesByInventory map[string][]string) *Event {
+	var ev = &Event{
+		IDType:       idTypeLocal,
+		IDValue:      strconv.Itoa(e.ID),
+		Type:         e.EventType,
+		DateTime:     e.OccurredAt.Format(time.RFC3339),
+		Detail:       e.Detail,
+		Outcome:      e.Outcome,
+		AgentIDType:  idTypeLocal,
+		AgentIDValue: e.Agent,
+	}
+
+	if e.FilePublicID != "" {
+		ev.LinkingObjects = append(ev.LinkingObjects, LinkingObject{Type: idTypeLocal, Value: e.FilePublicID})
+	}
+	if e.InventoryPath != "" {
+		ev.LinkingObjects = append(ev.LinkingObjects, LinkingObject{Type: idTypeInventory, Value: e.InventoryPath})
+		if e.FilePublicID == "" {
+			for _, pid := range filesByInventory[e.InventoryPath] {
+				ev.LinkingObjects = append(ev.LinkingObjects, LinkingObject{Type: idTypeLocal, Value: pid})
+			}
+		}
+	}
+
+	return ev
+}
+
+// Write encodes the document as indented XML, with the XML header
+func (d *Document) Write(w io.Writer) error {
+	var _, err = io.WriteString(w, xml.Header)
+	if err != nil {
+		return err
+	}
+
+	var enc = xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	err = enc.Encode(d)
+	if err == nil {
+		_, err = io.WriteString(w, "\n")
+	}
+	return err
+}
@@ -0,0 +1,110 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// maxVariants is how many similar words a fuzzy search tries for each word
+const maxVariants = 10
+
+// Fuzz turns the query into a fuzzy search: instead of each term having to
+// appear as typed, each word in it, or an indexed word spelled like it, must
+// appear somewhere in the path.  Separators don't matter, so "anual report"
+// finds "Annual-Report.pdf" and "annual_report.tif".  Wildcard terms are
+// still matched as typed.  Words only found in files r hides aren't used.
+func (q *Query) Fuzz(op *db.Operation, r *db.Restrictions) error {
+	q.fuzzy = [][]string{}
+	for _, term := range q.Terms {
+		if strings.ContainsRune(term, '%') {
+			continue
+		}
+
+		var words = db.SplitWords(term)
+		if len(words) == 0 {
+			q.fuzzy = append(q.fuzzy, []string{term})
+			continue
+		}
+		for _, w := range words {
+			var variants = []string{w}
+			var similar, err = op.SimilarVisibleWords(w, maxVariants, r)
+			if err != nil {
+				return err
+			}
+			for _, sw := range similar {
+				if sw.Word != w {
+					variants = append(variants, sw.Word)
+				}
+			}
+			q.fuzzy = append(q.fuzzy, variants)
+		}
+	}
+	return nil
+}
+
+// Suggest returns the query with every word which isn't in the fuzzy search
+// index replaced by the most similar word which is, for a "did you mean"
+// link.  Words only found in files r hides aren't suggested.  An empty string
+// is returned if there's nothing to suggest.
+func (q *Query) Suggest(op *db.Operation, r *db.Restrictions) (string, error) {
+	var replacements = make(map[string]string)
+	for _, term := range q.Terms {
+		if strings.ContainsRune(term, '%') {
+			continue
+		}
+		for _, w := range db.SplitWords(term) {
+			var similar, err = op.SimilarVisibleWords(w, 1, r)
+			if err != nil {
+				return "", err
+			}
+			if len(similar) > 0 && similar[0].Word != w {
+				replacements[w] = similar[0].Word
+			}
+		}
+	}
+	if len(replacements) == 0 {
+		return "", nil
+	}
+
+	var parts []string
+	for _, t := range q.tokens {
+		switch {
+		case t.op != "" || strings.ContainsRune(t.value, '%'):
+			parts = append(parts, t.text)
+		case t.quoted || strings.IndexFunc(t.value, unicode.IsSpace) >= 0:
+			parts = append(parts, `"`+replaceWords(t.value, replacements)+`"`)
+		default:
+			parts = append(parts, replaceWords(t.value, replacements))
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// replaceWords replaces each word in s found in the replacements map, keyed
+// by lowercased word, leaving everything between words alone
+func replaceWords(s string, replacements map[string]string) string {
+	var isWordRune = func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
+	var out strings.Builder
+	var runes = []rune(s)
+	for i := 0; i < len(runes); {
+		if !isWordRune(runes[i]) {
+			out.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		var start = i
+		for i < len(runes) && isWordRune(runes[i]) {
+			i++
+		}
+		var word = string(runes[start:i])
+		var r, ok = replacements[strings.ToLower(word)]
+		if ok {
+			word = r
+		}
+		out.WriteString(word)
+	}
+	return out.String()
+}
@@ -0,0 +1,288 @@
+// Package query parses the search box's query language, e.g.,
+// `ext:tif date:2017-01..2017-06 size:>500MB cat:srs "annual report"`, and
+// turns it into file search conditions
+package query
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+// Query is a parsed search.  A file must match every part of it.
+type Query struct {
+	Terms    []string   // Words or phrases which must appear in the file's path
+	Category string     // The category to search, if one was given
+	Filters  db.Filters // Dates, sizes, extension, etc.
+	Notes    []string   // Text which must be in a note, or tags the file must have
+	Metadata []string   // Text which must be in the file's descriptive metadata
+
+	tokens []token    // The tokens parsed, for rewriting the query; see Suggest
+	fuzzy  [][]string // Each term's words and their variants, once Fuzz is called
+}
+
+// operator reads an operator's value into the query being parsed
+type operator func(q *Query, value string) error
+
+// operators maps each operator's name to its parser.  Operators which may
+// only be given once are checked in Parse.
+var operators = map[string]operator{
+	"cat":       parseCategory,
+	"date":      parseDate,
+	"size":      parseSize,
+	"ext":       filterSetter("ext"),
+	"format":    filterSetter("format"),
+	"checksum":  filterSetter("checksum"),
+	"inventory": filterSetter("inventory"),
+	"note":      parseNote,
+	"meta":      parseMetadata,
+}
+
+// repeatable lists operators which may be given more than once
+var repeatable = map[string]bool{"note": true, "meta": true}
+
+// Operators returns the names of all operators, sorted
+func Operators() []string {
+	var names []string
+	for name := range operators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Parse reads a query.  Errors describe what was wrong with the query in
+// terms meant for the person who typed it.
+func Parse(s string) (*Query, error) {
+	var tokens, err = scan(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var q = &Query{tokens: tokens}
+	var seen = make(map[string]bool)
+	for _, t := range tokens {
+		if t.op == "" {
+			if t.value != "" {
+				q.Terms = append(q.Terms, t.value)
+			}
+			continue
+		}
+
+		var parse = operators[t.op]
+		if parse == nil {
+			return nil, fmt.Errorf("%q uses an unknown operator %q; the operators are %s.  "+
+				"Put a term in quotes to search for a colon", t.text, t.op+":", strings.Join(Operators(), ", "))
+		}
+		if seen[t.op] && !repeatable[t.op] {
+			return nil, fmt.Errorf("%q: %s: can only be used once", t.text, t.op)
+		}
+		seen[t.op] = true
+		if t.value == "" {
+			return nil, fmt.Errorf("%q: %s: needs a value", t.text, t.op)
+		}
+		err = parse(q, t.value)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %s", t.text, err)
+		}
+	}
+	return q, nil
+}
+
+// Apply adds the query's conditions to sel.  ff describes what the viewer may
+// see and any filters they've already chosen; the query's filters narrow
+// these further.  An error is returned if the two sets of filters conflict.
+func (q *Query) Apply(sel *db.FSelect, ff db.FileFilter) error {
+	var err error
+	ff.Filters, err = ff.Filters.Combine(q.Filters)
+	if err != nil {
+		return err
+	}
+
+	sel.Filter(ff)
+	for _, term := range q.Terms {
+		if q.fuzzy == nil || strings.ContainsRune(term, '%') {
+			sel.Search("public_path LIKE ?", pattern(term))
+		}
+	}
+	for _, variants := range q.fuzzy {
+		var patterns []string
+		for _, v := range variants {
+			patterns = append(patterns, pattern(v))
+		}
+		sel.SearchAny("public_path", patterns)
+	}
+	for _, term := range q.Notes {
+		sel.Annotated(term)
+	}
+	for _, term := range q.Metadata {
+		sel.Described(term)
+	}
+	return nil
+}
+
+// pattern returns the LIKE pattern for a term: a term with a percentage sign
+// is used as-is, so wildcard searches work as they always have, and anything
+// else may appear anywhere in the path
+func pattern(term string) string {
+	if strings.ContainsRune(term, '%') {
+		return term
+	}
+	return "%" + term + "%"
+}
+
+func parseCategory(q *Query, value string) error {
+	q.Category = value
+	return nil
+}
+
+func parseNote(q *Query, value string) error {
+	q.Notes = append(q.Notes, value)
+	return nil
+}
+
+func parseMetadata(q *Query, value string) error {
+	q.Metadata = append(q.Metadata, value)
+	return nil
+}
+
+// filterSetter returns an operator which sets the named filter
+func filterSetter(name string) operator {
+	return func(q *Query, value string) error {
+		return q.Filters.Set(name, value)
+	}
+}
+
+// bound is one end of a range: the value, and whether the range excludes it
+type bound struct {
+	value  string
+	strict bool
+}
+
+// parseBounds reads a range's ends from a value like "a..b", "a..", "..b",
+// ">a", ">=a", "<b", or "<=b".  A single value is both ends.
+func parseBounds(value string) (lo, hi bound, err error) {
+	switch {
+	case strings.HasPrefix(value, ">="):
+		lo = bound{value: value[2:]}
+	case strings.HasPrefix(value, ">"):
+		lo = bound{value: value[1:], strict: true}
+	case strings.HasPrefix(value, "<="):
+		hi = bound{value: value[2:]}
+	case strings.HasPrefix(value, "<"):
+		hi = bound{value: value[1:], strict: true}
+	case strings.Contains(value, ".."):
+		var parts = strings.SplitN(value, "..", 2)
+		lo, hi = bound{value: parts[0]}, bound{value: parts[1]}
+	default:
+		lo, hi = bound{value: value}, bound{value: value}
+	}
+
+	if lo.value == "" && hi.value == "" {
+		return lo, hi, fmt.Errorf("%q is missing the value to compare against", value)
+	}
+	return lo, hi, nil
+}
+
+// dateLayouts are the date formats the date operator accepts, from most to
+// least precise, and how much time each covers
+var dateLayouts = []struct {
+	layout string
+	years  int
+	months int
+	days   int
+}{
+	{"2006-01-02", 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// parsePeriod reads a year, month, or day, returning its first and last days
+func parsePeriod(s string) (first, last time.Time, err error) {
+	for _, l := range dateLayouts {
+		first, err = time.Parse(l.layout, s)
+		if err == nil {
+			return first, first.AddDate(l.years, l.months, l.days-1), nil
+		}
+	}
+	return first, last, fmt.Errorf("invalid date %q; use YYYY, YYYY-MM, or YYYY-MM-DD", s)
+}
+
+// parseDate reads a date or range of dates, e.g., "2017", "2017-01..2017-06",
+// or ">=2017-03-15".  A year or month covers every day in it.
+func parseDate(q *Query, value string) error {
+	var lo, hi, err = parseBounds(value)
+	if err != nil {
+		return err
+	}
+
+	const day = "2006-01-02"
+	if lo.value != "" {
+		var first, last, err = parsePeriod(lo.value)
+		if err != nil {
+			return err
+		}
+		if lo.strict {
+			first = last.AddDate(0, 0, 1)
+		}
+		q.Filters.FromDate = first.Format(day)
+	}
+	if hi.value != "" {
+		var first, last, err = parsePeriod(hi.value)
+		if err != nil {
+			return err
+		}
+		if hi.strict {
+			last = first.AddDate(0, 0, -1)
+		}
+		q.Filters.ToDate = last.Format(day)
+	}
+
+	var f = q.Filters
+	if f.FromDate != "" && f.ToDate != "" && f.FromDate > f.ToDate {
+		return fmt.Errorf("the range ends (%s) before it starts (%s)", f.ToDate, f.FromDate)
+	}
+	return nil
+}
+
+// parseSize reads a file size or range of sizes, e.g., ">500MB", "1G..2G", or
+// "1500" for exactly 1500 bytes
+func parseSize(q *Query, value string) error {
+	var lo, hi, err = parseBounds(value)
+	if err != nil {
+		return err
+	}
+
+	if lo.value != "" {
+		var n, err = db.ParseSize(lo.value)
+		if err != nil {
+			return err
+		}
+		if lo.strict {
+			n++
+		}
+		q.Filters.MinSize = n
+	}
+	if hi.value != "" {
+		var n, err = db.ParseSize(hi.value)
+		if err != nil {
+			return err
+		}
+		if hi.strict {
+			n--
+		}
+		if n < 1 {
+			return fmt.Errorf("size searches can't find empty files")
+		}
+		q.Filters.MaxSize = n
+	}
+
+	var f = q.Filters
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("the range ends (%d bytes) before it starts (%d bytes)", f.MaxSize, f.MinSize)
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package query
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/uoregon-libraries/headlamp/src/db"
+)
+
+func TestParse(t *testing.T) {
+	var tests = []struct {
+		name  string
+		query string
+		want  Query
+		err   string // Text the error must contain; empty means no error
+	}{
+		{name: "empty", query: "   ", want: Query{}},
+		{name: "terms", query: "annual  report", want: Query{Terms: []string{"annual", "report"}}},
+		{name: "phrase", query: `"annual report" 2017`, want: Query{Terms: []string{"annual report", "2017"}}},
+		{name: "quoted colon", query: `"ext:tif"`, want: Query{Terms: []string{"ext:tif"}}},
+		{name: "colon after digits", query: "12:30", want: Query{Terms: []string{"12:30"}}},
+		{name: "wildcard", query: "img%.tif", want: Query{Terms: []string{"img%.tif"}}},
+		{
+			name:  "operators",
+			query: `EXT:.TIF cat:"my cat" format:image/tiff checksum:ABC inventory:12 report`,
+			want: Query{
+				Terms:    []string{"report"},
+				Category: "my cat",
+				Filters:  db.Filters{Extension: "tif", Format: "image/tiff", Checksum: "abc", Inventory: "12"},
+			},
+		},
+		{
+			name:  "repeatable operators",
+			query: "note:draft note:final meta:oregon",
+			want:  Query{Notes: []string{"draft", "final"}, Metadata: []string{"oregon"}},
+		},
+		{
+			name:  "date and size",
+			query: "date:2017 size:1K..2K",
+			want:  Query{Filters: db.Filters{FromDate: "2017-01-01", ToDate: "2017-12-31", MinSize: 1024, MaxSize: 2048}},
+		},
+		{name: "strict dates", query: "date:>2017-02", want: Query{Filters: db.Filters{FromDate: "2017-03-01"}}},
+		{name: "strict end date", query: "date:<2017", want: Query{Filters: db.Filters{ToDate: "2016-12-31"}}},
+		{name: "inclusive end date", query: "date:<=2016-02", want: Query{Filters: db.Filters{ToDate: "2016-02-29"}}},
+		{name: "strict sizes", query: "size:>1K", want: Query{Filters: db.Filters{MinSize: 1025}}},
+		{name: "strict end size", query: "size:<1K", want: Query{Filters: db.Filters{MaxSize: 1023}}},
+		{name: "unknown operator", query: "foo:bar", err: `unknown operator "foo:"`},
+		{name: "repeated operator", query: "cat:a cat:b", err: "can only be used once"},
+		{name: "missing value", query: "ext:", err: "needs a value"},
+		{name: "unclosed quote", query: `"annual report`, err: "never closed"},
+		{name: "bad date", query: "date:2017-13", err: "invalid date"},
+		{name: "backwards dates", query: "date:2018..2017", err: "ends (2017-12-31) before it starts (2018-01-01)"},
+		{name: "bad size", query: "size:lots", err: "invalid size"},
+		{name: "empty files", query: "size:<1", err: "can't find empty files"},
+		{name: "backwards sizes", query: "size:2K..1K", err: "before it starts"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var q, err = Parse(tc.query)
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("Parse(%q): expected error containing %q, got %v", tc.query, tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): unexpected error: %s", tc.query, err)
+			}
+
+			q.tokens = nil
+			if !reflect.DeepEqual(*q, tc.want) {
+				t.Errorf("Parse(%q): got %#v, expected %#v", tc.query, *q, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseBounds(t *testing.T) {
+	var tests = []struct {
+		value  string
+		lo, hi bound
+		err    bool
+	}{
+		{value: "5", lo: bound{value: "5"}, hi: bound{value: "5"}},
+		{value: "1..5", lo: bound{value: "1"}, hi: bound{value: "5"}},
+		{value: "1..", lo: bound{value: "1"}},
+		{value: "..5", hi: bound{value: "5"}},
+		{value: ">1", lo: bound{value: "1", strict: true}},
+		{value: ">=1", lo: bound{value: "1"}},
+		{value: "<5", hi: bound{value: "5", strict: true}},
+		{value: "<=5", hi: bound{value: "5"}},
+		{value: "1..5..9", lo: bound{value: "1"}, hi: bound{value: "5..9"}},
+		{value: "..", err: true},
+		{value: ">", err: true},
+		{value: "<=", err: true},
+	}
+
+	for _, tc := range tests {
+		var lo, hi, err = parseBounds(tc.value)
+		if tc.err {
+			if err == nil {
+				t.Errorf("parseBounds(%q): expected an error, got %#v, %#v", tc.value, lo, hi)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseBounds(%q): unexpected error: %s", tc.value, err)
+			continue
+		}
+		if lo != tc.lo || hi != tc.hi {
+			t.Errorf("parseBounds(%q): got %#v, %#v; expected %#v, %#v", tc.value, lo, hi, tc.lo, tc.hi)
+		}
+	}
+}
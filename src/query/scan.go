@@ -0,0 +1,75 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// token is a single search term or operator from a query, with any quotes
+// removed
+type token struct {
+	text   string // The token as typed, quotes and all, for error messages
+	op     string // The operator's name, lowercased, or empty for a plain term
+	value  string // The term or the operator's value
+	quoted bool   // True if the term was a quoted phrase
+}
+
+// scan splits a query into tokens.  Tokens are separated by whitespace, and
+// double quotes group words (or an operator's value) into a single token.
+func scan(s string) ([]token, error) {
+	var tokens []token
+	var runes = []rune(s)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var start = i
+		var value strings.Builder
+		var quoted = runes[i] == '"'
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			if runes[i] != '"' {
+				value.WriteRune(runes[i])
+				i++
+				continue
+			}
+
+			var end = i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("a quote is never closed in: %s", string(runes[start:]))
+			}
+			value.WriteString(string(runes[i+1 : end]))
+			i = end + 1
+		}
+
+		var t = token{text: string(runes[start:i]), value: value.String()}
+		if quoted && strings.HasSuffix(t.text, `"`) && strings.Count(t.text, `"`) == 2 {
+			t.quoted = true
+		} else {
+			t.op, t.value = splitOperator(t.text, t.value)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// splitOperator returns the operator name and value if the token's raw text
+// starts with a word followed by a colon, e.g., "ext:tif" or `cat:"my cat"`.
+// Otherwise the operator is empty and the value is returned unchanged.
+func splitOperator(text, value string) (op, val string) {
+	var idx = strings.IndexRune(text, ':')
+	if idx < 1 {
+		return "", value
+	}
+	for _, r := range text[:idx] {
+		if !unicode.IsLetter(r) {
+			return "", value
+		}
+	}
+	return strings.ToLower(text[:idx]), value[idx+1:]
+}
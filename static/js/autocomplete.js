@@ -0,0 +1,91 @@
+// Autocomplete for search boxes: any input with a data-autocomplete URL gets
+// a list of folders and files whose names start with what's being typed.
+// With data-autocomplete-mode="query", only the last word is completed, so
+// the rest of a query (other words, operators) is kept.
+document.addEventListener('DOMContentLoaded', function () {
+  var inputs = document.querySelectorAll("input[data-autocomplete]");
+  for (var i = 0; i < inputs.length; i++) {
+    setupAutocomplete(inputs[i], "autocomplete-" + i);
+  }
+})
+
+// autocompleteDelay is how long to wait after a keystroke, in milliseconds,
+// before asking for suggestions, so fast typing sends one request
+var autocompleteDelay = 150;
+
+function setupAutocomplete(input, listID) {
+  var list = document.createElement("datalist");
+  list.id = listID;
+  input.parentNode.appendChild(list);
+  input.setAttribute("list", listID);
+  input.setAttribute("autocomplete", "off");
+
+  var timer = null;
+  var requestNum = 0;
+  input.addEventListener("input", function() {
+    clearTimeout(timer);
+    timer = setTimeout(function() {
+      requestNum++;
+      suggest(input, list, requestNum, function() { return requestNum; });
+    }, autocompleteDelay);
+  });
+}
+
+// splitQuery returns the text before the word being typed and the word
+// itself, without a leading quote.  Operators and wildcard terms aren't
+// completed, so the word is empty for those.
+function splitQuery(value, mode) {
+  if (mode != "query") {
+    return {before: "", term: value.trim()};
+  }
+
+  var idx = value.search(/\S+$/);
+  if (idx < 0) {
+    return {before: value, term: ""};
+  }
+  var before = value.substring(0, idx);
+  var term = value.substring(idx).replace(/^"/, "");
+  if (term.indexOf(":") >= 0 || term.indexOf("%") >= 0) {
+    term = "";
+  }
+  return {before: before, term: term};
+}
+
+function suggest(input, list, num, currentNum) {
+  var mode = input.dataset["autocompleteMode"];
+  var parts = splitQuery(input.value, mode);
+  if (parts.term.length < 2) {
+    list.innerHTML = "";
+    return;
+  }
+
+  var url = input.dataset["autocomplete"] + "&term=" + encodeURIComponent(parts.term);
+  fetch(url, {credentials: "same-origin"}).then(function(response) {
+    if (response.status != 200) {
+      return null;
+    }
+    return response.json();
+  }).then(function(data) {
+    // A newer request has been sent, so this one's answer is stale
+    if (data == null || num != currentNum()) {
+      return;
+    }
+
+    list.innerHTML = "";
+    for (var i = 0; i < data.items.length; i++) {
+      var item = data.items[i];
+      var text = item.name;
+      if (mode == "query") {
+        text = item.type == "folder" ? item.path : item.name;
+        if (/\s/.test(text)) {
+          text = '"' + text + '"';
+        }
+      }
+
+      var opt = document.createElement("option");
+      opt.value = parts.before + text;
+      opt.label = item.category + "/" + item.path + (item.type == "folder" ? " (folder)" : "");
+      list.appendChild(opt);
+    }
+  });
+}